@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+)
+
+// Roles. Everyone is an employee; anyone with reports in the org chart is
+// also a manager.
+const (
+	roleAdmin    = "admin"
+	roleHR       = "hr"
+	roleManager  = "manager"
+	roleEmployee = "employee"
+)
+
+// Visibility rules a role can be granted.
+const (
+	seeReceived = "received" // reviews about yourself
+	seeReports  = "reports"  // reviews about anyone who reports to you
+	seeAuthored = "authored" // reviews you wrote
+	seeAll      = "all"      // every review in the workspace
+)
+
+// defaultVisibility is used for roles without an access.VISIBILITY entry.
+var defaultVisibility = map[string][]string{
+	roleAdmin:    {seeAll},
+	roleHR:       {seeAll},
+	roleManager:  {seeReceived, seeReports, seeAuthored},
+	roleEmployee: {seeReceived, seeAuthored},
+}
+
+// groupRoles caches the roles granted through Slack user groups, per team
+// and user. It is filled by syncGroupRoles.
+var groupRoles = struct {
+	sync.RWMutex
+	teams map[string]map[string][]string
+}{teams: make(map[string]map[string][]string)}
+
+// syncGroupRoles reloads the members of the user groups in
+// access.USER_GROUPS for teamID.
+func syncGroupRoles(ctx context.Context, teamID string) error {
+	roles := make(map[string][]string)
+	if len(configure.Access.UserGroups) > 0 {
+		client, err := slackClients.Client(teamID)
+		if err != nil {
+			return err
+		}
+		for groupID, role := range configure.Access.UserGroups {
+			members, err := client.GetUserGroupMembersContext(ctx, groupID)
+			if err != nil {
+				// Groups belong to one workspace, so the others reject them.
+				log.Printf("Could not load user group %s for team %s: %v", groupID, teamID, err)
+				continue
+			}
+			for _, userID := range members {
+				roles[userID] = append(roles[userID], role)
+			}
+		}
+	}
+
+	groupRoles.Lock()
+	groupRoles.teams[teamID] = roles
+	groupRoles.Unlock()
+	return nil
+}
+
+// rolesFor returns every role of userID in teamID.
+func rolesFor(ctx context.Context, teamID, userID string) []string {
+	roles := []string{roleEmployee}
+	for role, members := range configure.Access.Roles {
+		for _, id := range members {
+			if id == userID {
+				roles = append(roles, role)
+			}
+		}
+	}
+	for _, id := range configure.Feedback.Admins {
+		if id == userID {
+			roles = append(roles, roleAdmin)
+		}
+	}
+	if len(reportsOf(userID)) > 0 {
+		roles = append(roles, roleManager)
+	}
+
+	groupRoles.RLock()
+	team, synced := groupRoles.teams[teamID]
+	groupRoles.RUnlock()
+	if !synced {
+		if err := syncGroupRoles(ctx, teamID); err != nil {
+			log.Printf("Error loading user group roles for team %s: %v", teamID, err)
+		}
+		groupRoles.RLock()
+		team = groupRoles.teams[teamID]
+		groupRoles.RUnlock()
+	}
+	return append(roles, team[userID]...)
+}
+
+// hasRole reports whether userID has role in teamID.
+func hasRole(ctx context.Context, teamID, userID, role string) bool {
+	for _, r := range rolesFor(ctx, teamID, userID) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// reportsOf returns everyone below managerID in the org chart.
+func reportsOf(managerID string) []string {
+	var reports []string
+	seen := map[string]bool{managerID: true}
+	queue := []string{managerID}
+	for len(queue) > 0 {
+		manager := queue[0]
+		queue = queue[1:]
+		for userID, m := range configure.Org.Managers {
+			if m == manager && !seen[userID] {
+				seen[userID] = true
+				reports = append(reports, userID)
+				queue = append(queue, userID)
+			}
+		}
+	}
+	return reports
+}
+
+// visibilityFor returns the reviews userID may read, combining the rules
+// of all their roles.
+func visibilityFor(ctx context.Context, teamID, userID string) *storage.Visibility {
+	rules := make(map[string]bool)
+	for _, role := range rolesFor(ctx, teamID, userID) {
+		granted, ok := configure.Access.Visibility[role]
+		if !ok {
+			granted = defaultVisibility[role]
+		}
+		for _, rule := range granted {
+			rules[rule] = true
+		}
+	}
+
+	if rules[seeAll] {
+		return &storage.Visibility{All: true}
+	}
+
+	v := &storage.Visibility{}
+	if rules[seeReceived] {
+		v.RevieweeIDs = append(v.RevieweeIDs, userID)
+	}
+	if rules[seeReports] {
+		v.RevieweeIDs = append(v.RevieweeIDs, reportsOf(userID)...)
+	}
+	if rules[seeAuthored] {
+		v.AuthorID = userID
+		v.AuthorHash = reviewerHash(teamID, userID)
+	}
+	return v
+}
+
+// viewerQuery starts a review query on behalf of userID, limited to the
+// reviews they may read.
+func viewerQuery(ctx context.Context, teamID, userID string) storage.ReviewQuery {
+	return storage.ReviewQuery{
+		TeamID:  teamID,
+		Visible: visibilityFor(ctx, teamID, userID),
+	}
+}
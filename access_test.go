@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+)
+
+// accessConfig sets up an org chart for the length of the test:
+//
+//	M1 manages M2 and E1, and M2 manages E2. E3 has no manager.
+//
+// A is an admin through feedback.ADMINS, H has the hr role through
+// access.ROLES and G through a user group.
+func accessConfig(t *testing.T, visibility map[string][]string) {
+	t.Helper()
+	previous := configure
+	groupRoles.Lock()
+	previousGroups := groupRoles.teams
+	groupRoles.teams = map[string]map[string][]string{"T1": {"G": {roleHR}}}
+	groupRoles.Unlock()
+	t.Cleanup(func() {
+		configure = previous
+		groupRoles.Lock()
+		groupRoles.teams = previousGroups
+		groupRoles.Unlock()
+	})
+
+	configure.Org.Managers = map[string]string{"M2": "M1", "E1": "M1", "E2": "M2"}
+	configure.Feedback.Admins = []string{"A"}
+	configure.Feedback.AnonymityKey = "test key"
+	configure.Access.Roles = map[string][]string{roleHR: {"H"}}
+	configure.Access.UserGroups = nil
+	configure.Access.Visibility = visibility
+}
+
+func sorted(ids []string) []string {
+	ids = append([]string{}, ids...)
+	sort.Strings(ids)
+	return ids
+}
+
+func TestReportsOf(t *testing.T) {
+	accessConfig(t, nil)
+	tests := []struct {
+		manager string
+		want    []string
+	}{
+		{"M1", []string{"E1", "E2", "M2"}},
+		{"M2", []string{"E2"}},
+		{"E1", []string{}},
+		{"X", []string{}},
+	}
+	for _, tt := range tests {
+		if got := sorted(reportsOf(tt.manager)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("reportsOf(%s) = %v, want %v", tt.manager, got, tt.want)
+		}
+	}
+}
+
+func TestRolesFor(t *testing.T) {
+	accessConfig(t, nil)
+	ctx := context.Background()
+	tests := []struct {
+		userID string
+		want   []string
+	}{
+		{"E1", []string{roleEmployee}},
+		{"M1", []string{roleEmployee, roleManager}},
+		{"M2", []string{roleEmployee, roleManager}},
+		{"A", []string{roleAdmin, roleEmployee}},
+		{"H", []string{roleEmployee, roleHR}},
+		{"G", []string{roleEmployee, roleHR}},
+	}
+	for _, tt := range tests {
+		if got := sorted(rolesFor(ctx, "T1", tt.userID)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("rolesFor(%s) = %v, want %v", tt.userID, got, tt.want)
+		}
+	}
+}
+
+func TestVisibilityFor(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		visibility map[string][]string
+		userID     string
+		want       storage.Visibility
+	}{
+		{"employee", nil, "E1", storage.Visibility{RevieweeIDs: []string{"E1"}, AuthorID: "E1", AuthorHash: "E1"}},
+		{"manager", nil, "M2", storage.Visibility{RevieweeIDs: []string{"E2", "M2"}, AuthorID: "M2", AuthorHash: "M2"}},
+		{"indirect reports", nil, "M1", storage.Visibility{RevieweeIDs: []string{"E1", "E2", "M1", "M2"}, AuthorID: "M1", AuthorHash: "M1"}},
+		{"admin", nil, "A", storage.Visibility{All: true}},
+		{"hr", nil, "H", storage.Visibility{All: true}},
+		{"hr by user group", nil, "G", storage.Visibility{All: true}},
+		{"received only", map[string][]string{roleEmployee: {seeReceived}}, "E1", storage.Visibility{RevieweeIDs: []string{"E1"}}},
+		{"authored only", map[string][]string{roleEmployee: {seeAuthored}}, "E1", storage.Visibility{AuthorID: "E1", AuthorHash: "E1"}},
+		{"nothing", map[string][]string{roleEmployee: {}}, "E1", storage.Visibility{}},
+		{"rules of every role", map[string][]string{roleEmployee: {}, roleManager: {seeReports}}, "M2", storage.Visibility{RevieweeIDs: []string{"E2"}}},
+		{"hr restricted", map[string][]string{roleHR: {seeReceived}}, "H", storage.Visibility{RevieweeIDs: []string{"H"}, AuthorID: "H", AuthorHash: "H"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accessConfig(t, tt.visibility)
+			want := tt.want
+			if want.AuthorHash != "" {
+				want.AuthorHash = reviewerHash("T1", want.AuthorHash)
+			}
+			got := visibilityFor(ctx, "T1", tt.userID)
+			got.RevieweeIDs = sorted(got.RevieweeIDs)
+			want.RevieweeIDs = sorted(want.RevieweeIDs)
+			if !reflect.DeepEqual(*got, want) {
+				t.Fatalf("visibilityFor(%s) = %+v, want %+v", tt.userID, *got, want)
+			}
+		})
+	}
+}
+
+func TestViewerQuery(t *testing.T) {
+	ctx := context.Background()
+	accessConfig(t, nil)
+	named := func(id, author, reviewee string) storage.Review {
+		return storage.Review{SubmissionID: id, TeamID: "T1", UserID: author, RevieweeID: reviewee, Timestamp: "2024-01-01T00:00:00Z"}
+	}
+	anonymous := func(id, author, reviewee string) storage.Review {
+		return storage.Review{SubmissionID: id, TeamID: "T1", Anonymous: true, ReviewerHash: reviewerHash("T1", author), RevieweeID: reviewee, Timestamp: "2024-01-01T00:00:00Z"}
+	}
+	exportStore(t,
+		named("S1", "E1", "E2"),
+		anonymous("S2", "E1", "M2"),
+		named("S3", "M2", "E1"),
+		named("S4", "E2", "E3"),
+		anonymous("S5", "E3", "M1"),
+		anonymous("S6", "E2", "E1"),
+	)
+
+	tests := []struct {
+		userID string
+		want   []string
+	}{
+		// Received, and written by name and anonymously.
+		{"E1", []string{"S1", "S2", "S3", "S6"}},
+		{"E3", []string{"S4", "S5"}},
+		// Received, written and about their report E2.
+		{"M2", []string{"S1", "S2", "S3"}},
+		// Received and about M2, E1 and E2 below them.
+		{"M1", []string{"S1", "S2", "S3", "S5", "S6"}},
+		{"A", []string{"S1", "S2", "S3", "S4", "S5", "S6"}},
+		{"H", []string{"S1", "S2", "S3", "S4", "S5", "S6"}},
+		{"G", []string{"S1", "S2", "S3", "S4", "S5", "S6"}},
+	}
+	for _, tt := range tests {
+		q := viewerQuery(ctx, "T1", tt.userID)
+		q.Limit = 100
+		page, err := store.QueryReviews(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range page.Reviews {
+			got = append(got, r.SubmissionID)
+		}
+		if got = sorted(got); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("reviews visible to %s = %v, want %v", tt.userID, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/slack-go/slack"
+)
+
+// Stat counter keys. Reviewers are identified by user ID, or by "h:" and
+// their reviewer hash for anonymous reviews.
+const (
+	statGiven    = "given#"    // + reviewer: reviews written
+	statReceived = "received#" // + reviewee ID: reviews received
+	statWeek     = "week#"     // + ISO week such as 2024-W05: reviews submitted
+	statPeriod   = "period#"   // + cycle ID or month + "#" + reviewer hash: reviews per reviewer in a period
+	// + reviewee ID + "#" + month: sum of sentiment scores in hundredths,
+	// and number of scored reviews
+	statSentiment      = "sentiment#"
+	statSentimentCount = "sentimentn#"
+)
+
+// trendMonths is how many months of sentiment the home tab shows.
+const trendMonths = 6
+
+// trendWeeks is how many weeks of submissions the home tab charts.
+const trendWeeks = 8
+
+// statsEvent is a change to one review. Before is nil for new reviews and
+// After is nil for deleted ones.
+type statsEvent struct {
+	Before *storage.Review
+	After  *storage.Review
+}
+
+// statsEvents feeds the aggregator started by aggregateStats.
+var statsEvents = make(chan statsEvent, 256)
+
+// recordReviewChange queues a review change for the stats aggregator. If
+// the queue is full the change is dropped and picked up by the next
+// rebuild.
+func recordReviewChange(before, after *storage.Review) {
+	select {
+	case statsEvents <- statsEvent{Before: copyReview(before), After: copyReview(after)}:
+	default:
+		log.Printf("Stats queue is full; counters will catch up at the next rebuild")
+	}
+}
+
+func copyReview(r *storage.Review) *storage.Review {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	return &c
+}
+
+// aggregateStats applies review changes to the stats counters as they
+// happen, until ctx is done. The stats-rebuild job corrects any drift.
+func aggregateStats(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-statsEvents:
+				applyStatsEvent(ctx, event)
+			}
+		}
+	}()
+}
+
+func applyStatsEvent(ctx context.Context, event statsEvent) {
+	deltas := make(map[string]map[string]int)
+	add := func(r *storage.Review, sign int) {
+		if r == nil || !countsInStats(*r) {
+			return
+		}
+		if deltas[r.TeamID] == nil {
+			deltas[r.TeamID] = make(map[string]int)
+		}
+		for key, n := range statDeltas(*r) {
+			deltas[r.TeamID][key] += sign * n
+		}
+	}
+	add(event.Before, -1)
+	add(event.After, 1)
+
+	for teamID, teamDeltas := range deltas {
+		for key, d := range teamDeltas {
+			if d == 0 {
+				delete(teamDeltas, key)
+			}
+		}
+		if len(teamDeltas) == 0 {
+			continue
+		}
+		if err := store.AddStats(ctx, teamID, teamDeltas); err != nil {
+			log.Printf("Error updating stats of team %s: %v", teamID, err)
+		}
+	}
+}
+
+// rebuildStats recomputes every team's counters from the stored reviews.
+func rebuildStats(ctx context.Context) error {
+	teamIDs, err := store.ListTeamIDs(ctx)
+	if err != nil {
+		return err
+	}
+	counters := make(map[string]map[string]int, len(teamIDs))
+	for _, teamID := range teamIDs {
+		counters[teamID] = make(map[string]int)
+	}
+
+	err = store.EachReview(ctx, func(r storage.Review) error {
+		if team, ok := counters[r.TeamID]; ok && countsInStats(r) {
+			for key, n := range statDeltas(r) {
+				team[key] += n
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for teamID, team := range counters {
+		if err := store.ReplaceStats(ctx, teamID, team); err != nil {
+			return fmt.Errorf("replacing stats of team %s: %w", teamID, err)
+		}
+	}
+	log.Printf("Rebuilt stats for %d teams", len(counters))
+	return nil
+}
+
+// countsInStats reports whether r is included in the counters. Reviews
+// still in moderation or rejected are not, nor are reviews from before
+// multi-workspace support.
+func countsInStats(r storage.Review) bool {
+	return r.TeamID != "" && r.Approved()
+}
+
+// statDeltas returns what r adds to each counter. Period counters always
+// use the reviewer hash so anonymous and named reviews by the same person
+// count them once.
+func statDeltas(r storage.Review) map[string]int {
+	deltas := map[string]int{statGiven + statReviewer(r): 1}
+
+	hash := r.ReviewerHash
+	if !r.Anonymous {
+		hash = reviewerHash(r.TeamID, r.UserID)
+	}
+	if r.RevieweeID != "" {
+		deltas[statReceived+r.RevieweeID] = 1
+	}
+	if t, err := time.Parse(time.RFC3339, r.Timestamp); err == nil {
+		month := t.Format("2006-01")
+		deltas[statWeek+isoWeek(t)] = 1
+		deltas[statPeriod+month+"#"+hash] = 1
+		if r.RevieweeID != "" && r.Sentiment != nil {
+			deltas[statSentiment+r.RevieweeID+"#"+month] = int(math.Round(*r.Sentiment * 100))
+			deltas[statSentimentCount+r.RevieweeID+"#"+month] = 1
+		}
+	}
+	if r.CycleID != "" {
+		deltas[statPeriod+r.CycleID+"#"+hash] = 1
+	}
+	return deltas
+}
+
+func statReviewer(r storage.Review) string {
+	if r.Anonymous {
+		return "h:" + r.ReviewerHash
+	}
+	return r.UserID
+}
+
+func isoWeek(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// analyticsBlocks renders the stats of teamID for userID: their own
+// counts, those of the people whose reviews they can see, weekly
+// submissions, top recipients and participation in the current period.
+func analyticsBlocks(ctx context.Context, teamID, userID string) []slack.Block {
+	stats, err := store.GetStats(ctx, teamID)
+	if err != nil {
+		log.Printf("Error loading stats of team %s: %v", teamID, err)
+		return nil
+	}
+
+	mrkdwn := func(text string) slack.Block {
+		return slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", text, false, false), nil, nil)
+	}
+
+	given := stats[statGiven+userID] + stats[statGiven+"h:"+reviewerHash(teamID, userID)]
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject("plain_text", "Feedback analytics", false, false)),
+		mrkdwn(fmt.Sprintf("You have given *%d* and received *%d* reviews.", given, stats[statReceived+userID])),
+	}
+
+	people := analyticsPeople(ctx, teamID, userID, stats)
+	if len(people) > 0 {
+		lines := []string{"*Given / received*"}
+		for _, id := range people {
+			lines = append(lines, fmt.Sprintf("<@%s>: %d / %d", id, stats[statGiven+id], stats[statReceived+id]))
+		}
+		blocks = append(blocks, mrkdwn(strings.Join(lines, "\n")))
+	}
+
+	// Reviewees see their own sentiment trend, managers that of the people
+	// whose reviews they can see.
+	trends := []string{"*Sentiment trend*"}
+	if trend := sentimentTrend(stats, userID, time.Now()); trend != "" {
+		trends = append(trends, "You: "+trend)
+	}
+	for _, id := range people {
+		if trend := sentimentTrend(stats, id, time.Now()); trend != "" {
+			trends = append(trends, fmt.Sprintf("<@%s>: %s", id, trend))
+		}
+	}
+	if len(trends) > 1 {
+		blocks = append(blocks, mrkdwn(strings.Join(trends, "\n")))
+	}
+
+	blocks = append(blocks, mrkdwn(weeklyTrend(stats, time.Now())))
+
+	if top := topRecipients(stats, 5); len(top) > 0 {
+		lines := []string{"*Top recipients*"}
+		for i, id := range top {
+			lines = append(lines, fmt.Sprintf("%d. <@%s> (%d)", i+1, id, stats[statReceived+id]))
+		}
+		blocks = append(blocks, mrkdwn(strings.Join(lines, "\n")))
+	}
+
+	if participation := participationText(ctx, teamID, stats); participation != "" {
+		blocks = append(blocks, mrkdwn(participation))
+	}
+
+	return append(blocks, slack.NewDividerBlock())
+}
+
+// analyticsPeople returns up to 10 people, other than userID, whose
+// reviews userID may see, most reviewed first.
+func analyticsPeople(ctx context.Context, teamID, userID string, stats map[string]int) []string {
+	v := visibilityFor(ctx, teamID, userID)
+
+	var people []string
+	if v.All {
+		for key := range stats {
+			if strings.HasPrefix(key, statReceived) {
+				people = append(people, strings.TrimPrefix(key, statReceived))
+			}
+		}
+	} else {
+		people = append(people, v.RevieweeIDs...)
+	}
+
+	filtered := people[:0]
+	for _, id := range people {
+		if id != userID {
+			filtered = append(filtered, id)
+		}
+	}
+	people = filtered
+
+	sort.Slice(people, func(i, j int) bool {
+		ri, rj := stats[statReceived+people[i]], stats[statReceived+people[j]]
+		if ri != rj {
+			return ri > rj
+		}
+		return people[i] < people[j]
+	})
+	if len(people) > 10 {
+		people = people[:10]
+	}
+	return people
+}
+
+// weeklyTrend charts submissions over the last trendWeeks weeks.
+func weeklyTrend(stats map[string]int, now time.Time) string {
+	lines := []string{"*Reviews per week*"}
+	max := 0
+	var weeks []string
+	for i := trendWeeks - 1; i >= 0; i-- {
+		week := isoWeek(now.AddDate(0, 0, -7*i))
+		weeks = append(weeks, week)
+		if n := stats[statWeek+week]; n > max {
+			max = n
+		}
+	}
+
+	for _, week := range weeks {
+		n := stats[statWeek+week]
+		bar := 0
+		if max > 0 {
+			bar = n * 20 / max
+		}
+		lines = append(lines, fmt.Sprintf("`%s` %s %d", week, strings.Repeat("█", bar), n))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sentimentTrend lists the average sentiment of reviews received by userID
+// in each of the last trendMonths months that had any, oldest first.
+func sentimentTrend(stats map[string]int, userID string, now time.Time) string {
+	var parts []string
+	first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := trendMonths - 1; i >= 0; i-- {
+		month := first.AddDate(0, -i, 0)
+		key := userID + "#" + month.Format("2006-01")
+		n := stats[statSentimentCount+key]
+		if n <= 0 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s %+.2f", month.Format("Jan"), float64(stats[statSentiment+key])/100/float64(n)))
+	}
+	return strings.Join(parts, " → ")
+}
+
+// topRecipients returns the n people who received the most reviews.
+func topRecipients(stats map[string]int, n int) []string {
+	var people []string
+	for key, count := range stats {
+		if strings.HasPrefix(key, statReceived) && count > 0 {
+			people = append(people, strings.TrimPrefix(key, statReceived))
+		}
+	}
+	sort.Slice(people, func(i, j int) bool {
+		ci, cj := stats[statReceived+people[i]], stats[statReceived+people[j]]
+		if ci != cj {
+			return ci > cj
+		}
+		return people[i] < people[j]
+	})
+	if len(people) > n {
+		people = people[:n]
+	}
+	return people
+}
+
+// participationText describes how many people have written a review in
+// the current period: the active cycle, measured against its
+// participants, or else the current month, measured against the roster.
+func participationText(ctx context.Context, teamID string, stats map[string]int) string {
+	period, label, eligible := time.Now().UTC().Format("2006-01"), "this month", 0
+
+	cycle, err := activeCycle(ctx, teamID)
+	if err != nil {
+		log.Printf("Error loading active cycle of team %s: %v", teamID, err)
+	}
+	if cycle != nil {
+		period, label, eligible = cycle.CycleID, cycle.Name, len(cycle.Participants)
+	} else {
+		eligible, err = rosterSize(ctx, teamID)
+		if err != nil {
+			log.Printf("Error counting roster of team %s: %v", teamID, err)
+			return ""
+		}
+	}
+	if eligible == 0 {
+		return ""
+	}
+
+	prefix := statPeriod + period + "#"
+	reviewers := 0
+	for key, n := range stats {
+		if strings.HasPrefix(key, prefix) && n > 0 {
+			reviewers++
+		}
+	}
+	if reviewers > eligible {
+		reviewers = eligible
+	}
+
+	return fmt.Sprintf("*Participation in %s:* %d of %d people (%d%%)", label, reviewers, eligible, reviewers*100/eligible)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// Anonymity modes for feedback.ANONYMITY in config.yaml.
+const (
+	anonymityAllowed   = "allowed"
+	anonymityRequired  = "required"
+	anonymityForbidden = "forbidden"
+)
+
+// anonymityMode returns the configured anonymity mode. Anonymous reviews
+// need feedback.ANONYMITY_KEY to hash reviewers, so without it anonymity
+// is forbidden whatever the mode says.
+func anonymityMode() string {
+	mode := strings.ToLower(configure.Feedback.Anonymity)
+	if mode == "" {
+		mode = anonymityAllowed
+	}
+	if mode != anonymityAllowed && mode != anonymityRequired && mode != anonymityForbidden {
+		log.Printf("Unknown feedback anonymity %q, forbidding anonymous reviews", configure.Feedback.Anonymity)
+		return anonymityForbidden
+	}
+	if mode != anonymityForbidden && configure.Feedback.AnonymityKey == "" {
+		return anonymityForbidden
+	}
+	return mode
+}
+
+// reviewerHash identifies userID without revealing them. It is stable, so
+// the same reviewer can be recognized across anonymous reviews by anyone
+// holding the key.
+func reviewerHash(teamID, userID string) string {
+	mac := hmac.New(sha256.New, []byte(configure.Feedback.AnonymityKey))
+	mac.Write([]byte(teamID + ":" + userID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// submittedAnonymously reports whether a feedback modal submission should
+// be stored anonymously.
+func submittedAnonymously(values map[string]map[string]slack.BlockAction) bool {
+	switch anonymityMode() {
+	case anonymityRequired:
+		return true
+	case anonymityAllowed:
+		return len(values["anonymous"]["anonymous_input"].SelectedOptions) > 0
+	default:
+		return false
+	}
+}
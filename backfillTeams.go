@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+)
+
+// backfillTeamIDs tags every review stored before multi-workspace support
+// with teamID, the workspace the bot was first installed in. Queries only
+// return reviews of the querying team, so untagged reviews stay hidden
+// until this has run.
+func backfillTeamIDs(ctx context.Context, s storage.Store, teamID string) error {
+	if teamID == "" {
+		return errors.New("slack.TEAM_ID must name the workspace the untagged reviews belong to")
+	}
+
+	tagged := 0
+	err := s.EachReview(ctx, func(r storage.Review) error {
+		if r.TeamID != "" {
+			return nil
+		}
+		r.TeamID = teamID
+		if err := s.PutReview(ctx, &r); err != nil {
+			return fmt.Errorf("writing review %s: %w", r.SubmissionID, err)
+		}
+		tagged++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Tagged %d reviews with team %s\n", tagged, teamID)
+	return nil
+}
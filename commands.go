@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/slack-go/slack"
+)
+
+const reviewHelp = "*Usage:*\n" +
+	"• `/review @someone` opens the feedback form for a co-worker\n" +
+	"• `/review list` shows the reviews you submitted recently\n" +
+	"• `/review notify on|off` turns DMs about feedback you receive on or off\n" +
+	"• `/review help` shows this message"
+
+// mentionPattern matches an escaped user mention such as <@U123|jane>.
+var mentionPattern = regexp.MustCompile(`^<@([A-Z0-9]+)(?:\|[^>]*)?>$`)
+
+func CommandsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := verifySlackRequest(w, r); !ok {
+		return
+	}
+
+	cmd, err := slack.SlashCommandParse(r)
+	if err != nil {
+		log.Printf("Could not parse slash command: %v", err)
+		http.Error(w, "Could not parse slash command", http.StatusBadRequest)
+		return
+	}
+	log.Printf("Slash command %s %q from %s in team %s", cmd.Command, cmd.Text, cmd.UserID, cmd.TeamID)
+
+	switch cmd.Command {
+	case "/review":
+		reviewCommand(w, r, cmd)
+	default:
+		respondEphemeral(w, fmt.Sprintf("Sorry, I don't know the command %s.", cmd.Command), nil)
+	}
+}
+
+func reviewCommand(w http.ResponseWriter, r *http.Request, cmd slack.SlashCommand) {
+	args := strings.Fields(cmd.Text)
+	if len(args) == 0 || args[0] == "help" {
+		respondEphemeral(w, reviewHelp, nil)
+		return
+	}
+
+	if args[0] == "list" {
+		listOwnReviews(w, r, cmd)
+		return
+	}
+
+	if args[0] == "notify" && len(args) == 2 && (args[1] == "on" || args[1] == "off") {
+		on := args[1] == "on"
+		if err := setNotifyReceived(r.Context(), cmd.TeamID, cmd.UserID, on); err != nil {
+			log.Printf("Error saving preferences of %s: %v", cmd.UserID, err)
+			http.Error(w, "Failed to save preferences", http.StatusInternalServerError)
+			return
+		}
+		if on {
+			respondEphemeral(w, "I'll send you a DM when you receive feedback.", nil)
+		} else {
+			respondEphemeral(w, "I won't send you DMs about feedback you receive.", nil)
+		}
+		go PublishHomePage(cmd.TeamID, cmd.UserID, nil)
+		return
+	}
+
+	if strings.HasPrefix(args[0], "<@") || strings.HasPrefix(args[0], "@") {
+		openReviewFor(w, r, cmd, args[0])
+		return
+	}
+
+	respondEphemeral(w, reviewHelp, nil)
+}
+
+// openReviewFor opens the guided form at the prompts step for the
+// mentioned user.
+func openReviewFor(w http.ResponseWriter, r *http.Request, cmd slack.SlashCommand, mention string) {
+	member, err := findMentionedMember(r, cmd.TeamID, mention)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondEphemeral(w, fmt.Sprintf("I couldn't find %s among the active members of this workspace.", mention), nil)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up %s: %v", mention, err)
+		http.Error(w, "Failed to look up user", http.StatusInternalServerError)
+		return
+	}
+
+	// The reviewee step is skipped, so its checks are made here; the
+	// confirm step makes them again.
+	problem, _, err := validateReviewee(r.Context(), cmd.TeamID, cmd.UserID, member.UserID, "")
+	if err != nil {
+		log.Printf("Error validating reviewee %s: %v", member.UserID, err)
+		http.Error(w, "Failed to validate reviewee", http.StatusInternalServerError)
+		return
+	}
+	if problem != "" {
+		respondEphemeral(w, problem, nil)
+		return
+	}
+
+	client, err := slackClients.Client(cmd.TeamID)
+	if err != nil {
+		log.Printf("Error resolving Slack client for team %s: %v", cmd.TeamID, err)
+		http.Error(w, "Unknown team", http.StatusInternalServerError)
+		return
+	}
+
+	state := newWizard(r.Context(), cmd.TeamID)
+	state.RevieweeID = member.UserID
+	state.RevieweeName = member.Name
+	openWizardAt(w, client, cmd.TriggerID, wizardFirstStep(state))
+}
+
+// findMentionedMember resolves an escaped mention (<@U123|jane>) by ID, or
+// a plain @name by matching roster names.
+func findMentionedMember(r *http.Request, teamID, mention string) (*storage.RosterMember, error) {
+	if m := mentionPattern.FindStringSubmatch(mention); m != nil {
+		return store.GetRosterMember(r.Context(), teamID, m[1])
+	}
+
+	name := strings.ToLower(strings.TrimPrefix(mention, "@"))
+	members, err := store.SearchRoster(r.Context(), teamID, name, maxSuggestions)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		if strings.ToLower(m.Name) == name {
+			return &m, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no roster member named %s", storage.ErrNotFound, name)
+}
+
+// listOwnReviews shows the caller the reviews they submitted most recently.
+func listOwnReviews(w http.ResponseWriter, r *http.Request, cmd slack.SlashCommand) {
+	q := viewerQuery(r.Context(), cmd.TeamID, cmd.UserID)
+	q.AuthorID = cmd.UserID
+	q.AuthorHash = reviewerHash(cmd.TeamID, cmd.UserID)
+	q.Limit = reviewsPerPage
+
+	page, err := store.QueryReviews(r.Context(), q)
+	if err != nil {
+		log.Printf("Error fetching reviews by %s: %v", cmd.UserID, err)
+		http.Error(w, "Failed to fetch reviews", http.StatusInternalServerError)
+		return
+	}
+
+	if len(page.Reviews) == 0 {
+		respondEphemeral(w, "You haven't submitted any reviews yet.", nil)
+		return
+	}
+
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", "*Your recent reviews*", false, false), nil, nil),
+	}
+	for _, review := range page.Reviews {
+		text := fmt.Sprintf("*Employee Reviewed:* %s\n*Submitted:* %s\n%s", revieweeLabel(review), review.Timestamp, reviewBody(review))
+		if status := statusLabel(review); status != "" {
+			text += "\n*Status:* " + status
+		}
+		blocks = append(blocks, slack.NewDividerBlock(), slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", text, false, false), nil, reviewOverflow(review)))
+	}
+
+	respondEphemeral(w, "Your recent reviews", blocks)
+}
+
+// respondEphemeral answers a slash command with a message only the caller
+// can see. text is the notification fallback when blocks are given.
+func respondEphemeral(w http.ResponseWriter, text string, blocks []slack.Block) {
+	msg := struct {
+		ResponseType string        `json:"response_type"`
+		Text         string        `json:"text"`
+		Blocks       []slack.Block `json:"blocks,omitempty"`
+	}{slack.ResponseTypeEphemeral, text, blocks}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(msg); err != nil {
+		log.Printf("Error writing slash command response: %v", err)
+	}
+}
@@ -9,25 +9,119 @@ import (
 type Config struct {
 	Slack struct {
 		BOTToken          string `yaml:"BOT_TOKEN"`
-		AppAccessToken       string `yaml:"APP_CONFIG_ACCESS_TOKEN"`
-		AppRefreshToken      string `yaml:"APP_REFRESH_TOKEN"`
+		AppAccessToken    string `yaml:"APP_CONFIG_ACCESS_TOKEN"`
+		AppRefreshToken   string `yaml:"APP_REFRESH_TOKEN"`
 		AppID             string `yaml:"APP_ID"`
 		ClientID          string `yaml:"CLIENT_ID"`
 		ClientSecret      string `yaml:"CLIENT_SECRET"`
 		SigningSecret     string `yaml:"SIGNING_SECRET"`
 		VerificationToken string `yaml:"VERIFICATION_TOKEN"`
 		TeamID            string `yaml:"TEAM_ID"`
+		// TokenRefreshMargin is a duration such as 30m before expiry at
+		// which bot and app tokens are refreshed.
+		TokenRefreshMargin string `yaml:"TOKEN_REFRESH_MARGIN"`
 	} `yaml:"slack"`
 	Aws struct {
 		AccessKey       string `yaml:"ACCESS_KEY"`
 		SecretAccessKey string `yaml:"SECRET_ACCESS_KEY"`
 	} `yaml:"aws"`
+	Storage struct {
+		Backend          string `yaml:"BACKEND"`
+		TokensTable      string `yaml:"TOKENS_TABLE"`
+		ReviewsTable     string `yaml:"REVIEWS_TABLE"`
+		UsersTable       string `yaml:"USERS_TABLE"`
+		RosterTable      string `yaml:"ROSTER_TABLE"`
+		CyclesTable      string `yaml:"CYCLES_TABLE"`
+		StatsTable       string `yaml:"STATS_TABLE"`
+		DraftsTable      string `yaml:"DRAFTS_TABLE"`
+		PreferencesTable string `yaml:"PREFERENCES_TABLE"`
+		OutboxTable      string `yaml:"OUTBOX_TABLE"`
+		JobsTable        string `yaml:"JOBS_TABLE"`
+	} `yaml:"storage"`
+	Encryption struct {
+		Provider    string `yaml:"PROVIDER"`
+		KeyringFile string `yaml:"KEYRING_FILE"`
+		KMSKeyID    string `yaml:"KMS_KEY_ID"`
+		KMSEndpoint string `yaml:"KMS_ENDPOINT"`
+	} `yaml:"encryption"`
+	Feedback struct {
+		Anonymity    string `yaml:"ANONYMITY"`
+		AnonymityKey string `yaml:"ANONYMITY_KEY"`
+		TemplatesDir string `yaml:"TEMPLATES_DIR"`
+		Template     string `yaml:"TEMPLATE"`
+		// Admins are given the admin role. Prefer access.ROLES.
+		Admins []string `yaml:"ADMINS"`
+	} `yaml:"feedback"`
+	Moderation struct {
+		Enabled bool `yaml:"ENABLED"`
+		// Moderators approve reviews of people without a manager.
+		Moderators []string `yaml:"MODERATORS"`
+	} `yaml:"moderation"`
+	Org struct {
+		// Managers maps a user ID to the user ID of their manager.
+		Managers map[string]string `yaml:"MANAGERS"`
+	} `yaml:"org"`
+	Access struct {
+		// Roles maps a role to the user IDs that have it.
+		Roles map[string][]string `yaml:"ROLES"`
+		// UserGroups maps a Slack user group ID to the role its members have.
+		UserGroups map[string]string `yaml:"USER_GROUPS"`
+		// Visibility overrides which reviews each role can see.
+		Visibility map[string][]string `yaml:"VISIBILITY"`
+	} `yaml:"access"`
+	Export struct {
+		// Tokens are the bearer tokens accepted by /export, each acting as
+		// one Slack user.
+		Tokens []struct {
+			Token  string `yaml:"TOKEN"`
+			TeamID string `yaml:"TEAM_ID"`
+			UserID string `yaml:"USER_ID"`
+		} `yaml:"TOKENS"`
+	} `yaml:"export"`
+	Sentiment struct {
+		// LexiconFile replaces the bundled word list.
+		LexiconFile string `yaml:"LEXICON_FILE"`
+		// Reviews scoring at or below NegativeThreshold are strongly
+		// negative; AlertRun of them in a row alerts the manager.
+		NegativeThreshold float64 `yaml:"NEGATIVE_THRESHOLD"`
+		AlertRun          int     `yaml:"ALERT_RUN"`
+	} `yaml:"sentiment"`
+	Content struct {
+		MaxLength       int    `yaml:"MAX_LENGTH"`
+		MaxLengthAction string `yaml:"MAX_LENGTH_ACTION"`
+		// WordsFile replaces the bundled list of offensive words, and
+		// ExtraWords and AllowedWords adjust whichever list is used.
+		WordsFile       string   `yaml:"WORDS_FILE"`
+		ExtraWords      []string `yaml:"EXTRA_WORDS"`
+		AllowedWords    []string `yaml:"ALLOWED_WORDS"`
+		ProfanityAction string   `yaml:"PROFANITY_ACTION"`
+		PIIAction       string   `yaml:"PII_ACTION"`
+	} `yaml:"content"`
+	Validation struct {
+		MinFeedbackLength int `yaml:"MIN_FEEDBACK_LENGTH"`
+		// Cooldown is a duration such as 168h between reviews of the same
+		// person by the same author.
+		Cooldown string `yaml:"COOLDOWN"`
+	} `yaml:"validation"`
+	Drafts struct {
+		// TTL is a duration such as 168h after which an unsubmitted draft
+		// is discarded.
+		TTL string `yaml:"TTL"`
+	} `yaml:"drafts"`
+	Views struct {
+		// Dir replaces the bundled slackViews templates.
+		Dir string `yaml:"DIR"`
+	} `yaml:"views"`
+	Scheduler struct {
+		// Jobs overrides the schedule of a background job by name, with an
+		// interval such as 10h or a cron expression such as "0 6 * * 1-5".
+		Jobs map[string]string `yaml:"JOBS"`
+	} `yaml:"scheduler"`
 }
 
 var configure Config
 
-
-func readConfig(configPath string) error{
+func readConfig(configPath string) error {
 	yamlFile, err := ioutil.ReadFile(configPath)
 	if err != nil {
 		return err
@@ -39,4 +133,4 @@ func readConfig(configPath string) error{
 	}
 
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/BigPhatNerd/cbaseSLACK/contentfilter"
+	"github.com/BigPhatNerd/cbaseSLACK/reviewtemplate"
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/slack-go/slack"
+)
+
+// contentRules checks the text of submitted reviews.
+var contentRules *contentfilter.Rules
+
+// loadContentRules builds the rules from the content section of the
+// config. Lengths default to blocking, profanity to blocking and personal
+// information to warning.
+func loadContentRules() (*contentfilter.Rules, error) {
+	c := configure.Content
+	rules := &contentfilter.Rules{MaxLength: c.MaxLength}
+	if rules.MaxLength == 0 {
+		rules.MaxLength = 3000
+	}
+
+	var err error
+	if rules.LengthAction, err = contentfilter.ParseAction(c.MaxLengthAction, contentfilter.Block); err != nil {
+		return nil, err
+	}
+	if rules.ProfanityAction, err = contentfilter.ParseAction(c.ProfanityAction, contentfilter.Block); err != nil {
+		return nil, err
+	}
+	if rules.PIIAction, err = contentfilter.ParseAction(c.PIIAction, contentfilter.Warn); err != nil {
+		return nil, err
+	}
+
+	if c.WordsFile != "" {
+		if rules.Words, err = contentfilter.LoadWords(c.WordsFile); err != nil {
+			return nil, err
+		}
+	} else {
+		rules.Words = contentfilter.DefaultWords()
+	}
+	for _, w := range c.ExtraWords {
+		rules.Words[strings.ToLower(w)] = true
+	}
+	for _, w := range c.AllowedWords {
+		delete(rules.Words, strings.ToLower(w))
+	}
+	return rules, nil
+}
+
+// contentAckKey is the private_metadata field of a view recording the
+// text its author was warned about, so submitting the same text again
+// goes through.
+const contentAckKey = "content_ack"
+
+// contentWarningsBlockID is the block listing the warnings in a view.
+const contentWarningsBlockID = "content_warnings"
+
+// checkContent runs the content rules over the text answers of a
+// submitted feedback modal. Problems are reported inline on the block of
+// the question they were found in. Blocking rules always reject the
+// submission; warnings are shown above the form once, and the same text
+// goes through when it is submitted again. It returns the warnings that
+// were let through, or false if it has responded to the submission.
+func checkContent(w http.ResponseWriter, callback slack.InteractionCallback, answers []storage.Answer) ([]string, bool) {
+	errs := make(map[string]string)
+	warned := make(map[string]bool)
+	var warnings []string
+	blocked := false
+	digest := sha256.New()
+
+	for _, a := range answers {
+		if a.Type != reviewtemplate.Text {
+			continue
+		}
+		digest.Write([]byte(a.QuestionID + "\x00" + a.Text + "\x00"))
+
+		var blocking, warning []string
+		for _, f := range contentRules.Check(a.Text) {
+			if f.Action == contentfilter.Block {
+				blocking = append(blocking, f.Message)
+			} else {
+				warning = append(warning, f.Message)
+				if !warned[f.Rule] {
+					warned[f.Rule] = true
+					warnings = append(warnings, f.Rule)
+				}
+			}
+		}
+
+		switch {
+		case len(blocking) > 0:
+			errs[a.QuestionID] = strings.Join(blocking, " ")
+			blocked = true
+		case len(warning) > 0:
+			errs[a.QuestionID] = strings.Join(warning, " ") + " Submit again to send it anyway."
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, true
+	}
+	if blocked {
+		respondViewSubmission(w, slack.NewErrorsViewSubmissionResponse(errs))
+		return nil, false
+	}
+
+	ack := hex.EncodeToString(digest.Sum(nil))
+	metadata := make(map[string]interface{})
+	if callback.View.PrivateMetadata != "" {
+		if err := json.Unmarshal([]byte(callback.View.PrivateMetadata), &metadata); err != nil {
+			log.Printf("Could not parse view metadata: %v", err)
+			http.Error(w, "Could not parse modal metadata", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	if metadata[contentAckKey] == ack {
+		return warnings, true
+	}
+
+	// Errors cannot change the view's metadata, so the view is updated
+	// with the warnings instead. Slack keeps what was typed into it.
+	metadata[contentAckKey] = ack
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		log.Printf("Error encoding view metadata: %v", err)
+		http.Error(w, "Failed to encode modal metadata", http.StatusInternalServerError)
+		return nil, false
+	}
+	respondViewSubmission(w, slack.NewUpdateViewSubmissionResponse(warnedView(callback.View, string(data), errs)))
+	return nil, false
+}
+
+// warnedView is view with metadata and, above its blocks, the warnings
+// about the questions in errs.
+func warnedView(view slack.View, metadata string, errs map[string]string) *slack.ModalViewRequest {
+	var lines []string
+	blocks := []slack.Block{nil}
+	for _, b := range view.Blocks.BlockSet {
+		if c, ok := b.(*slack.ContextBlock); ok && c.BlockID == contentWarningsBlockID {
+			continue
+		}
+		blocks = append(blocks, b)
+		if input, ok := b.(*slack.InputBlock); ok && errs[input.BlockID] != "" {
+			lines = append(lines, fmt.Sprintf("*%s:* %s", input.Label.Text, errs[input.BlockID]))
+		}
+	}
+	blocks[0] = slack.NewContextBlock(contentWarningsBlockID, slack.NewTextBlockObject("mrkdwn", ":warning: "+strings.Join(lines, "\n"), false, false))
+
+	return &slack.ModalViewRequest{
+		Type:            view.Type,
+		Title:           view.Title,
+		Blocks:          slack.Blocks{BlockSet: blocks},
+		Close:           view.Close,
+		Submit:          view.Submit,
+		PrivateMetadata: metadata,
+		CallbackID:      view.CallbackID,
+		ClearOnClose:    view.ClearOnClose,
+		NotifyOnClose:   view.NotifyOnClose,
+		ExternalID:      view.ExternalID,
+	}
+}
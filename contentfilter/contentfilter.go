@@ -0,0 +1,178 @@
+// Package contentfilter checks free text for profanity, personal
+// information and excessive length before it is stored.
+package contentfilter
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed words.txt
+var defaultWords string
+
+// Action is what happens when a rule matches.
+type Action string
+
+const (
+	Off   Action = "off"
+	Warn  Action = "warn"
+	Block Action = "block"
+)
+
+// ParseAction reads an action from config, using def for an empty value.
+func ParseAction(s string, def Action) (Action, error) {
+	switch a := Action(strings.ToLower(s)); a {
+	case "":
+		return def, nil
+	case Off, Warn, Block:
+		return a, nil
+	default:
+		return "", fmt.Errorf("unknown action %q, want off, warn or block", s)
+	}
+}
+
+// Rule names, as reported in findings.
+const (
+	RuleLength    = "length"
+	RuleProfanity = "profanity"
+	RulePII       = "pii"
+)
+
+// Rules is a configured set of checks.
+type Rules struct {
+	MaxLength       int
+	LengthAction    Action
+	Words           map[string]bool
+	ProfanityAction Action
+	PIIAction       Action
+}
+
+// Finding is one rule that matched.
+type Finding struct {
+	Rule    string
+	Action  Action
+	Message string
+}
+
+// DefaultWords returns the bundled word list.
+func DefaultWords() map[string]bool {
+	words, err := ParseWords(strings.NewReader(defaultWords))
+	if err != nil {
+		panic(fmt.Sprintf("bundled word list is invalid: %v", err))
+	}
+	return words
+}
+
+// LoadWords reads a word list file.
+func LoadWords(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseWords(f)
+}
+
+// ParseWords reads one lowercase word per line, ignoring blank lines and
+// lines starting with #.
+func ParseWords(r io.Reader) (map[string]bool, error) {
+	words := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		words[word] = true
+	}
+	return words, scanner.Err()
+}
+
+var (
+	emailPattern = regexp.MustCompile(`(?i)[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}`)
+	// numberPattern finds runs of digits that may be split by spaces,
+	// dashes, dots or brackets, as phone and card numbers are written.
+	numberPattern = regexp.MustCompile(`\+?\(?\d[\d\s().-]{6,}\d`)
+)
+
+// Check runs every enabled rule against text.
+func (r *Rules) Check(text string) []Finding {
+	var findings []Finding
+
+	if r.LengthAction != Off && r.MaxLength > 0 {
+		if n := utf8.RuneCountInString(text); n > r.MaxLength {
+			findings = append(findings, Finding{RuleLength, r.LengthAction,
+				fmt.Sprintf("Please keep this under %d characters (it is %d).", r.MaxLength, n)})
+		}
+	}
+
+	if r.ProfanityAction != Off {
+		words := strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+			return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+		})
+		for _, w := range words {
+			if r.Words[w] {
+				findings = append(findings, Finding{RuleProfanity, r.ProfanityAction,
+					"Please keep feedback professional and remove offensive language."})
+				break
+			}
+		}
+	}
+
+	if r.PIIAction != Off {
+		if kind := personalInfo(text); kind != "" {
+			findings = append(findings, Finding{RulePII, r.PIIAction,
+				fmt.Sprintf("This looks like it contains %s. Please leave out personal information.", kind)})
+		}
+	}
+
+	return findings
+}
+
+// personalInfo names the first kind of personal information found in
+// text, or returns "".
+func personalInfo(text string) string {
+	if emailPattern.MatchString(text) {
+		return "an email address"
+	}
+	for _, match := range numberPattern.FindAllString(text, -1) {
+		digits := strings.Map(func(c rune) rune {
+			if c >= '0' && c <= '9' {
+				return c
+			}
+			return -1
+		}, match)
+		switch {
+		case len(digits) >= 13 && len(digits) <= 19 && luhn(digits):
+			return "a card number"
+		case len(digits) >= 10 && len(digits) <= 15:
+			return "a phone number"
+		}
+	}
+	return ""
+}
+
+// luhn reports whether digits pass the Luhn checksum used by card numbers.
+func luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
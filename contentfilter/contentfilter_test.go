@@ -0,0 +1,95 @@
+package contentfilter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAction(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Action
+		wantErr bool
+	}{
+		{"", Warn, false},
+		{"off", Off, false},
+		{"Warn", Warn, false},
+		{"BLOCK", Block, false},
+		{"reject", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAction(tt.in, Warn)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseAction(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseWords(t *testing.T) {
+	words, err := ParseWords(strings.NewReader("# comment\n\nDarn\n  heck  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]bool{"darn": true, "heck": true}; !reflect.DeepEqual(words, want) {
+		t.Fatalf("ParseWords = %v, want %v", words, want)
+	}
+	if !DefaultWords()["bullshit"] {
+		t.Fatal("bundled word list is missing an entry")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	rules := &Rules{
+		MaxLength:       40,
+		LengthAction:    Block,
+		Words:           map[string]bool{"heck": true},
+		ProfanityAction: Warn,
+		PIIAction:       Warn,
+	}
+
+	tests := []struct {
+		name  string
+		rules *Rules
+		text  string
+		want  []string
+	}{
+		{"clean", rules, "Great work on the launch.", nil},
+		{"too long", rules, strings.Repeat("a", 41), []string{RuleLength}},
+		{"counts runes", rules, strings.Repeat("é", 40), nil},
+		{"profanity", rules, "What the HECK, team?", []string{RuleProfanity}},
+		{"word inside another", rules, "Checked the heckle.", nil},
+		{"email", rules, "Mail me at jo.smith@example.com", []string{RulePII}},
+		{"phone", rules, "Call +1 (555) 123-4567", []string{RulePII}},
+		{"card", rules, "Card 4111 1111 1111 1111", []string{RulePII}},
+		{"card failing luhn", rules, "Ref 4111 1111 1111 1112", nil},
+		{"date", rules, "Shipped on 2024-01-15.", nil},
+		{"several", rules, "heck, call me on 555-123-4567 about it all", []string{RuleLength, RuleProfanity, RulePII}},
+		{"rules off", &Rules{MaxLength: 1, LengthAction: Off, Words: rules.Words, ProfanityAction: Off, PIIAction: Off}, "heck, 555-123-4567", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range tt.rules.Check(tt.text) {
+				got = append(got, f.Rule)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Check(%q) rules = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckActions(t *testing.T) {
+	rules := &Rules{MaxLength: 5, LengthAction: Block, PIIAction: Warn}
+	findings := rules.Check("x@example.com")
+	want := []Action{Block, Warn}
+	if len(findings) != len(want) {
+		t.Fatalf("Check found %v, want %d findings", findings, len(want))
+	}
+	for i, f := range findings {
+		if f.Action != want[i] || f.Message == "" {
+			t.Errorf("finding %d = %+v, want action %s and a message", i, f, want[i])
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/google/uuid"
+	"github.com/slack-go/slack"
+)
+
+// cycleCallbackID identifies submissions of the new cycle modal.
+const cycleCallbackID = "cycle_modal"
+
+// cycleDateLayout is the format of cycle dates, as sent by date pickers.
+const cycleDateLayout = "2006-01-02"
+
+// cycleBounds returns when c opens and closes. The end date is inclusive,
+// so c closes at midnight UTC after it.
+func cycleBounds(c storage.Cycle) (start, end time.Time, err error) {
+	start, err = time.Parse(cycleDateLayout, c.StartDate)
+	if err != nil {
+		return start, end, fmt.Errorf("cycle %s has invalid start date: %w", c.CycleID, err)
+	}
+	end, err = time.Parse(cycleDateLayout, c.EndDate)
+	if err != nil {
+		return start, end, fmt.Errorf("cycle %s has invalid end date: %w", c.CycleID, err)
+	}
+	return start, end.AddDate(0, 0, 1), nil
+}
+
+// cycleOpen reports whether c accepts submissions at now.
+func cycleOpen(c storage.Cycle, now time.Time) bool {
+	start, end, err := cycleBounds(c)
+	if err != nil {
+		log.Printf("%v", err)
+		return false
+	}
+	return !now.Before(start) && now.Before(end)
+}
+
+// activeCycle returns the open cycle of teamID, or nil if there is none.
+func activeCycle(ctx context.Context, teamID string) (*storage.Cycle, error) {
+	cycles, err := store.ListCycles(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, c := range cycles {
+		if cycleOpen(c, now) {
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+// isParticipant reports whether userID takes part in c.
+func isParticipant(c storage.Cycle, userID string) bool {
+	for _, id := range c.Participants {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// cycleProgress counts how many of the other participants of c userID has
+// reviewed in it.
+func cycleProgress(ctx context.Context, c storage.Cycle, userID string) (done, total int, err error) {
+	expected := make(map[string]bool)
+	for _, id := range c.Participants {
+		if id != userID {
+			expected[id] = true
+		}
+	}
+
+	reviewed := make(map[string]bool)
+	q := viewerQuery(ctx, c.TeamID, userID)
+	q.AuthorID = userID
+	q.AuthorHash = reviewerHash(c.TeamID, userID)
+	q.CycleID = c.CycleID
+	q.Limit = 100
+	for {
+		page, err := store.QueryReviews(ctx, q)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, r := range page.Reviews {
+			if expected[r.RevieweeID] {
+				reviewed[r.RevieweeID] = true
+			}
+		}
+		if page.Next == "" {
+			break
+		}
+		q.Cursor = page.Next
+	}
+
+	return len(reviewed), len(expected), nil
+}
+
+// cycleHomeData describes the active cycle of teamID to userID: its
+// deadline and, for participants, their progress. It is nil if no cycle
+// is open.
+func cycleHomeData(ctx context.Context, teamID, userID string) *homeCycle {
+	cycle, err := activeCycle(ctx, teamID)
+	if err != nil {
+		log.Printf("Error loading active cycle of team %s: %v", teamID, err)
+	}
+	if cycle == nil {
+		return nil
+	}
+
+	_, end, _ := cycleBounds(*cycle)
+	data := &homeCycle{Name: cycle.Name, EndDate: cycle.EndDate, Closes: end.Add(-time.Second).Unix()}
+	if isParticipant(*cycle, userID) {
+		done, total, err := cycleProgress(ctx, *cycle, userID)
+		if err != nil {
+			log.Printf("Error computing progress in cycle %s: %v", cycle.CycleID, err)
+		} else {
+			data.Participant = true
+			data.Reviewed = done
+			data.Participants = total
+		}
+	}
+	return data
+}
+
+// cycleView is the data of slackViews/cycle.json.
+type cycleView struct {
+	Today           string
+	Templates       []cycleTemplate
+	DefaultTemplate string
+}
+
+type cycleTemplate struct {
+	ID   string
+	Name string
+}
+
+// cycleModal is the form admins create a review cycle with.
+func cycleModal() slack.ModalViewRequest {
+	data := cycleView{
+		Today:           time.Now().UTC().Format(cycleDateLayout),
+		DefaultTemplate: defaultTemplateID(),
+	}
+	for _, id := range reviewTemplates.IDs() {
+		data.Templates = append(data.Templates, cycleTemplate{ID: id, Name: reviewTemplates.Latest(id).Name})
+	}
+	return renderForm("cycle", data, cycleCallbackID, "", false)
+}
+
+// openCycleModal opens the new cycle modal for admins.
+func openCycleModal(w http.ResponseWriter, client *slack.Client, callback slack.InteractionCallback) {
+	if !hasRole(context.TODO(), callback.Team.ID, callback.User.ID, roleAdmin) {
+		log.Printf("User %s is not allowed to create cycles", callback.User.ID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if _, err := client.OpenView(callback.TriggerID, cycleModal()); err != nil {
+		log.Printf("Error opening cycle modal: %v", err)
+		http.Error(w, "Failed to open modal", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// submitCycle validates and stores a submitted cycle modal. Cycles of a
+// team may not overlap, so there is at most one active cycle.
+func submitCycle(w http.ResponseWriter, callback slack.InteractionCallback) {
+	teamID := callback.Team.ID
+	userID := callback.User.ID
+	if !hasRole(context.TODO(), teamID, userID, roleAdmin) {
+		respondViewSubmission(w, slack.NewUpdateViewSubmissionResponse(noticeModal("Not allowed", "Only admins can create review cycles.")))
+		return
+	}
+
+	values := callback.View.State.Values
+	cycle := storage.Cycle{
+		TeamID:       teamID,
+		CycleID:      uuid.New().String(),
+		Name:         values["cycle_name"]["cycle_name_input"].Value,
+		StartDate:    values["cycle_start"]["cycle_start_input"].SelectedDate,
+		EndDate:      values["cycle_end"]["cycle_end_input"].SelectedDate,
+		Participants: values["cycle_participants"]["cycle_participants_input"].SelectedUsers,
+		TemplateID:   values["cycle_template"]["cycle_template_input"].SelectedOption.Value,
+		CreatedBy:    userID,
+		CreatedAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+
+	errs := make(map[string]string)
+	start, end, err := cycleBounds(cycle)
+	switch {
+	case err != nil:
+		errs["cycle_end"] = "Choose a start and end date."
+	case !end.After(start):
+		errs["cycle_end"] = "The end date must not be before the start date."
+	case !end.After(time.Now()):
+		errs["cycle_end"] = "The end date has already passed."
+	}
+	if len(cycle.Participants) < 2 {
+		errs["cycle_participants"] = "Choose at least two participants."
+	}
+	if reviewTemplates.Latest(cycle.TemplateID) == nil {
+		errs["cycle_template"] = "Choose a template."
+	}
+
+	ctx := context.TODO()
+	if len(errs) == 0 {
+		existing, err := store.ListCycles(ctx, teamID)
+		if err != nil {
+			log.Printf("Error listing cycles of team %s: %v", teamID, err)
+			http.Error(w, "Failed to list cycles", http.StatusInternalServerError)
+			return
+		}
+		for _, c := range existing {
+			if cs, ce, err := cycleBounds(c); err == nil && start.Before(ce) && cs.Before(end) {
+				errs["cycle_start"] = fmt.Sprintf("Overlaps with %s (%s to %s).", c.Name, c.StartDate, c.EndDate)
+				break
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		respondViewSubmission(w, slack.NewErrorsViewSubmissionResponse(errs))
+		return
+	}
+
+	if err := store.PutCycle(ctx, &cycle); err != nil {
+		log.Printf("Error storing cycle: %v", err)
+		http.Error(w, "Failed to store cycle", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %s created cycle %s (%s to %s) in team %s", userID, cycle.CycleID, cycle.StartDate, cycle.EndDate, teamID)
+
+	go PublishHomePage(teamID, userID, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("{}"))
+}
+
+// cycleClosed reports whether cycleID names a cycle that no longer accepts
+// submissions, and if so responds to the view submission saying so.
+func cycleClosed(w http.ResponseWriter, teamID, cycleID string) bool {
+	if cycleID == "" {
+		return false
+	}
+
+	cycle, err := store.GetCycle(context.TODO(), teamID, cycleID)
+	if err != nil {
+		log.Printf("Error loading cycle %s: %v", cycleID, err)
+		http.Error(w, "Failed to load cycle", http.StatusInternalServerError)
+		return true
+	}
+	if cycleOpen(*cycle, time.Now()) {
+		return false
+	}
+
+	msg := fmt.Sprintf("The %s review cycle closed on %s, so this review can no longer be submitted or changed.", cycle.Name, cycle.EndDate)
+	respondViewSubmission(w, slack.NewUpdateViewSubmissionResponse(noticeModal("Cycle closed", msg)))
+	return true
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/google/uuid"
+	"github.com/slack-go/slack"
+)
+
+// defaultDraftTTL applies when drafts.TTL is not set.
+const defaultDraftTTL = 7 * 24 * time.Hour
+
+// maxHomeDrafts is how many drafts the home tab offers to resume.
+const maxHomeDrafts = 5
+
+func draftTTL() time.Duration {
+	if configure.Drafts.TTL == "" {
+		return defaultDraftTTL
+	}
+	d, err := time.ParseDuration(configure.Drafts.TTL)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid drafts.TTL %q, using %s", configure.Drafts.TTL, defaultDraftTTL)
+		return defaultDraftTTL
+	}
+	return d
+}
+
+// saveDraft stores what was typed into a feedback modal the user closed.
+// Edits of submitted reviews and untouched forms are not drafted. A form
+// resumed from a draft replaces that draft.
+func saveDraft(w http.ResponseWriter, callback slack.InteractionCallback) {
+	// Slack does not expect a body for view_closed.
+	w.WriteHeader(http.StatusOK)
+
+	var metadata feedbackMetadata
+	if err := json.Unmarshal([]byte(callback.View.PrivateMetadata), &metadata); err != nil {
+		log.Printf("Could not parse feedback modal metadata: %v", err)
+		return
+	}
+	if metadata.SubmissionID != "" {
+		return
+	}
+
+	values := callback.View.State.Values
+	template := formTemplate(metadata)
+	answers := template.Answers(values)
+	reviewee := values["employee_select"]["employee_select_action"].SelectedOption
+	if len(answers) == 0 && reviewee.Value == "" {
+		return
+	}
+
+	draft := &storage.Draft{
+		UserID:          callback.User.ID,
+		DraftID:         metadata.DraftID,
+		TeamID:          callback.Team.ID,
+		RevieweeID:      reviewee.Value,
+		CycleID:         metadata.CycleID,
+		TemplateID:      template.ID,
+		TemplateVersion: template.Version,
+		FeedbackType:    metadata.FeedbackType,
+		Answers:         answers,
+		Anonymous:       submittedAnonymously(values),
+	}
+	if reviewee.Text != nil {
+		draft.RevieweeName = reviewee.Text.Text
+	}
+	storeDraft(draft)
+}
+
+// storeDraft saves draft until the draft TTL from now, assigning it an ID
+// if it has none, and refreshes the home tab of its author.
+func storeDraft(draft *storage.Draft) {
+	now := time.Now().UTC()
+	draft.UpdatedAt = now.Format(time.RFC3339)
+	draft.ExpiresAt = now.Add(draftTTL()).Unix()
+	if draft.DraftID == "" {
+		draft.DraftID = uuid.New().String()
+	}
+
+	if err := store.PutDraft(context.TODO(), draft); err != nil {
+		log.Printf("Error saving draft of %s: %v", draft.UserID, err)
+		return
+	}
+	log.Printf("Saved draft %s of %s", draft.DraftID, draft.UserID)
+
+	go PublishHomePage(draft.TeamID, draft.UserID, nil)
+}
+
+// discardDraft deletes draftID of userID once it has been submitted.
+func discardDraft(teamID, userID, draftID string) {
+	if draftID == "" {
+		return
+	}
+	if err := store.DeleteDraft(context.TODO(), userID, draftID); err != nil {
+		log.Printf("Error deleting draft %s of %s: %v", draftID, userID, err)
+		return
+	}
+	PublishHomePage(teamID, userID, nil)
+}
+
+// resumeDraft reopens the guided form prefilled from the draft named by
+// the button's value.
+func resumeDraft(w http.ResponseWriter, client *slack.Client, callback slack.InteractionCallback, action *slack.BlockAction) {
+	userID := callback.User.ID
+	draft, err := store.GetDraft(context.TODO(), userID, action.Value)
+	if errors.Is(err, storage.ErrNotFound) {
+		// The draft expired after the home tab was rendered.
+		go PublishHomePage(callback.Team.ID, userID, nil)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading draft %s of %s: %v", action.Value, userID, err)
+		http.Error(w, "Failed to load draft", http.StatusInternalServerError)
+		return
+	}
+
+	// Drafts resume in the guided form at the prompts step, or at the
+	// reviewee step if none was chosen.
+	openWizardAt(w, client, callback.TriggerID, wizardFirstStep(wizardState{
+		DraftID:         draft.DraftID,
+		CycleID:         draft.CycleID,
+		TemplateID:      draft.TemplateID,
+		TemplateVersion: draft.TemplateVersion,
+		RevieweeID:      draft.RevieweeID,
+		RevieweeName:    draft.RevieweeName,
+		Anonymous:       draft.Anonymous,
+		FeedbackType:    draft.FeedbackType,
+		Answers:         draft.Answers,
+	}))
+}
+
+// draftHomeData returns the most recent drafts of userID for the home
+// tab, and how many there are in all.
+func draftHomeData(ctx context.Context, userID string) ([]homeDraft, int) {
+	drafts, err := store.ListDrafts(ctx, userID)
+	if err != nil {
+		log.Printf("Error listing drafts of %s: %v", userID, err)
+		return nil, 0
+	}
+
+	count := len(drafts)
+	if len(drafts) > maxHomeDrafts {
+		drafts = drafts[:maxHomeDrafts]
+	}
+	var data []homeDraft
+	for _, d := range drafts {
+		entry := homeDraft{
+			DraftID:     d.DraftID,
+			Excerpt:     draftExcerpt(reviewFeedback(d.Answers)),
+			Expires:     d.ExpiresAt,
+			ExpiresDate: time.Unix(d.ExpiresAt, 0).UTC().Format(cycleDateLayout),
+		}
+		if d.RevieweeID != "" {
+			entry.Reviewee = fmt.Sprintf("<@%s>", d.RevieweeID)
+		}
+		data = append(data, entry)
+	}
+	return data, count
+}
+
+// draftExcerpt shortens feedback to one line for the home tab.
+func draftExcerpt(feedback string) string {
+	const max = 80
+	text := []rune(strings.Join(strings.Fields(feedback), " "))
+	if len(text) <= max {
+		return string(text)
+	}
+	return string(text[:max]) + "…"
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/slack-go/slack"
+)
+
+// deleteReviewCallbackID identifies submissions of the delete confirmation.
+const deleteReviewCallbackID = "delete_review_modal"
+
+// errNotAuthor is returned when someone tries to change a review they did
+// not write.
+var errNotAuthor = errors.New("review was written by someone else")
+
+// isAuthor reports whether userID wrote review, including anonymously.
+func isAuthor(review storage.Review, teamID, userID string) bool {
+	if review.UserID != "" {
+		return review.UserID == userID
+	}
+	return review.ReviewerHash != "" && review.ReviewerHash == reviewerHash(teamID, userID)
+}
+
+// loadOwnReview fetches a review and checks that userID wrote it. Every
+// edit and delete goes through here, so ownership does not depend on what
+// the client was shown.
+func loadOwnReview(ctx context.Context, teamID, userID, submissionID string) (*storage.Review, error) {
+	review, err := store.GetReview(ctx, submissionID)
+	if err != nil {
+		return nil, err
+	}
+	if review.TeamID != teamID {
+		return nil, fmt.Errorf("%w: review %s", storage.ErrNotFound, submissionID)
+	}
+	if !isAuthor(*review, teamID, userID) {
+		return nil, errNotAuthor
+	}
+	return review, nil
+}
+
+// ownReview loads a review for a view submission by callback.User. If the
+// review is gone or belongs to someone else it answers the submission with
+// an explanation and returns false.
+func ownReview(w http.ResponseWriter, callback slack.InteractionCallback, submissionID string) (*storage.Review, bool) {
+	review, err := loadOwnReview(context.TODO(), callback.Team.ID, callback.User.ID, submissionID)
+	switch {
+	case err == nil:
+		return review, true
+	case errors.Is(err, storage.ErrNotFound):
+		respondViewSubmission(w, slack.NewUpdateViewSubmissionResponse(noticeModal("Review not found", "This review no longer exists.")))
+	case errors.Is(err, errNotAuthor):
+		log.Printf("User %s tried to change review %s", callback.User.ID, submissionID)
+		respondViewSubmission(w, slack.NewUpdateViewSubmissionResponse(noticeModal("Not allowed", "You can only change reviews you wrote.")))
+	default:
+		log.Printf("Error loading review %s: %v", submissionID, err)
+		http.Error(w, "Failed to load review", http.StatusInternalServerError)
+	}
+	return nil, false
+}
+
+// reviewOverflow is the Edit/Delete menu shown next to reviews the viewer
+// wrote.
+func reviewOverflow(review storage.Review) *slack.Accessory {
+	edit := slack.NewOptionBlockObject("edit:"+review.SubmissionID, slack.NewTextBlockObject("plain_text", "Edit", false, false), nil)
+	del := slack.NewOptionBlockObject("delete:"+review.SubmissionID, slack.NewTextBlockObject("plain_text", "Delete", false, false), nil)
+	return slack.NewAccessory(slack.NewOverflowBlockElement("review_overflow_action", edit, del))
+}
+
+// handleReviewOverflow opens the edit form or the delete confirmation for
+// the review picked from a reviewOverflow menu.
+func handleReviewOverflow(w http.ResponseWriter, client *slack.Client, callback slack.InteractionCallback, action *slack.BlockAction) {
+	verb, submissionID, _ := strings.Cut(action.SelectedOption.Value, ":")
+
+	review, err := loadOwnReview(context.TODO(), callback.Team.ID, callback.User.ID, submissionID)
+	if err != nil {
+		log.Printf("User %s cannot change review %s: %v", callback.User.ID, submissionID, err)
+		http.Error(w, "Review not available", http.StatusForbidden)
+		return
+	}
+
+	var modal slack.ModalViewRequest
+	switch verb {
+	case "edit":
+		// Reviews from before the roster have no reviewee ID, so they are
+		// edited from the reviewee step.
+		template := templateFor(review.TemplateID, review.TemplateVersion)
+		modal = *wizardFirstStep(wizardState{
+			SubmissionID:    review.SubmissionID,
+			CycleID:         review.CycleID,
+			TemplateID:      template.ID,
+			TemplateVersion: template.Version,
+			RevieweeID:      review.RevieweeID,
+			RevieweeName:    review.EmployeeSelected,
+			Anonymous:       review.Anonymous,
+			FeedbackType:    review.FeedbackType,
+			Answers:         reviewAnswers(*review),
+		})
+	case "delete":
+		modal = deleteReviewModal(*review)
+	default:
+		log.Printf("Unknown review action %q", verb)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if _, err := client.OpenView(callback.TriggerID, modal); err != nil {
+		log.Printf("Error opening modal: %v", err)
+		http.Error(w, "Failed to open modal", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteReviewModal asks the author to confirm deleting review.
+func deleteReviewModal(review storage.Review) slack.ModalViewRequest {
+	text := fmt.Sprintf("Delete your review of %s? This cannot be undone.\n\n>%s", revieweeLabel(review), strings.ReplaceAll(reviewBody(review), "\n", "\n>"))
+
+	return slack.ModalViewRequest{
+		Type:            "modal",
+		CallbackID:      deleteReviewCallbackID,
+		PrivateMetadata: review.SubmissionID,
+		Title:           slack.NewTextBlockObject("plain_text", "Delete Review", false, false),
+		Close:           slack.NewTextBlockObject("plain_text", "Cancel", false, false),
+		Submit:          slack.NewTextBlockObject("plain_text", "Delete", false, false),
+		Blocks: slack.Blocks{
+			BlockSet: []slack.Block{
+				slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", text, false, false), nil, nil),
+			},
+		},
+	}
+}
+
+// submitDeleteReview deletes the review confirmed in a deleteReviewModal.
+func submitDeleteReview(w http.ResponseWriter, callback slack.InteractionCallback) {
+	review, ok := ownReview(w, callback, callback.View.PrivateMetadata)
+	if !ok {
+		return
+	}
+
+	if err := store.DeleteReview(context.TODO(), review.SubmissionID); err != nil {
+		log.Printf("Error deleting review %s: %v", review.SubmissionID, err)
+		http.Error(w, "Failed to delete review", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Deleted review %s", review.SubmissionID)
+	recordReviewChange(review, nil)
+
+	go refreshReviews(callback.Team.ID, callback.User.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("{}"))
+}
+
+// refreshReviews republishes the newest page of reviews to userID's home
+// tab after one of them changed.
+func refreshReviews(teamID, userID string) {
+	page, err := fetchReviewPage(teamID, userID, "")
+	if err != nil {
+		log.Printf("Error fetching reviews: %v", err)
+		return
+	}
+	PublishHomePage(teamID, userID, page)
+}
+
+// noticeModal is a modal that only shows a message.
+func noticeModal(title, message string) *slack.ModalViewRequest {
+	view := renderModal("notice", noticeView{Title: title, Message: message}, title, message)
+	return &view
+}
+
+// respondViewSubmission answers a view_submission with a response_action.
+func respondViewSubmission(w http.ResponseWriter, resp *slack.ViewSubmissionResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error writing view submission response: %v", err)
+	}
+}
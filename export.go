@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+)
+
+// exportPageSize is how many reviews are read per query while exporting.
+const exportPageSize = 100
+
+// exportColumns is the CSV header. Columns are only ever appended so
+// existing consumers keep working.
+var exportColumns = []string{
+	"submission_id", "timestamp", "edited_at", "team_id", "cycle_id", "status",
+	"anonymous", "reviewer_id", "reviewer_name", "reviewee_id", "reviewee_name",
+	"template_id", "template_version", "feedback", "answers",
+}
+
+// exportRecord is one exported review. Its JSON fields match
+// exportColumns.
+type exportRecord struct {
+	SubmissionID    string           `json:"submission_id"`
+	Timestamp       string           `json:"timestamp"`
+	EditedAt        string           `json:"edited_at"`
+	TeamID          string           `json:"team_id"`
+	CycleID         string           `json:"cycle_id"`
+	Status          string           `json:"status"`
+	Anonymous       bool             `json:"anonymous"`
+	ReviewerID      string           `json:"reviewer_id"`
+	ReviewerName    string           `json:"reviewer_name"`
+	RevieweeID      string           `json:"reviewee_id"`
+	RevieweeName    string           `json:"reviewee_name"`
+	TemplateID      string           `json:"template_id"`
+	TemplateVersion int              `json:"template_version"`
+	Feedback        string           `json:"feedback"`
+	Answers         []storage.Answer `json:"answers"`
+}
+
+func newExportRecord(r storage.Review) exportRecord {
+	status := r.Status
+	if status == "" {
+		status = storage.StatusApproved
+	}
+	answers := reviewAnswers(r)
+	if answers == nil {
+		answers = []storage.Answer{}
+	}
+	return exportRecord{
+		SubmissionID:    r.SubmissionID,
+		Timestamp:       r.Timestamp,
+		EditedAt:        r.EditedAt,
+		TeamID:          r.TeamID,
+		CycleID:         r.CycleID,
+		Status:          status,
+		Anonymous:       r.Anonymous,
+		ReviewerID:      r.UserID,
+		ReviewerName:    r.UserName,
+		RevieweeID:      r.RevieweeID,
+		RevieweeName:    r.EmployeeSelected,
+		TemplateID:      r.TemplateID,
+		TemplateVersion: r.TemplateVersion,
+		Feedback:        r.Feedback,
+		Answers:         answers,
+	}
+}
+
+func (e exportRecord) csvRow() ([]string, error) {
+	answers, err := json.Marshal(e.Answers)
+	if err != nil {
+		return nil, err
+	}
+	version := ""
+	if e.TemplateVersion != 0 {
+		version = strconv.Itoa(e.TemplateVersion)
+	}
+	row := []string{
+		e.SubmissionID, e.Timestamp, e.EditedAt, e.TeamID, e.CycleID, e.Status,
+		strconv.FormatBool(e.Anonymous), e.ReviewerID, e.ReviewerName, e.RevieweeID, e.RevieweeName,
+		e.TemplateID, version, e.Feedback, string(answers),
+	}
+	for i, cell := range row {
+		row[i] = csvCell(cell)
+	}
+	return row, nil
+}
+
+// csvCell keeps spreadsheets from reading cell as a formula: one starting
+// with =, +, - or @ is prefixed with a quote.
+func csvCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// exportRequest is the format and filters of one export. From and To are
+// inclusive YYYY-MM-DD dates in UTC.
+type exportRequest struct {
+	Format     string
+	From       string
+	To         string
+	RevieweeID string
+	ReviewerID string
+	CycleID    string
+}
+
+// query builds the review query for e on behalf of userID, so the export
+// holds exactly the reviews they can see on the home tab.
+func (e exportRequest) query(ctx context.Context, teamID, userID string) (storage.ReviewQuery, error) {
+	if e.Format != "csv" && e.Format != "jsonl" {
+		return storage.ReviewQuery{}, fmt.Errorf("format must be csv or jsonl, not %q", e.Format)
+	}
+
+	q := viewerQuery(ctx, teamID, userID)
+	q.ApprovedOnly = true
+	q.Limit = exportPageSize
+	q.RevieweeID = e.RevieweeID
+	q.CycleID = e.CycleID
+	// Matching on the author ID never matches anonymous reviews, so they
+	// cannot be attributed by filtering.
+	q.AuthorID = e.ReviewerID
+
+	if e.From != "" {
+		from, err := time.Parse(cycleDateLayout, e.From)
+		if err != nil {
+			return q, fmt.Errorf("from must be YYYY-MM-DD: %w", err)
+		}
+		q.Since = from.Format(time.RFC3339)
+	}
+	if e.To != "" {
+		to, err := time.Parse(cycleDateLayout, e.To)
+		if err != nil {
+			return q, fmt.Errorf("to must be YYYY-MM-DD: %w", err)
+		}
+		q.Until = to.AddDate(0, 0, 1).Format(time.RFC3339)
+	}
+	return q, nil
+}
+
+// exportReviews writes every review matching q to w, newest first, one
+// page at a time. flush, if not nil, is called after each page.
+func exportReviews(ctx context.Context, w io.Writer, format string, q storage.ReviewQuery, flush func()) (int, error) {
+	var writeRecord func(exportRecord) error
+	var csvWriter *csv.Writer
+	if format == "csv" {
+		csvWriter = csv.NewWriter(w)
+		if err := csvWriter.Write(exportColumns); err != nil {
+			return 0, err
+		}
+		writeRecord = func(e exportRecord) error {
+			row, err := e.csvRow()
+			if err != nil {
+				return err
+			}
+			return csvWriter.Write(row)
+		}
+	} else {
+		encoder := json.NewEncoder(w)
+		writeRecord = func(e exportRecord) error { return encoder.Encode(e) }
+	}
+
+	count := 0
+	for {
+		page, err := store.QueryReviews(ctx, q)
+		if err != nil {
+			return count, err
+		}
+		for _, r := range page.Reviews {
+			if err := writeRecord(newExportRecord(r)); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return count, err
+			}
+		}
+		if flush != nil {
+			flush()
+		}
+
+		if page.Next == "" {
+			return count, nil
+		}
+		q.Cursor = page.Next
+	}
+}
+
+// exportCaller returns the team and user the request's bearer token acts
+// as.
+func exportCaller(r *http.Request) (teamID, userID string, ok bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		return "", "", false
+	}
+	for _, t := range configure.Export.Tokens {
+		if t.Token != "" && subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return t.TeamID, t.UserID, true
+		}
+	}
+	return "", "", false
+}
+
+// ExportHandler streams the reviews visible to the caller as CSV or JSON
+// Lines. Filters are the query parameters format, from, to, reviewee,
+// reviewer and cycle.
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	teamID, userID, ok := exportCaller(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	params := r.URL.Query()
+	req := exportRequest{
+		Format:     params.Get("format"),
+		From:       params.Get("from"),
+		To:         params.Get("to"),
+		RevieweeID: params.Get("reviewee"),
+		ReviewerID: params.Get("reviewer"),
+		CycleID:    params.Get("cycle"),
+	}
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+
+	q, err := req.query(r.Context(), teamID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="reviews.csv"`)
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="reviews.jsonl"`)
+	}
+
+	var flush func()
+	if f, ok := w.(http.Flusher); ok {
+		flush = f.Flush
+	}
+
+	// Once streaming has started the status cannot change, so a failure
+	// part way leaves a truncated file and a log entry.
+	count, err := exportReviews(r.Context(), w, req.Format, q, flush)
+	if err != nil {
+		log.Printf("Export for %s in team %s failed after %d reviews: %v", userID, teamID, count, err)
+		return
+	}
+	log.Printf("Exported %d reviews for %s in team %s", count, userID, teamID)
+}
+
+// runExport is the export subcommand. It writes to standard output what
+// ExportHandler would return to the given user.
+func runExport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	teamID := flags.String("team", "", "team ID to export from (required)")
+	userID := flags.String("user", "", "user ID whose visibility applies (required)")
+	var req exportRequest
+	flags.StringVar(&req.Format, "format", "csv", "csv or jsonl")
+	flags.StringVar(&req.From, "from", "", "first day to include, YYYY-MM-DD")
+	flags.StringVar(&req.To, "to", "", "last day to include, YYYY-MM-DD")
+	flags.StringVar(&req.RevieweeID, "reviewee", "", "only reviews about this user ID")
+	flags.StringVar(&req.ReviewerID, "reviewer", "", "only reviews by this user ID")
+	flags.StringVar(&req.CycleID, "cycle", "", "only reviews in this cycle")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *teamID == "" || *userID == "" {
+		return fmt.Errorf("-team and -user are required")
+	}
+
+	q, err := req.query(ctx, *teamID, *userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := exportReviews(ctx, os.Stdout, req.Format, q, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d reviews\n", count)
+	return nil
+}
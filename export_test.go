@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+)
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"Great work", "Great work"},
+		{"=SUM(A1:A2)", "'=SUM(A1:A2)"},
+		{"+1 555", "'+1 555"},
+		{"-10", "'-10"},
+		{"@mention", "'@mention"},
+		{"a=b", "a=b"},
+		{" =x", " =x"},
+	}
+	for _, tt := range tests {
+		if got := csvCell(tt.in); got != tt.want {
+			t.Errorf("csvCell(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// exportStore puts reviews in a memory store for the length of the test.
+func exportStore(t *testing.T, reviews ...storage.Review) {
+	t.Helper()
+	previous := store
+	t.Cleanup(func() { store = previous })
+
+	memory := storage.NewMemoryStore()
+	for i := range reviews {
+		if err := memory.PutReview(context.Background(), &reviews[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store = memory
+}
+
+var exportSamples = []storage.Review{
+	{
+		SubmissionID: "S1", TeamID: "T1", Timestamp: "2024-01-01T00:00:00Z",
+		UserID: "U1", UserName: "ann", RevieweeID: "U2", EmployeeSelected: "Bob",
+		Feedback: "=HYPERLINK(\"x\")",
+	},
+	{
+		SubmissionID: "S2", TeamID: "T1", Timestamp: "2024-01-02T00:00:00Z",
+		Anonymous: true, ReviewerHash: "H1", RevieweeID: "U2", EmployeeSelected: "Bob",
+		TemplateID: "tpl", TemplateVersion: 2, Status: storage.StatusApproved,
+		Answers: []storage.Answer{{QuestionID: "q1", Type: "text", Label: "Went well", Text: "Demos, \"launch\""}},
+	},
+	{
+		SubmissionID: "S3", TeamID: "T1", Timestamp: "2024-01-03T00:00:00Z", EditedAt: "2024-01-04T00:00:00Z",
+		UserID: "U2", UserName: "bob", RevieweeID: "U1", EmployeeSelected: "Ann",
+		Feedback: "Line one\nline two",
+	},
+}
+
+func TestExportCSV(t *testing.T) {
+	exportStore(t, exportSamples...)
+
+	var buf bytes.Buffer
+	n, err := exportReviews(context.Background(), &buf, "csv", storage.ReviewQuery{TeamID: "T1", Limit: 2}, nil)
+	if err != nil || n != len(exportSamples) {
+		t.Fatalf("exportReviews = %d, %v; want %d reviews", n, err, len(exportSamples))
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("export is not valid CSV: %v", err)
+	}
+	if len(rows) != len(exportSamples)+1 {
+		t.Fatalf("export has %d rows, want a header and %d reviews", len(rows), len(exportSamples))
+	}
+	if !reflect.DeepEqual(rows[0], exportColumns) {
+		t.Fatalf("header = %v, want %v", rows[0], exportColumns)
+	}
+
+	records := make(map[string]map[string]string)
+	for _, row := range rows[1:] {
+		if len(row) != len(exportColumns) {
+			t.Fatalf("row %v has %d cells, want %d", row, len(row), len(exportColumns))
+		}
+		record := make(map[string]string)
+		for i, column := range exportColumns {
+			record[column] = row[i]
+		}
+		records[record["submission_id"]] = record
+	}
+
+	tests := []struct {
+		id, column, want string
+	}{
+		{"S1", "status", storage.StatusApproved},
+		{"S1", "reviewer_name", "ann"},
+		{"S1", "reviewee_name", "Bob"},
+		{"S1", "template_version", ""},
+		{"S1", "feedback", "'=HYPERLINK(\"x\")"},
+		{"S2", "anonymous", "true"},
+		{"S2", "reviewer_id", ""},
+		{"S2", "template_version", "2"},
+		{"S2", "answers", `[{"question_id":"q1","type":"text","label":"Went well","text":"Demos, \"launch\""}]`},
+		{"S3", "edited_at", "2024-01-04T00:00:00Z"},
+		{"S3", "feedback", "Line one\nline two"},
+	}
+	for _, tt := range tests {
+		if got := records[tt.id][tt.column]; got != tt.want {
+			t.Errorf("%s %s = %q, want %q", tt.id, tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	exportStore(t, exportSamples...)
+
+	var buf bytes.Buffer
+	n, err := exportReviews(context.Background(), &buf, "jsonl", storage.ReviewQuery{TeamID: "T1", Limit: 2}, nil)
+	if err != nil || n != len(exportSamples) {
+		t.Fatalf("exportReviews = %d, %v; want %d reviews", n, err, len(exportSamples))
+	}
+
+	columns := append([]string(nil), exportColumns...)
+	sort.Strings(columns)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(exportSamples) {
+		t.Fatalf("export has %d lines, want %d", len(lines), len(exportSamples))
+	}
+	for _, line := range lines {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %q is not JSON: %v", line, err)
+		}
+		var keys []string
+		for k := range record {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, columns) {
+			t.Fatalf("fields = %v, want the CSV columns %v", keys, columns)
+		}
+		// Legacy reviews export their feedback as a single answer.
+		if answers, ok := record["answers"].([]interface{}); !ok || len(answers) != 1 {
+			t.Fatalf("answers of %v = %v, want one answer", record["submission_id"], record["answers"])
+		}
+		// JSON has no formulas to guard against.
+		if record["submission_id"] == "S1" && record["feedback"] != "=HYPERLINK(\"x\")" {
+			t.Fatalf("feedback = %q, want it unquoted", record["feedback"])
+		}
+	}
+}
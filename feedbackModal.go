@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/reviewtemplate"
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/slack-go/slack"
+)
+
+// feedbackCallbackID identifies submissions of the single feedback modal.
+// New reviews, edits and drafts all open the guided form now; the modal is
+// still accepted from clients that opened it before. Modals opened before
+// the callback ID was introduced have an empty one.
+const feedbackCallbackID = "feedback_modal"
+
+// feedbackMetadata is carried through the modal in private_metadata.
+type feedbackMetadata struct {
+	SubmissionID    string `json:"submission_id,omitempty"`
+	DraftID         string `json:"draft_id,omitempty"`
+	CycleID         string `json:"cycle_id,omitempty"`
+	TemplateID      string `json:"template_id,omitempty"`
+	TemplateVersion int    `json:"template_version,omitempty"`
+	FeedbackType    string `json:"feedback_type,omitempty"`
+}
+
+// formTemplate returns the template a feedback modal was built from.
+// Modals opened before templates carry no template and were the built-in
+// form, which the default template reads the same way.
+func formTemplate(metadata feedbackMetadata) *reviewtemplate.Template {
+	template := templateFor(metadata.TemplateID, metadata.TemplateVersion)
+	if metadata.TemplateID == "" {
+		template = reviewtemplate.Default
+	}
+	return promptTemplate(template, metadata.FeedbackType)
+}
+
+// submitFeedback stores a submitted feedback modal, either as a new review
+// or as an edit of the review named in its metadata.
+func submitFeedback(w http.ResponseWriter, client *slack.Client, callback slack.InteractionCallback) {
+	teamID := callback.Team.ID
+	userID := callback.User.ID
+	userName := callback.User.Name
+
+	var metadata feedbackMetadata
+	if callback.View.PrivateMetadata != "" {
+		if err := json.Unmarshal([]byte(callback.View.PrivateMetadata), &metadata); err != nil {
+			log.Printf("Could not parse feedback modal metadata: %v", err)
+			http.Error(w, "Could not parse modal metadata", http.StatusBadRequest)
+			return
+		}
+	}
+
+	values := callback.View.State.Values
+	template := formTemplate(metadata)
+	answers := template.Answers(values)
+
+	errs, reviewee, err := validateSubmission(context.TODO(), teamID, userID, values, answers, metadata.SubmissionID)
+	if err != nil {
+		log.Printf("Error validating feedback: %v", err)
+		http.Error(w, "Failed to validate feedback", http.StatusInternalServerError)
+		return
+	}
+	if len(errs) > 0 {
+		respondViewSubmission(w, slack.NewErrorsViewSubmissionResponse(errs))
+		return
+	}
+	revieweeID := reviewee.UserID
+	revieweeName := reviewee.Name
+
+	flags, ok := checkContent(w, callback, answers)
+	if !ok {
+		return
+	}
+
+	review := &storage.Review{
+		TeamID:           teamID,
+		UserID:           userID,
+		UserName:         userName,
+		EmployeeSelected: revieweeName,
+		RevieweeID:       revieweeID,
+		Feedback:         reviewFeedback(answers),
+		TemplateID:       template.ID,
+		TemplateVersion:  template.Version,
+		Answers:          answers,
+		FeedbackType:     metadata.FeedbackType,
+		CycleID:          metadata.CycleID,
+		ContentFlags:     flags,
+	}
+	scoreReview(review)
+	if submittedAnonymously(values) {
+		anonymize(review)
+	}
+
+	if metadata.SubmissionID != "" {
+		if !updateReview(w, callback, review, metadata.SubmissionID) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("{}"))
+		return
+	}
+
+	if cycleClosed(w, teamID, metadata.CycleID) {
+		return
+	}
+
+	message, err := createReview(review)
+	if err != nil {
+		log.Printf("Error storing survey data: %v", err)
+		http.Error(w, "Error storing data", http.StatusInternalServerError)
+		return
+	}
+	go discardDraft(teamID, userID, metadata.DraftID)
+
+	go func() {
+		if err := showSuccessModal(client, callback.TriggerID, message); err != nil {
+			log.Printf("Error showing success modal: %v", err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("{}"))
+}
+
+// updateReview stores review in place of submissionID, which the user
+// submitting callback must have written. If it cannot, it answers the
+// submission and returns false.
+func updateReview(w http.ResponseWriter, callback slack.InteractionCallback, review *storage.Review, submissionID string) bool {
+	existing, ok := ownReview(w, callback, submissionID)
+	if !ok {
+		return false
+	}
+	if cycleClosed(w, review.TeamID, existing.CycleID) {
+		return false
+	}
+	review.SubmissionID = existing.SubmissionID
+	review.CycleID = existing.CycleID
+	review.Timestamp = existing.Timestamp
+	review.EditedAt = time.Now().UTC().Format(time.RFC3339)
+	review.Revision = existing.Revision + 1
+	review.NegativeAlerted = existing.NegativeAlerted
+	// Edited reviews go back through moderation so approved text
+	// cannot be swapped out afterwards. Without moderation, an edit
+	// approves a review that was held or rejected before it was turned
+	// off.
+	review.Status = existing.Status
+	review.StatusHistory = existing.StatusHistory
+	if moderationEnabled() {
+		setStatus(review, storage.StatusPending, "", "")
+	} else if !existing.Approved() {
+		setStatus(review, storage.StatusApproved, "", "")
+	}
+
+	ok, err := store.ReplaceReview(context.TODO(), review, existing.Revision)
+	if err != nil {
+		log.Printf("Error updating review %s: %v", review.SubmissionID, err)
+		http.Error(w, "Error storing data", http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		respondViewSubmission(w, slack.NewUpdateViewSubmissionResponse(noticeModal("Review changed",
+			"This review changed while you were editing it, for example because it was moderated. Please open it again from `/review list`.")))
+		return false
+	}
+	log.Printf("Updated review %s", review.SubmissionID)
+	recordReviewChange(existing, review)
+	go checkNegativeRun(review.TeamID, review.RevieweeID)
+	if len(existing.ApprovalRequests) > 0 {
+		go withdrawEditedApprovalRequests(*existing, *review)
+	}
+
+	go refreshReviews(review.TeamID, callback.User.ID)
+	if review.Status == storage.StatusPending {
+		go requestApproval(review.TeamID, *review)
+	} else if !existing.Approved() {
+		go notifyReviewee(*review)
+	}
+	return true
+}
+
+// anonymize removes the author of review, keeping only their hash.
+func anonymize(review *storage.Review) {
+	review.ReviewerHash = reviewerHash(review.TeamID, review.UserID)
+	review.UserID = ""
+	review.UserName = ""
+	review.Anonymous = true
+}
+
+// createReview stores review as a new submission, holding it for approval
+// if moderation is enabled, and returns the message to thank its author
+// with.
+func createReview(review *storage.Review) (string, error) {
+	message := "Your feedback has been successfully submitted. Thank you!"
+	if moderationEnabled() {
+		setStatus(review, storage.StatusPending, "", "")
+		message = "Your feedback has been submitted and will be visible once it is approved. Thank you!"
+	}
+
+	if err := storeSurveyData(review); err != nil {
+		return "", err
+	}
+	// The reviewer and feedback are deliberately not logged so that
+	// anonymous reviews stay anonymous.
+	log.Printf("Stored review %s of %s", review.SubmissionID, review.RevieweeID)
+	recordReviewChange(nil, review)
+	go checkNegativeRun(review.TeamID, review.RevieweeID)
+
+	if review.Status == storage.StatusPending {
+		go requestApproval(review.TeamID, *review)
+	} else {
+		go notifyReviewee(*review)
+	}
+	return message, nil
+}
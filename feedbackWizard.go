@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/BigPhatNerd/cbaseSLACK/reviewtemplate"
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/google/uuid"
+	"github.com/slack-go/slack"
+)
+
+// Callback IDs of the steps of the guided feedback form. Each step is
+// pushed onto the one before it, so Back returns to the previous step.
+const (
+	wizardRevieweeCallbackID = "wizard_reviewee"
+	wizardTypeCallbackID     = "wizard_type"
+	wizardPromptsCallbackID  = "wizard_prompts"
+	wizardConfirmCallbackID  = "wizard_confirm"
+)
+
+// maxPrivateMetadata is the most Slack stores in a view's
+// private_metadata.
+const maxPrivateMetadata = 3000
+
+// wizardState is everything chosen in earlier steps, carried from view to
+// view in private_metadata.
+type wizardState struct {
+	DraftID         string           `json:"draft_id"`
+	CycleID         string           `json:"cycle_id,omitempty"`
+	TemplateID      string           `json:"template_id"`
+	TemplateVersion int              `json:"template_version"`
+	RevieweeID      string           `json:"reviewee_id,omitempty"`
+	RevieweeName    string           `json:"reviewee_name,omitempty"`
+	Anonymous       bool             `json:"anonymous,omitempty"`
+	FeedbackType    string           `json:"feedback_type,omitempty"`
+	Answers         []storage.Answer `json:"answers,omitempty"`
+	ContentFlags    []string         `json:"content_flags,omitempty"`
+	// SubmissionID is set when an existing review is being edited.
+	SubmissionID string `json:"submission_id,omitempty"`
+	// AskAnonymity is set when the form opened at the prompts step, which
+	// then asks whether the review is anonymous in place of the reviewee
+	// step.
+	AskAnonymity bool `json:"ask_anonymity,omitempty"`
+}
+
+// template returns the template of the prompts step.
+func (s wizardState) template() *reviewtemplate.Template {
+	return promptTemplate(templateFor(s.TemplateID, s.TemplateVersion), s.FeedbackType)
+}
+
+// newWizard starts the guided form for a new review in teamID. While a
+// review cycle is open, the review is written for it with the cycle's
+// template.
+func newWizard(ctx context.Context, teamID string) wizardState {
+	template := currentTemplate()
+	state := wizardState{DraftID: uuid.New().String()}
+
+	cycle, err := activeCycle(ctx, teamID)
+	if err != nil {
+		log.Printf("Error loading active cycle of team %s: %v", teamID, err)
+	}
+	if cycle != nil {
+		state.CycleID = cycle.CycleID
+		template = templateFor(cycle.TemplateID, 0)
+	}
+	state.TemplateID = template.ID
+	state.TemplateVersion = template.Version
+	return state
+}
+
+// wizardFirstStep is the step a form with state opens at: the prompts
+// step once the reviewee is known, or else the reviewee step.
+func wizardFirstStep(state wizardState) *slack.ModalViewRequest {
+	if state.RevieweeID == "" {
+		state.AskAnonymity = false
+		return wizardRevieweeStep(state)
+	}
+	state.AskAnonymity = true
+	return wizardPromptsStep(state)
+}
+
+// wizardStepView is the data of the slackViews/wizard*.json steps. Each
+// step uses the fields it shows.
+type wizardStepView struct {
+	RevieweeID   string
+	Anonymity    string
+	Anonymous    bool
+	FeedbackType string
+	Questions    []slack.Block
+	Body         string
+	Moderated    bool
+	// First is set on the step the form opened at.
+	First bool
+}
+
+// wizardStep renders the step with callbackID from the view name. Closing
+// the prompts and confirm steps saves a draft.
+func wizardStep(name, callbackID string, state wizardState, data wizardStepView) *slack.ModalViewRequest {
+	metadata, _ := json.Marshal(state)
+	notifyOnClose := callbackID == wizardPromptsCallbackID || callbackID == wizardConfirmCallbackID
+	view := renderForm(name, data, callbackID, string(metadata), notifyOnClose)
+	return &view
+}
+
+// wizardRevieweeStep asks who the review is about and, if allowed,
+// whether it is anonymous.
+func wizardRevieweeStep(state wizardState) *slack.ModalViewRequest {
+	return wizardStep("wizardReviewee", wizardRevieweeCallbackID, state, wizardStepView{
+		Anonymity: anonymityMode(),
+		Anonymous: state.Anonymous,
+	})
+}
+
+// wizardTypeStep asks what kind of feedback is being given.
+func wizardTypeStep(state wizardState) *slack.ModalViewRequest {
+	return wizardStep("wizardType", wizardTypeCallbackID, state, wizardStepView{
+		RevieweeID:   state.RevieweeID,
+		FeedbackType: state.FeedbackType,
+	})
+}
+
+// wizardPromptsStep asks the questions of the template, with the prompts
+// of the feedback type in place of its feedback question. The answers it
+// is prefilled with are read back from the submission, so they are left
+// out of its metadata.
+func wizardPromptsStep(state wizardState) *slack.ModalViewRequest {
+	data := wizardStepView{
+		RevieweeID: state.RevieweeID,
+		Questions:  state.template().Blocks(state.Answers),
+		First:      state.AskAnonymity,
+	}
+	state.Answers = nil
+	if state.AskAnonymity {
+		data.Anonymity = anonymityMode()
+		data.Anonymous = state.Anonymous
+	}
+	return wizardStep("wizardPrompts", wizardPromptsCallbackID, state, data)
+}
+
+// wizardConfirmStep shows the review as it will be submitted.
+func wizardConfirmStep(state wizardState) *slack.ModalViewRequest {
+	return wizardStep("wizardConfirm", wizardConfirmCallbackID, state, wizardStepView{
+		RevieweeID: state.RevieweeID,
+		Body:       reviewBody(storage.Review{Answers: state.Answers}),
+		Anonymous:  state.Anonymous,
+		Moderated:  moderationEnabled(),
+	})
+}
+
+// openWizard opens the first step of the guided form.
+func openWizard(w http.ResponseWriter, client *slack.Client, callback slack.InteractionCallback) {
+	openWizardAt(w, client, callback.TriggerID, wizardRevieweeStep(newWizard(context.TODO(), callback.Team.ID)))
+}
+
+// openWizardAt opens the guided form at view.
+func openWizardAt(w http.ResponseWriter, client *slack.Client, triggerID string, view *slack.ModalViewRequest) {
+	if _, err := client.OpenView(triggerID, *view); err != nil {
+		log.Printf("Error opening modal: %v", err)
+		http.Error(w, "Failed to open modal", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// submitWizardStep validates a step of the guided form and pushes the
+// next one. Submitting the last step stores the review and clears the
+// whole stack.
+func submitWizardStep(w http.ResponseWriter, client *slack.Client, callback slack.InteractionCallback) {
+	teamID := callback.Team.ID
+	userID := callback.User.ID
+	values := callback.View.State.Values
+
+	var state wizardState
+	if err := json.Unmarshal([]byte(callback.View.PrivateMetadata), &state); err != nil {
+		log.Printf("Could not parse feedback wizard metadata: %v", err)
+		http.Error(w, "Could not parse modal metadata", http.StatusBadRequest)
+		return
+	}
+
+	switch callback.View.CallbackID {
+	case wizardRevieweeCallbackID:
+		errs, reviewee, err := validateSubmission(context.TODO(), teamID, userID, values, nil, "")
+		if err != nil {
+			log.Printf("Error validating feedback: %v", err)
+			http.Error(w, "Failed to validate feedback", http.StatusInternalServerError)
+			return
+		}
+		if len(errs) > 0 {
+			respondViewSubmission(w, slack.NewErrorsViewSubmissionResponse(errs))
+			return
+		}
+		state.RevieweeID = reviewee.UserID
+		state.RevieweeName = reviewee.Name
+		state.Anonymous = submittedAnonymously(values)
+		respondViewSubmission(w, slack.NewPushViewSubmissionResponse(wizardTypeStep(state)))
+
+	case wizardTypeCallbackID:
+		state.FeedbackType = values["feedback_type"]["feedback_type_input"].SelectedOption.Value
+		if feedbackPrompts(state.FeedbackType) == nil {
+			respondViewSubmission(w, slack.NewErrorsViewSubmissionResponse(map[string]string{"feedback_type": "Choose a kind of feedback."}))
+			return
+		}
+		respondViewSubmission(w, slack.NewPushViewSubmissionResponse(wizardPromptsStep(state)))
+
+	case wizardPromptsCallbackID:
+		answers := state.template().Answers(values)
+		if errs := feedbackLengthErrors(answers); len(errs) > 0 {
+			respondViewSubmission(w, slack.NewErrorsViewSubmissionResponse(errs))
+			return
+		}
+		flags, ok := checkContent(w, callback, answers)
+		if !ok {
+			return
+		}
+		state.Answers = answers
+		state.ContentFlags = flags
+		if state.AskAnonymity {
+			state.Anonymous = submittedAnonymously(values)
+		}
+
+		next := wizardConfirmStep(state)
+		if len(next.PrivateMetadata) > maxPrivateMetadata {
+			respondViewSubmission(w, slack.NewErrorsViewSubmissionResponse(map[string]string{
+				longestAnswer(answers): "This is too long to submit. Please shorten it.",
+			}))
+			return
+		}
+		respondViewSubmission(w, slack.NewPushViewSubmissionResponse(next))
+
+	case wizardConfirmCallbackID:
+		// The roster and the author's other reviews may have changed since
+		// the reviewee was chosen.
+		problem, reviewee, err := validateReviewee(context.TODO(), teamID, userID, state.RevieweeID, state.SubmissionID)
+		if err != nil {
+			log.Printf("Error validating feedback: %v", err)
+			http.Error(w, "Failed to validate feedback", http.StatusInternalServerError)
+			return
+		}
+		if problem != "" {
+			respondViewSubmission(w, slack.NewUpdateViewSubmissionResponse(noticeModal("Cannot submit", problem)))
+			return
+		}
+		if state.SubmissionID == "" && cycleClosed(w, teamID, state.CycleID) {
+			return
+		}
+
+		review := &storage.Review{
+			TeamID:           teamID,
+			UserID:           userID,
+			UserName:         callback.User.Name,
+			EmployeeSelected: reviewee.Name,
+			RevieweeID:       state.RevieweeID,
+			Feedback:         reviewFeedback(state.Answers),
+			TemplateID:       state.TemplateID,
+			TemplateVersion:  state.TemplateVersion,
+			Answers:          state.Answers,
+			FeedbackType:     state.FeedbackType,
+			CycleID:          state.CycleID,
+			ContentFlags:     state.ContentFlags,
+		}
+		scoreReview(review)
+		if state.Anonymous {
+			anonymize(review)
+		}
+
+		if state.SubmissionID != "" {
+			if updateReview(w, callback, review, state.SubmissionID) {
+				respondViewSubmission(w, slack.NewClearViewSubmissionResponse())
+			}
+			return
+		}
+
+		message, err := createReview(review)
+		if err != nil {
+			log.Printf("Error storing survey data: %v", err)
+			http.Error(w, "Error storing data", http.StatusInternalServerError)
+			return
+		}
+		go discardDraft(teamID, userID, state.DraftID)
+
+		respondViewSubmission(w, slack.NewClearViewSubmissionResponse())
+		go func() {
+			if err := showSuccessModal(client, callback.TriggerID, message); err != nil {
+				log.Printf("Error showing success modal: %v", err)
+			}
+		}()
+	}
+}
+
+// longestAnswer returns the question ID of the longest text answer, which
+// is the block to report an oversized form on.
+func longestAnswer(answers []storage.Answer) string {
+	id, longest := "", -1
+	for _, a := range answers {
+		if a.Type == reviewtemplate.Text && len(a.Text) > longest {
+			id, longest = a.QuestionID, len(a.Text)
+		}
+	}
+	return id
+}
+
+// saveWizardDraft saves a draft when the guided form is closed on the
+// prompts or confirm step. Going Back from a pushed step is not closing
+// the form, and edits of submitted reviews are not drafted.
+func saveWizardDraft(w http.ResponseWriter, callback slack.InteractionCallback) {
+	w.WriteHeader(http.StatusOK)
+
+	var state wizardState
+	if err := json.Unmarshal([]byte(callback.View.PrivateMetadata), &state); err != nil {
+		log.Printf("Could not parse feedback wizard metadata: %v", err)
+		return
+	}
+	if state.SubmissionID != "" {
+		return
+	}
+	prompts := callback.View.CallbackID == wizardPromptsCallbackID
+	// Slack only reports the stack as cleared when it held more than one
+	// view, so closing a form that opened at the prompts step never is.
+	if !callback.IsCleared && !(prompts && state.AskAnonymity) {
+		return
+	}
+	if prompts {
+		state.Answers = state.template().Answers(callback.View.State.Values)
+		if state.AskAnonymity {
+			state.Anonymous = submittedAnonymously(callback.View.State.Values)
+		}
+	}
+
+	storeDraft(&storage.Draft{
+		UserID:          callback.User.ID,
+		DraftID:         state.DraftID,
+		TeamID:          callback.Team.ID,
+		RevieweeID:      state.RevieweeID,
+		RevieweeName:    state.RevieweeName,
+		CycleID:         state.CycleID,
+		TemplateID:      state.TemplateID,
+		TemplateVersion: state.TemplateVersion,
+		FeedbackType:    state.FeedbackType,
+		Answers:         state.Answers,
+		Anonymous:       state.Anonymous,
+	})
+}
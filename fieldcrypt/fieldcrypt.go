@@ -0,0 +1,261 @@
+// Package fieldcrypt implements envelope encryption for individual string
+// attributes. Values are sealed with AES-256-GCM data keys, and each data
+// key is wrapped by a KeyProvider (a local keyring or KMS).
+//
+// Sealed values are self-describing strings of the form
+//
+//	enc:v2:<key id>:<wrapped data key>:<nonce and ciphertext>
+//
+// so the key that protects a value is always stored next to it. Every
+// value is bound to a caller-chosen context, such as its table, record key
+// and attribute, so it cannot be copied into another record and still
+// open.
+//
+// To keep KMS round trips down, a data key seals many values for a short
+// while, and unwrapped data keys are cached for a short while.
+package fieldcrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const prefix = "enc:v2:"
+
+// A data key seals at most dataKeyUses values and is replaced after
+// dataKeyAge. Unwrapped data keys are kept for cacheAge, up to cacheSize
+// of them.
+const (
+	dataKeyUses = 10000
+	dataKeyAge  = 5 * time.Minute
+	cacheAge    = 15 * time.Minute
+	cacheSize   = 1000
+)
+
+// KeyProvider issues and unwraps data keys.
+type KeyProvider interface {
+	// NewDataKey returns a fresh 32 byte data key, its wrapped form, and
+	// the ID of the key that wrapped it.
+	NewDataKey(ctx context.Context) (keyID string, plaintext, wrapped []byte, err error)
+	// UnwrapDataKey recovers a data key wrapped under keyID.
+	UnwrapDataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Encrypter seals and opens field values. It satisfies storage.Cipher and
+// is safe for concurrent use.
+type Encrypter struct {
+	keys KeyProvider
+	now  func() time.Time
+
+	mu      sync.Mutex
+	current *dataKey
+	cache   map[string]cachedKey
+}
+
+// dataKey is the data key new values are sealed with.
+type dataKey struct {
+	keyID     string
+	plaintext []byte
+	// header is the part of a sealed value before the ciphertext.
+	header  string
+	uses    int
+	expires time.Time
+}
+
+type cachedKey struct {
+	plaintext []byte
+	expires   time.Time
+}
+
+// NewEncrypter returns an Encrypter that gets its data keys from keys.
+func NewEncrypter(keys KeyProvider) *Encrypter {
+	return &Encrypter{keys: keys, now: time.Now, cache: make(map[string]cachedKey)}
+}
+
+// IsSealed reports whether value was produced by Encrypt.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt seals plaintext for the given context, which Decrypt must be
+// passed again. Empty strings are left empty so optional attributes stay
+// recognizably unset.
+func (e *Encrypter) Encrypt(ctx context.Context, plaintext, aad string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	key, err := e.dataKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(key.plaintext, []byte(plaintext), []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return key.header + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// dataKey returns the current data key, replacing it once it is used up
+// or too old.
+func (e *Encrypter) dataKey(ctx context.Context) (*dataKey, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	if k := e.current; k != nil && k.uses < dataKeyUses && now.Before(k.expires) {
+		k.uses++
+		return k, nil
+	}
+
+	keyID, plaintext, wrapped, err := e.keys.NewDataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating data key: %w", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(wrapped)
+	e.current = &dataKey{
+		keyID:     keyID,
+		plaintext: plaintext,
+		header:    prefix + keyID + ":" + encoded + ":",
+		uses:      1,
+		expires:   now.Add(dataKeyAge),
+	}
+	e.remember(keyID+":"+encoded, plaintext, now)
+	return e.current, nil
+}
+
+// Decrypt opens a value produced by Encrypt with the same context. Values
+// that were never sealed are returned unchanged, so data written before
+// encryption was enabled stays readable until it is re-encrypted.
+func (e *Encrypter) Decrypt(ctx context.Context, value, aad string) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+	rest := strings.TrimPrefix(value, prefix)
+
+	// Key IDs such as KMS ARNs may contain colons, but base64 never does,
+	// so split the two payloads off the end.
+	last := strings.LastIndex(rest, ":")
+	if last < 0 {
+		return "", fmt.Errorf("malformed sealed value")
+	}
+	mid := strings.LastIndex(rest[:last], ":")
+	if mid < 0 {
+		return "", fmt.Errorf("malformed sealed value")
+	}
+	keyID := rest[:mid]
+
+	sealed, err := base64.StdEncoding.DecodeString(rest[last+1:])
+	if err != nil {
+		return "", fmt.Errorf("decoding ciphertext: %w", err)
+	}
+	dataKey, err := e.unwrap(ctx, keyID, rest[mid+1:last])
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(dataKey, sealed, []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// unwrap returns the data key wrapped under keyID, from the cache if it
+// was unwrapped recently.
+func (e *Encrypter) unwrap(ctx context.Context, keyID, encoded string) ([]byte, error) {
+	cacheKey := keyID + ":" + encoded
+	e.mu.Lock()
+	c, ok := e.cache[cacheKey]
+	e.mu.Unlock()
+	if ok && e.now().Before(c.expires) {
+		return c.plaintext, nil
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding wrapped data key: %w", err)
+	}
+	plaintext, err := e.keys.UnwrapDataKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key %s: %w", keyID, err)
+	}
+
+	e.mu.Lock()
+	e.remember(cacheKey, plaintext, e.now())
+	e.mu.Unlock()
+	return plaintext, nil
+}
+
+// remember caches an unwrapped data key, dropping expired keys, or an
+// arbitrary one, when the cache is full. e.mu must be held.
+func (e *Encrypter) remember(cacheKey string, plaintext []byte, now time.Time) {
+	if len(e.cache) >= cacheSize {
+		for k, c := range e.cache {
+			if !now.Before(c.expires) {
+				delete(e.cache, k)
+			}
+		}
+		for k := range e.cache {
+			if len(e.cache) < cacheSize {
+				break
+			}
+			delete(e.cache, k)
+		}
+	}
+	e.cache[cacheKey] = cachedKey{plaintext: plaintext, expires: now.Add(cacheAge)}
+}
+
+// seal encrypts plaintext with AES-GCM, authenticating additional, and
+// prepends the nonce.
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// open reverses seal. It fails unless additional is what was sealed with.
+func open(key, sealed, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additional)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCM: %w", err)
+	}
+	return gcm, nil
+}
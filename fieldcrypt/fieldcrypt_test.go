@@ -0,0 +1,230 @@
+package fieldcrypt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newKeyring(t *testing.T, active string, ids ...string) *Keyring {
+	t.Helper()
+	k := &Keyring{active: active, keys: make(map[string][]byte)}
+	for _, id := range ids {
+		k.keys[id] = newKey(t)
+	}
+	return k
+}
+
+// countingProvider counts the calls made to the provider it wraps.
+type countingProvider struct {
+	KeyProvider
+	created, unwrapped int
+}
+
+func (p *countingProvider) NewDataKey(ctx context.Context) (string, []byte, []byte, error) {
+	p.created++
+	return p.KeyProvider.NewDataKey(ctx)
+}
+
+func (p *countingProvider) UnwrapDataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	p.unwrapped++
+	return p.KeyProvider.UnwrapDataKey(ctx, keyID, wrapped)
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	e := NewEncrypter(newKeyring(t, "k1", "k1"))
+
+	tests := []struct {
+		name      string
+		plaintext string
+		aad       string
+	}{
+		{"empty", "", "Reviews|S1|Feedback"},
+		{"ascii", "Great work on the launch.", "Reviews|S1|Feedback"},
+		{"unicode", "Très bien 👍", "Reviews|S1|Answers.q1.Text"},
+		{"colons", "a:b:c", "Tokens|T1|BotAccessToken"},
+		{"no context", "token", ""},
+		{"long", strings.Repeat("x", 10000), "Drafts|U1/D1|Answers.q1.Text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := e.Encrypt(ctx, tt.plaintext, tt.aad)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if tt.plaintext == "" {
+				if sealed != "" {
+					t.Fatalf("Encrypt(%q) = %q, want empty", tt.plaintext, sealed)
+				}
+				return
+			}
+			if !IsSealed(sealed) || !strings.HasPrefix(sealed, prefix+"k1:") {
+				t.Fatalf("Encrypt(%q) = %q, want a sealed value under k1", tt.plaintext, sealed)
+			}
+			if strings.Contains(sealed, tt.plaintext) {
+				t.Fatalf("sealed value contains the plaintext")
+			}
+
+			got, err := e.Decrypt(ctx, sealed, tt.aad)
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if got != tt.plaintext {
+				t.Fatalf("Decrypt = %q, want %q", got, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestDecryptUnsealed(t *testing.T) {
+	e := NewEncrypter(newKeyring(t, "k1", "k1"))
+	for _, value := range []string{"", "plain text", "enc:v3:future"} {
+		got, err := e.Decrypt(context.Background(), value, "Reviews|S1|Feedback")
+		if err != nil {
+			t.Fatalf("Decrypt(%q): %v", value, err)
+		}
+		if got != value {
+			t.Fatalf("Decrypt(%q) = %q, want it unchanged", value, got)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	old := newKeyring(t, "k1", "k1")
+	sealed, err := NewEncrypter(old).Encrypt(ctx, "secret", "Users|U1|Token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := &Keyring{active: "k2", keys: map[string][]byte{"k1": old.keys["k1"], "k2": newKey(t)}}
+	retired := &Keyring{active: "k2", keys: map[string][]byte{"k2": rotated.keys["k2"]}}
+
+	tests := []struct {
+		name    string
+		keys    *Keyring
+		wantErr bool
+	}{
+		{"old key still in keyring", rotated, false},
+		{"old key removed", retired, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEncrypter(tt.keys)
+			got, err := e.Decrypt(ctx, sealed, "Users|U1|Token")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Decrypt = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != "secret" {
+				t.Fatalf("Decrypt = %q, %v; want secret", got, err)
+			}
+
+			resealed, err := e.Encrypt(ctx, got, "Users|U1|Token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(resealed, prefix+"k2:") {
+				t.Fatalf("re-encrypted value %q is not under the active key k2", resealed)
+			}
+		})
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	ctx := context.Background()
+	keys := newKeyring(t, "k1", "k1")
+	sealed, err := NewEncrypter(keys).Encrypt(ctx, "secret", "Reviews|S1|Feedback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(strings.TrimPrefix(sealed, prefix), ":")
+	keyID, wrapped, ciphertext := parts[0], parts[1], parts[2]
+
+	flip := func(encoded string) string {
+		b, _ := base64.StdEncoding.DecodeString(encoded)
+		b[len(b)-1] ^= 1
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	tests := []struct {
+		name  string
+		keys  *Keyring
+		value string
+		aad   string
+	}{
+		{"wrong key", newKeyring(t, "k1", "k1"), sealed, "Reviews|S1|Feedback"},
+		{"unknown key", newKeyring(t, "k2", "k2"), sealed, "Reviews|S1|Feedback"},
+		{"other record", keys, sealed, "Reviews|S2|Feedback"},
+		{"other attribute", keys, sealed, "Reviews|S1|Answers.q1.Text"},
+		{"no context", keys, sealed, ""},
+		{"tampered ciphertext", keys, prefix + keyID + ":" + wrapped + ":" + flip(ciphertext), "Reviews|S1|Feedback"},
+		{"tampered data key", keys, prefix + keyID + ":" + flip(wrapped) + ":" + ciphertext, "Reviews|S1|Feedback"},
+		{"truncated ciphertext", keys, prefix + keyID + ":" + wrapped + ":AAAA", "Reviews|S1|Feedback"},
+		{"bad base64", keys, prefix + keyID + ":" + wrapped + ":!!!", "Reviews|S1|Feedback"},
+		{"malformed", keys, prefix + "no-separators", "Reviews|S1|Feedback"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewEncrypter(tt.keys).Decrypt(ctx, tt.value, tt.aad)
+			if err == nil {
+				t.Fatalf("Decrypt = %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestDataKeyReuse(t *testing.T) {
+	ctx := context.Background()
+	keys := &countingProvider{KeyProvider: newKeyring(t, "k1", "k1")}
+	now := time.Now()
+	e := NewEncrypter(keys)
+	e.now = func() time.Time { return now }
+
+	var sealed []string
+	for i := 0; i < 3; i++ {
+		v, err := e.Encrypt(ctx, "value", "Reviews|S1|Feedback")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed = append(sealed, v)
+	}
+	if keys.created != 1 {
+		t.Fatalf("created %d data keys for 3 values, want 1", keys.created)
+	}
+
+	now = now.Add(dataKeyAge)
+	if _, err := e.Encrypt(ctx, "value", "Reviews|S1|Feedback"); err != nil {
+		t.Fatal(err)
+	}
+	if keys.created != 2 {
+		t.Fatalf("created %d data keys after the first expired, want 2", keys.created)
+	}
+
+	// A fresh Encrypter unwraps the shared data key once.
+	reader := &countingProvider{KeyProvider: keys.KeyProvider}
+	d := NewEncrypter(reader)
+	for _, v := range sealed {
+		if _, err := d.Decrypt(ctx, v, "Reviews|S1|Feedback"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reader.unwrapped != 1 {
+		t.Fatalf("unwrapped %d data keys for 3 values, want 1", reader.unwrapped)
+	}
+}
@@ -0,0 +1,79 @@
+package fieldcrypt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Keyring is a KeyProvider backed by key-encryption keys in a local file.
+//
+// The file is YAML with one active key used for new data keys and any
+// number of older keys kept around to unwrap existing values:
+//
+//	active: "2024-02"
+//	keys:
+//	  "2024-01": <base64 of 32 random bytes>
+//	  "2024-02": <base64 of 32 random bytes>
+type Keyring struct {
+	active string
+	keys   map[string][]byte
+}
+
+// LoadKeyring reads a keyring file.
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Active string            `yaml:"active"`
+		Keys   map[string]string `yaml:"keys"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing keyring %s: %w", path, err)
+	}
+
+	k := &Keyring{active: file.Active, keys: make(map[string][]byte)}
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decoding key %s: %w", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s must be 32 bytes, got %d", id, len(key))
+		}
+		k.keys[id] = key
+	}
+
+	if _, ok := k.keys[k.active]; !ok {
+		return nil, fmt.Errorf("active key %q is not in keyring %s", k.active, path)
+	}
+	return k, nil
+}
+
+func (k *Keyring) NewDataKey(ctx context.Context) (string, []byte, []byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", nil, nil, fmt.Errorf("generating data key: %w", err)
+	}
+
+	wrapped, err := seal(k.keys[k.active], dataKey, nil)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return k.active, dataKey, wrapped, nil
+}
+
+func (k *Keyring) UnwrapDataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	kek, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %q is not in the keyring", keyID)
+	}
+	return open(kek, wrapped, nil)
+}
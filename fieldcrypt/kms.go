@@ -0,0 +1,50 @@
+package fieldcrypt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// KMSAPI is the part of the KMS API used for data keys. Any service that
+// speaks it, such as AWS KMS or a local emulator, can back a KMS provider.
+type KMSAPI interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// KMS is a KeyProvider that has a KMS key wrap every data key.
+type KMS struct {
+	client KMSAPI
+	keyID  string
+}
+
+// NewKMS returns a KMS provider that creates data keys under keyID.
+func NewKMS(client KMSAPI, keyID string) *KMS {
+	return &KMS{client: client, keyID: keyID}
+}
+
+func (k *KMS) NewDataKey(ctx context.Context) (string, []byte, []byte, error) {
+	out, err := k.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(k.keyID),
+		KeySpec: types.DataKeySpecAes256,
+	})
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("generating KMS data key: %w", err)
+	}
+	return aws.ToString(out.KeyId), out.Plaintext, out.CiphertextBlob, nil
+}
+
+func (k *KMS) UnwrapDataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	out, err := k.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(keyID),
+		CiphertextBlob: wrapped,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decrypting KMS data key: %w", err)
+	}
+	return out.Plaintext, nil
+}
@@ -3,10 +3,9 @@ module github.com/BigPhatNerd/cbaseSLACK
 go 1.20
 
 require (
-	github.com/aws/aws-lambda-go v1.46.0
-	github.com/aws/aws-sdk-go v1.50.15
 	github.com/aws/aws-sdk-go-v2/config v1.26.6
 	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.29.2
+	github.com/aws/aws-sdk-go-v2/service/kms v1.28.2
 	github.com/slack-go/slack v0.12.3
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/scheduler"
+)
+
+// Names of the background jobs, as used in scheduler.JOBS in config.yaml
+// and in the stored job state.
+const (
+	appTokenRotationJob = "app-token-rotation"
+	botTokenRefreshJob  = "bot-token-refresh"
+	rosterSyncJob       = "roster-sync"
+	statsRebuildJob     = "stats-rebuild"
+	outboxJob           = "outbox"
+)
+
+// jobs runs every background job of the bot.
+var jobs *scheduler.Scheduler
+
+// defaultJobs are the background jobs with their default schedules. The
+// token jobs only refresh tokens close to expiry, so they run often.
+func defaultJobs() []scheduler.Job {
+	return []scheduler.Job{
+		{
+			Name:     appTokenRotationJob,
+			Schedule: scheduler.Every(5 * time.Minute),
+			Jitter:   30 * time.Second,
+			Run:      rotateAppTokens,
+		},
+		{
+			Name:     botTokenRefreshJob,
+			Schedule: scheduler.Every(5 * time.Minute),
+			Jitter:   30 * time.Second,
+			Run:      refreshBotTokens,
+		},
+		{
+			Name:     rosterSyncJob,
+			Schedule: scheduler.Every(6 * time.Hour),
+			Jitter:   5 * time.Minute,
+			Run:      syncRosters,
+		},
+		{
+			Name:     statsRebuildJob,
+			Schedule: scheduler.Every(24 * time.Hour),
+			Jitter:   10 * time.Minute,
+			Run:      rebuildStats,
+		},
+		{
+			Name:      outboxJob,
+			Schedule:  scheduler.Every(time.Minute),
+			Run:       deliverOutbox,
+			RetryBase: 10 * time.Second,
+			RetryMax:  time.Minute,
+		},
+	}
+}
+
+// loadJobs registers the default jobs with the schedules overridden by
+// scheduler.JOBS in config.yaml.
+func loadJobs() (*scheduler.Scheduler, error) {
+	s := scheduler.New(store)
+	known := make(map[string]bool)
+	for _, job := range defaultJobs() {
+		known[job.Name] = true
+		if spec, ok := configure.Scheduler.Jobs[job.Name]; ok {
+			schedule, err := scheduler.Parse(spec)
+			if err != nil {
+				return nil, fmt.Errorf("scheduler.JOBS %s: %w", job.Name, err)
+			}
+			job.Schedule = schedule
+		}
+		if err := s.Register(job); err != nil {
+			return nil, err
+		}
+	}
+
+	for name := range configure.Scheduler.Jobs {
+		if !known[name] {
+			return nil, fmt.Errorf("scheduler.JOBS: unknown job %q", name)
+		}
+	}
+	return s, nil
+}
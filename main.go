@@ -2,19 +2,16 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"time"
 
-	"github.com/BigPhatNerd/cbaseSLACK/oauth"
-	"github.com/slack-go/slack"
 	httptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/net/http"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
-var api *slack.Client
-
 func main() {
 	tracer.Start(
 		tracer.WithService("CbaseDemo"),
@@ -36,25 +33,67 @@ func main() {
 		log.Printf("Error reading config: %v", err)
 	}
 
-	tableName := "Tokens"
+	if configure.Feedback.Anonymity != anonymityForbidden && configure.Feedback.AnonymityKey == "" {
+		log.Printf("feedback.ANONYMITY_KEY is not set; anonymous reviews are disabled")
+	}
+
+	reviewTemplates, err = loadReviewTemplates()
+	if err != nil {
+		log.Fatalf("Failed to load review templates: %v", err)
+	}
+
+	lexicon, err = loadLexicon()
+	if err != nil {
+		log.Fatalf("Failed to load sentiment lexicon: %v", err)
+	}
+
+	contentRules, err = loadContentRules()
+	if err != nil {
+		log.Fatalf("Failed to load content rules: %v", err)
+	}
+
+	views, err = loadViews()
+	if err != nil {
+		log.Fatalf("Failed to load Slack views: %v", err)
+	}
+
 	ctx := context.TODO()
 
-	teamID := configure.Slack.TeamID
-	oauth.ScheduleAppTokenRotation(tableName, teamID)
-	// oauth.RotateAndStoreToken("xoxe-1-", tableName)
+	store, err = openStore(ctx)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
 
-	// if err := RefreshBotToken(ctx, teamID); err != nil {
-	// 	log.Printf("Error refreshing bot token: %v", err)
-	// }
-	scheduleRefreshBotToken(ctx, teamID, 10*time.Hour)
+	if len(os.Args) > 1 && os.Args[1] == "reencrypt" {
+		if err := reencryptAll(ctx, store); err != nil {
+			log.Fatalf("Re-encryption failed: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "backfill-teams" {
+		if err := backfillTeamIDs(ctx, store, configure.Slack.TeamID); err != nil {
+			log.Fatalf("Team backfill failed: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := runExport(ctx, os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	log.Printf("Bot token refreshed successfully")
+	// oauth.RotateAndStoreToken(ctx, store, "xoxe-1-", "")
 
-	userToken, err := FetchBotAuthToken(teamID)
-	api = slack.New(userToken)
+	jobs, err = loadJobs()
 	if err != nil {
-		log.Printf("Error fetching bot auth token: %v", err)
+		log.Fatalf("Failed to load background jobs: %v", err)
 	}
+	aggregateStats(ctx)
+	jobs.Start(ctx)
 
 	mux := httptrace.NewServeMux()
 
@@ -62,6 +101,8 @@ func main() {
 	mux.HandleFunc("/oauth/callback", OauthCallbackHandler)
 	mux.HandleFunc("/events", EventsHandler)
 	mux.HandleFunc("/interactions", InteractionHandler)
+	mux.HandleFunc("/commands", CommandsHandler)
+	mux.HandleFunc("/export", ExportHandler)
 
 	port := ":4390"
 	log.Printf("Server listening on port %s", port)
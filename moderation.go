@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/slack-go/slack"
+)
+
+// moderationCommentCallbackID identifies submissions of the modal a
+// moderator explains a rejection or change request in.
+const moderationCommentCallbackID = "moderation_comment_modal"
+
+// moderationMetadata is carried through the comment modal in
+// private_metadata. Revision is the revision of the review the moderator
+// was shown. Channel and Timestamp locate the approval request the
+// moderator acted on so it can be updated.
+type moderationMetadata struct {
+	SubmissionID string `json:"submission_id"`
+	Revision     int    `json:"revision"`
+	Status       string `json:"status"`
+	Channel      string `json:"channel"`
+	Timestamp    string `json:"ts"`
+}
+
+// Refusals of moderation actions on a review that changed.
+const (
+	reviewEditedRefusal  = "This review was edited after this request was sent. A new request has been sent for the current text."
+	reviewChangedRefusal = "This review changed while you were moderating it. Please try again from the latest request."
+)
+
+// moderationEnabled reports whether new reviews wait for approval.
+func moderationEnabled() bool {
+	return configure.Moderation.Enabled
+}
+
+// moderatorsFor returns who may approve review: the reviewee's manager,
+// or the designated moderators if they have none or wrote the review.
+func moderatorsFor(review storage.Review) []string {
+	if manager := configure.Org.Managers[review.RevieweeID]; manager != "" && !isAuthor(review, review.TeamID, manager) {
+		return []string{manager}
+	}
+	return configure.Moderation.Moderators
+}
+
+// canModerate reports whether userID may approve review.
+func canModerate(review storage.Review, userID string) bool {
+	for _, id := range moderatorsFor(review) {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// setStatus moves review to status and records the transition.
+func setStatus(review *storage.Review, status, by, comment string) {
+	review.Status = status
+	review.StatusHistory = append(review.StatusHistory, storage.StatusChange{
+		Status:  status,
+		At:      time.Now().UTC().Format(time.RFC3339),
+		By:      by,
+		Comment: comment,
+	})
+}
+
+// statusLabel describes the moderation status of review to its author, or
+// returns "" for approved reviews.
+func statusLabel(review storage.Review) string {
+	var comment string
+	if n := len(review.StatusHistory); n > 0 && review.StatusHistory[n-1].Comment != "" {
+		comment = ": " + review.StatusHistory[n-1].Comment
+	}
+
+	switch review.Status {
+	case storage.StatusPending:
+		return "Waiting for approval"
+	case storage.StatusChangesRequested:
+		return "Changes requested" + comment
+	case storage.StatusRejected:
+		return "Rejected" + comment
+	default:
+		return ""
+	}
+}
+
+// requestApproval sends review to its moderators with buttons to approve,
+// request changes or reject it, and records the requests on the review so
+// they can be withdrawn if it is edited.
+func requestApproval(teamID string, review storage.Review) {
+	moderators := moderatorsFor(review)
+	if len(moderators) == 0 {
+		log.Printf("Review %s is pending but there is nobody to approve it", review.SubmissionID)
+		return
+	}
+
+	client, err := slackClients.Client(teamID)
+	if err != nil {
+		log.Printf("Error resolving Slack client for team %s: %v", teamID, err)
+		return
+	}
+
+	text := fmt.Sprintf("A review of %s is waiting for your approval.", revieweeLabel(review))
+	var requests []storage.MessageRef
+	for _, moderator := range moderators {
+		channel, timestamp, err := client.PostMessage(moderator, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(approvalBlocks(review)...))
+		if err != nil {
+			log.Printf("Error sending review %s to %s for approval: %v", review.SubmissionID, moderator, err)
+			continue
+		}
+		requests = append(requests, storage.MessageRef{Channel: channel, Timestamp: timestamp})
+	}
+	if len(requests) == 0 {
+		return
+	}
+
+	ok, err := store.SetApprovalRequests(context.TODO(), review.SubmissionID, review.Revision, requests)
+	if err != nil {
+		log.Printf("Error recording approval requests of review %s: %v", review.SubmissionID, err)
+		return
+	}
+	if !ok {
+		// The review was edited or moderated while the requests were being
+		// sent, so they are already out of date.
+		withdrawApprovalRequests(client, requests, reviewEditedRefusal)
+	}
+}
+
+// withdrawApprovalRequests replaces the buttons of each approval request
+// with text.
+func withdrawApprovalRequests(client *slack.Client, requests []storage.MessageRef, text string) {
+	for _, r := range requests {
+		updateApprovalRequest(client, r.Channel, r.Timestamp, text)
+	}
+}
+
+// withdrawEditedApprovalRequests withdraws the approval requests sent for
+// existing now that it has been edited into review, so moderators cannot
+// approve text that was replaced.
+func withdrawEditedApprovalRequests(existing, review storage.Review) {
+	client, err := slackClients.Client(review.TeamID)
+	if err != nil {
+		log.Printf("Error resolving Slack client for team %s: %v", review.TeamID, err)
+		return
+	}
+	text := "This review was edited and no longer needs approval."
+	if review.Status == storage.StatusPending {
+		text = reviewEditedRefusal
+	}
+	withdrawApprovalRequests(client, existing.ApprovalRequests, text)
+}
+
+// moderationValue is the value of the moderation buttons of review: its
+// submission ID and the revision the moderator is shown.
+func moderationValue(review storage.Review) string {
+	return review.SubmissionID + ":" + strconv.Itoa(review.Revision)
+}
+
+// parseModerationValue reads a moderationValue.
+func parseModerationValue(value string) (submissionID string, revision int, err error) {
+	i := strings.LastIndex(value, ":")
+	if i < 0 {
+		return "", 0, fmt.Errorf("moderation value %q has no revision", value)
+	}
+	revision, err = strconv.Atoi(value[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("moderation value %q: %w", value, err)
+	}
+	return value[:i], revision, nil
+}
+
+func approvalBlocks(review storage.Review) []slack.Block {
+	text := fmt.Sprintf("*A review is waiting for your approval*\n*Reviewer:* %s\n*Employee Reviewed:* %s\n%s", reviewerLabel(review), revieweeLabel(review), reviewBody(review))
+	if len(review.ContentFlags) > 0 {
+		text += fmt.Sprintf("\n:warning: *Submitted despite content warnings:* %s", strings.Join(review.ContentFlags, ", "))
+	}
+
+	value := moderationValue(review)
+	approve := slack.NewButtonBlockElement("approve_review_action", value, slack.NewTextBlockObject("plain_text", "Approve", false, false))
+	approve.Style = slack.StylePrimary
+	changes := slack.NewButtonBlockElement("request_changes_action", value, slack.NewTextBlockObject("plain_text", "Request changes", false, false))
+	reject := slack.NewButtonBlockElement("reject_review_action", value, slack.NewTextBlockObject("plain_text", "Reject", false, false))
+	reject.Style = slack.StyleDanger
+
+	return []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", text, false, false), nil, nil),
+		slack.NewActionBlock("review_moderation", approve, changes, reject),
+	}
+}
+
+// loadPendingReview returns the review a moderation action refers to, or
+// an explanation of why userID cannot act on it. The review must still be
+// at the revision the moderator was shown.
+func loadPendingReview(ctx context.Context, teamID, userID, submissionID string, revision int) (*storage.Review, string, error) {
+	review, err := store.GetReview(ctx, submissionID)
+	if err != nil {
+		return nil, "", err
+	}
+	if review.TeamID != teamID || !canModerate(*review, userID) {
+		return nil, "You are not allowed to moderate this review.", nil
+	}
+	if review.Status != storage.StatusPending {
+		return nil, "This review has already been handled.", nil
+	}
+	if review.Revision != revision {
+		return nil, reviewEditedRefusal, nil
+	}
+	return review, "", nil
+}
+
+// handleModerationAction approves a review straight away, or asks the
+// moderator for a comment before rejecting it or requesting changes.
+func handleModerationAction(w http.ResponseWriter, client *slack.Client, callback slack.InteractionCallback, action *slack.BlockAction) {
+	ctx := context.TODO()
+	submissionID, revision, err := parseModerationValue(action.Value)
+	if err != nil {
+		// Requests sent before revisions cannot show that they are current.
+		log.Printf("Refusing moderation action: %v", err)
+		updateApprovalRequest(client, callback.Channel.ID, callback.Message.Timestamp, "This approval request is out of date and can no longer be used.")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	review, refusal, err := loadPendingReview(ctx, callback.Team.ID, callback.User.ID, submissionID, revision)
+	if err != nil {
+		log.Printf("Error loading review %s: %v", submissionID, err)
+		http.Error(w, "Failed to load review", http.StatusInternalServerError)
+		return
+	}
+	if refusal != "" {
+		updateApprovalRequest(client, callback.Channel.ID, callback.Message.Timestamp, refusal)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if action.ActionID == "approve_review_action" {
+		ok, err := moderate(ctx, review, storage.StatusApproved, callback.User.ID, "")
+		if err != nil {
+			log.Printf("Error approving review %s: %v", review.SubmissionID, err)
+			http.Error(w, "Failed to approve review", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			updateApprovalRequest(client, callback.Channel.ID, callback.Message.Timestamp, reviewChangedRefusal)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		updateApprovalRequest(client, callback.Channel.ID, callback.Message.Timestamp, fmt.Sprintf("You approved the review of %s.", revieweeLabel(*review)))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	status := storage.StatusRejected
+	if action.ActionID == "request_changes_action" {
+		status = storage.StatusChangesRequested
+	}
+	modal := moderationCommentModal(moderationMetadata{
+		SubmissionID: review.SubmissionID,
+		Revision:     review.Revision,
+		Status:       status,
+		Channel:      callback.Channel.ID,
+		Timestamp:    callback.Message.Timestamp,
+	})
+	if _, err := client.OpenView(callback.TriggerID, modal); err != nil {
+		log.Printf("Error opening modal: %v", err)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// moderationCommentView is the data of slackViews/moderationComment.json.
+type moderationCommentView struct {
+	ChangesRequested bool
+}
+
+// moderationCommentModal asks a moderator why they reject or request
+// changes to a review.
+func moderationCommentModal(metadata moderationMetadata) slack.ModalViewRequest {
+	data, _ := json.Marshal(metadata)
+	return renderForm("moderationComment", moderationCommentView{
+		ChangesRequested: metadata.Status == storage.StatusChangesRequested,
+	}, moderationCommentCallbackID, string(data), false)
+}
+
+// submitModerationComment rejects or requests changes to a review with the
+// moderator's comment.
+func submitModerationComment(w http.ResponseWriter, client *slack.Client, callback slack.InteractionCallback) {
+	var metadata moderationMetadata
+	if err := json.Unmarshal([]byte(callback.View.PrivateMetadata), &metadata); err != nil {
+		log.Printf("Could not parse moderation modal metadata: %v", err)
+		http.Error(w, "Could not parse modal metadata", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.TODO()
+	review, refusal, err := loadPendingReview(ctx, callback.Team.ID, callback.User.ID, metadata.SubmissionID, metadata.Revision)
+	if err != nil {
+		log.Printf("Error loading review %s: %v", metadata.SubmissionID, err)
+		http.Error(w, "Failed to load review", http.StatusInternalServerError)
+		return
+	}
+	if refusal != "" {
+		respondViewSubmission(w, slack.NewUpdateViewSubmissionResponse(noticeModal("Not available", refusal)))
+		return
+	}
+
+	comment := callback.View.State.Values["moderation_comment"]["moderation_comment_input"].Value
+	ok, err := moderate(ctx, review, metadata.Status, callback.User.ID, comment)
+	if err != nil {
+		log.Printf("Error moderating review %s: %v", review.SubmissionID, err)
+		http.Error(w, "Failed to update review", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		respondViewSubmission(w, slack.NewUpdateViewSubmissionResponse(noticeModal("Not available", reviewChangedRefusal)))
+		return
+	}
+
+	verb := "rejected"
+	if metadata.Status == storage.StatusChangesRequested {
+		verb = "requested changes to"
+	}
+	updateApprovalRequest(client, metadata.Channel, metadata.Timestamp, fmt.Sprintf("You %s the review of %s.", verb, revieweeLabel(*review)))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("{}"))
+}
+
+// moderate records a moderator's decision on review and tells the author
+// about rejections and change requests. Anonymous authors cannot be
+// messaged; they see the outcome in /review list. It returns false without
+// changing anything if the review changed since it was read.
+func moderate(ctx context.Context, review *storage.Review, status, moderatorID, comment string) (bool, error) {
+	before := *review
+	setStatus(review, status, moderatorID, comment)
+	review.Revision++
+	ok, err := store.ReplaceReview(ctx, review, before.Revision)
+	if err != nil || !ok {
+		return false, err
+	}
+	recordReviewChange(&before, review)
+	log.Printf("Review %s is now %s", review.SubmissionID, status)
+
+	if firstApproval(*review) {
+		go notifyReviewee(*review)
+	}
+	if status == storage.StatusApproved {
+		go checkNegativeRun(review.TeamID, review.RevieweeID)
+	}
+	if status == storage.StatusApproved || review.UserID == "" {
+		return true, nil
+	}
+
+	text := fmt.Sprintf("Your review of %s was rejected.", revieweeLabel(*review))
+	if status == storage.StatusChangesRequested {
+		text = fmt.Sprintf("Changes were requested to your review of %s. Use `/review list` to edit it.", revieweeLabel(*review))
+	}
+	if comment != "" {
+		text += "\n>" + comment
+	}
+	if err := enqueueMessage(ctx, review.TeamID, review.UserID, text, nil); err != nil {
+		log.Printf("Error queueing notification of review %s: %v", review.SubmissionID, err)
+	}
+	return true, nil
+}
+
+// updateApprovalRequest replaces the buttons of an approval request with
+// text saying how it was handled.
+func updateApprovalRequest(client *slack.Client, channel, timestamp, text string) {
+	if channel == "" || timestamp == "" {
+		return
+	}
+	_, _, _, err := client.UpdateMessage(channel, timestamp,
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionBlocks(slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", text, false, false), nil, nil)),
+	)
+	if err != nil {
+		log.Printf("Error updating approval request: %v", err)
+	}
+}
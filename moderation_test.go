@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+)
+
+func TestModerationValue(t *testing.T) {
+	value := moderationValue(storage.Review{SubmissionID: "3f2a-9c", Revision: 4})
+	id, revision, err := parseModerationValue(value)
+	if err != nil || id != "3f2a-9c" || revision != 4 {
+		t.Fatalf("parseModerationValue(%q) = %q, %d, %v", value, id, revision, err)
+	}
+
+	// Requests sent before revisions carry only the submission ID.
+	for _, value := range []string{"3f2a-9c", "3f2a-9c:", "3f2a-9c:x"} {
+		if _, _, err := parseModerationValue(value); err == nil {
+			t.Errorf("parseModerationValue(%q) succeeded", value)
+		}
+	}
+}
+
+func TestModerateNotifiesAuthor(t *testing.T) {
+	tests := []struct {
+		name    string
+		review  storage.Review
+		status  string
+		comment string
+		want    string
+	}{
+		{"rejected", storage.Review{UserID: "U1", RevieweeID: "U2"}, storage.StatusRejected, "",
+			"Your review of <@U2> was rejected."},
+		{"changes requested", storage.Review{UserID: "U1", RevieweeID: "U2"}, storage.StatusChangesRequested, "Too vague",
+			"Changes were requested to your review of <@U2>. Use `/review list` to edit it.\n>Too vague"},
+		{"anonymous", storage.Review{Anonymous: true, ReviewerHash: "H1", RevieweeID: "U2"}, storage.StatusRejected, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review := tt.review
+			review.SubmissionID = "S1"
+			review.TeamID = "T1"
+			review.Status = storage.StatusPending
+			exportStore(t, review)
+			testJobs(t)
+
+			ok, err := moderate(context.Background(), &review, tt.status, "M1", tt.comment)
+			if err != nil || !ok {
+				t.Fatalf("moderate = %v, %v", ok, err)
+			}
+			messages := queuedMessages(t)
+			if tt.want == "" {
+				if len(messages) != 0 {
+					t.Fatalf("queued %+v for an anonymous author", messages)
+				}
+				return
+			}
+			if len(messages) != 1 || messages[0].Channel != "U1" || messages[0].TeamID != "T1" || messages[0].Text != tt.want {
+				t.Fatalf("queued %+v, want %q to U1", messages, tt.want)
+			}
+		})
+	}
+}
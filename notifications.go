@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/slack-go/slack"
+)
+
+// notifyToggleActionID is the home tab checkbox that opts in to received
+// feedback notifications.
+const notifyToggleActionID = "notify_received_action"
+
+// notifyReviewee tells the reviewee of review that they received
+// feedback, if they opted in and may read it. The review text is not
+// included and anonymous authors are not named. The message goes through
+// the outbox, so a Slack outage only delays it.
+func notifyReviewee(review storage.Review) {
+	if review.RevieweeID == "" || !review.Approved() {
+		return
+	}
+	ctx := context.TODO()
+
+	prefs, err := store.GetPreferences(ctx, review.TeamID, review.RevieweeID)
+	if err != nil {
+		log.Printf("Error loading preferences of %s: %v", review.RevieweeID, err)
+		return
+	}
+	if !prefs.NotifyReceived || !canSeeReceived(ctx, review.TeamID, review.RevieweeID) {
+		return
+	}
+
+	from := "anonymous feedback"
+	if !review.Anonymous && review.UserID != "" {
+		from = fmt.Sprintf("feedback from <@%s>", review.UserID)
+	}
+	text := fmt.Sprintf("You received new %s. Open the %s to read it.", from, homeTabLink(review.TeamID))
+
+	if err := enqueueMessage(ctx, review.TeamID, review.RevieweeID, text, nil); err != nil {
+		log.Printf("Error queueing notification of review %s: %v", review.SubmissionID, err)
+	}
+}
+
+// canSeeReceived reports whether userID may read reviews about themselves.
+func canSeeReceived(ctx context.Context, teamID, userID string) bool {
+	v := visibilityFor(ctx, teamID, userID)
+	if v.All {
+		return true
+	}
+	for _, id := range v.RevieweeIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// homeTabLink links to the home tab of the app, or names it when the app
+// ID is not configured.
+func homeTabLink(teamID string) string {
+	if configure.Slack.AppID == "" {
+		return "app's Home tab"
+	}
+	return fmt.Sprintf("<slack://app?team=%s&id=%s&tab=home|Home tab>", teamID, configure.Slack.AppID)
+}
+
+// firstApproval reports whether review was just approved for the first
+// time, so edits that go back through moderation are not announced again.
+func firstApproval(review storage.Review) bool {
+	approvals := 0
+	for _, c := range review.StatusHistory {
+		if c.Status == storage.StatusApproved {
+			approvals++
+		}
+	}
+	return review.Status == storage.StatusApproved && approvals == 1
+}
+
+// setNotifyReceived stores whether userID wants received feedback
+// notifications.
+func setNotifyReceived(ctx context.Context, teamID, userID string, on bool) error {
+	prefs, err := store.GetPreferences(ctx, teamID, userID)
+	if err != nil {
+		return err
+	}
+	prefs.NotifyReceived = on
+	return store.PutPreferences(ctx, prefs)
+}
+
+// handleNotifyToggle saves the home tab notification checkbox.
+func handleNotifyToggle(w http.ResponseWriter, callback slack.InteractionCallback, action *slack.BlockAction) {
+	on := len(action.SelectedOptions) > 0
+	if err := setNotifyReceived(context.TODO(), callback.Team.ID, callback.User.ID, on); err != nil {
+		log.Printf("Error saving preferences of %s: %v", callback.User.ID, err)
+		http.Error(w, "Failed to save preferences", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
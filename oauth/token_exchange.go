@@ -3,19 +3,16 @@ package oauth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
-	"strconv"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/aws/aws-sdk-go/aws"
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
 )
 
 // AppTokenRotationResponse represents the response from Slack token rotation endpoint.
@@ -68,7 +65,11 @@ func rotateToken(refreshToken string) (*AppTokenRotationResponse, error) {
 	return &response, nil
 }
 
-func RotateAndStoreToken(refreshToken, tableName string) error {
+// RotateAndStoreToken rotates refreshToken and stores the new app tokens
+// if the team's refresh token is still stored, which is empty while
+// bootstrapping. Otherwise another instance rotated first and its tokens
+// are kept.
+func RotateAndStoreToken(ctx context.Context, store storage.TokenStore, refreshToken, stored string) error {
 
 	response, err := rotateToken(refreshToken)
 
@@ -77,150 +78,100 @@ func RotateAndStoreToken(refreshToken, tableName string) error {
 		return fmt.Errorf("failed to rotate token: %w", err)
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		log.Printf("Error loading SDK config: %v", err)
-		return fmt.Errorf("unable to load SDK config, %w", err)
-	}
-	svc := dynamodb.NewFromConfig(cfg)
-
-	iatStr := strconv.FormatInt(response.AppTokenIssuedAt, 10)
-	expStr := strconv.FormatInt(response.AppTokenExpiresAt, 10)
-
-	update := map[string]types.AttributeValue{
-		":t":   &types.AttributeValueMemberS{Value: response.AppAuthToken},
-		":r":   &types.AttributeValueMemberS{Value: response.AppRefreshToken},
-		":e":   &types.AttributeValueMemberN{Value: expStr},
-		":iat": &types.AttributeValueMemberN{Value: iatStr},
-		":uid": &types.AttributeValueMemberS{Value: response.AppUserID},
-	}
-
-	_, err = svc.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
-		TableName: aws.String(tableName),
-		Key: map[string]types.AttributeValue{
-			"TeamId": &types.AttributeValueMemberS{Value: response.TeamID},
-		},
-		UpdateExpression:          aws.String("SET AppAuthToken = :t, AppRefreshToken = :r, AppTokenExpiresAt = :e, AppTokenIssuedAt = :iat, AppUserID = :uid"),
-		ExpressionAttributeValues: update,
+	ok, err := store.ReplaceAppTokens(ctx, response.TeamID, stored, storage.AppTokens{
+		AuthToken:    response.AppAuthToken,
+		RefreshToken: response.AppRefreshToken,
+		ExpiresAt:    response.AppTokenExpiresAt,
+		IssuedAt:     response.AppTokenIssuedAt,
+		UserID:       response.AppUserID,
 	})
 	if err != nil {
 		log.Printf("Error updating item: %v", err)
-		return fmt.Errorf("failed to update item in DynamoDB: %w", err)
+		return fmt.Errorf("failed to store app token: %w", err)
+	}
+	if !ok {
+		log.Printf("App token of team %s was rotated by another instance first", response.TeamID)
+		return nil
 	}
 
 	log.Printf("App token rotated and stored successfully for user %s", response.TeamID)
 	return nil
 }
 
-func ScheduleAppTokenRotation(tableName string, teamID string) {
-
-	rotateTokenFunc := func() {
-		refreshToken, err := getAppRefreshTokenFromStorage(teamID)
+// errNoAppRefreshToken means a team has no app configuration token to
+// rotate.
+var errNoAppRefreshToken = errors.New("no app refresh token")
+
+// RotateAppTokens rotates the app token of every installed team that
+// expires within margin. Teams whose app tokens were never stored are
+// skipped, except bootstrapTeamID, which is rotated with
+// HEROKU_REFRESH_TOKEN until its first rotation stores a refresh token.
+// It returns the errors of every team that could not be rotated.
+func RotateAppTokens(ctx context.Context, store storage.TokenStore, bootstrapTeamID string, margin time.Duration) error {
+	teamIDs, err := store.ListTeamIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list teams: %w", err)
+	}
 
+	var errs []error
+	for _, teamID := range teamIDs {
+		tokens, err := store.GetTeamTokens(ctx, teamID)
 		if err != nil {
-			log.Printf("Error retrieving App refresh token: %v", err)
-			return
+			errs = append(errs, fmt.Errorf("team %s: %w", teamID, err))
+			continue
 		}
 
-		err = RotateAndStoreToken(refreshToken, tableName)
-		if err != nil {
-			log.Printf("Error rotating token: %v", err)
+		refreshToken, err := appRefreshToken(tokens.AppTokens, teamID == bootstrapTeamID)
+		if errors.Is(err, errNoAppRefreshToken) {
+			continue
 		}
-	}
-
-	rotateTokenFunc()
-
-	// Schedule to run every 10 hours
-	ticker := time.NewTicker(10 * time.Hour)
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				rotateTokenFunc()
-			}
+		if tokens.AppTokens.RefreshToken != "" && !ExpiresWithin(tokens.AppTokens.ExpiresAt, margin) {
+			continue
 		}
-	}()
-}
-
-func getAppRefreshTokenFromStorage(teamID string) (string, error) {
-	if envToken := os.Getenv("HEROKU_REFRESH_TOKEN"); envToken != "" {
-		log.Println("Using refresh token from environment variable")
-		return envToken, nil
-	}
-
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		return "", fmt.Errorf("unable to load SDK config: %w", err)
-	}
-
-	svc := dynamodb.NewFromConfig(cfg)
 
-	key := map[string]types.AttributeValue{
-		"TeamId": &types.AttributeValueMemberS{Value: teamID},
-	}
-
-	result, err := svc.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String("Tokens"),
-		Key:       key,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to get item from DynamoDB: %w", err)
+		err = RotateAndStoreToken(ctx, store, refreshToken, tokens.AppTokens.RefreshToken)
+		if err != nil {
+			log.Printf("Error rotating token for team %s: %v", teamID, err)
+			errs = append(errs, fmt.Errorf("team %s: %w", teamID, err))
+		}
 	}
+	return errors.Join(errs...)
+}
 
-	if result.Item == nil {
-		return "", fmt.Errorf("no item found with the key TeamId")
-	}
+// ExpiresWithin reports whether a token expiring at expiresAt, in Unix
+// seconds, should be refreshed now to stay ahead of margin. An unknown
+// expiry of zero always should.
+func ExpiresWithin(expiresAt int64, margin time.Duration) bool {
+	return expiresAt == 0 || !time.Now().Add(margin).Before(time.Unix(expiresAt, 0))
+}
 
-	tokenAttr, exists := result.Item["AppRefreshToken"]
-	if !exists {
-		return "", fmt.Errorf("item does not contain a Token attribute")
+// appRefreshToken prefers the stored refresh token, since every rotation
+// replaces it. HEROKU_REFRESH_TOKEN only bootstraps the configured team
+// before its first rotation.
+func appRefreshToken(tokens storage.AppTokens, bootstrap bool) (string, error) {
+	if tokens.RefreshToken != "" {
+		return tokens.RefreshToken, nil
 	}
 
-	refreshToken, ok := tokenAttr.(*types.AttributeValueMemberS)
-	if !ok {
-		return "", fmt.Errorf("token attribute is not a string")
+	if envToken := os.Getenv("HEROKU_REFRESH_TOKEN"); bootstrap && envToken != "" {
+		log.Println("Using refresh token from environment variable")
+		return envToken, nil
 	}
 
-	return refreshToken.Value, nil
+	return "", errNoAppRefreshToken
 }
 
-func FetchAppAuthToken(teamID string) (string, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+func FetchAppAuthToken(ctx context.Context, store storage.TokenStore, teamID string) (string, error) {
+	tokens, err := store.GetTeamTokens(ctx, teamID)
 	if err != nil {
-		log.Printf("Error loading SDK config: %v", err)
-		return "", fmt.Errorf("unable to load SDK config: %w", err)
+		log.Printf("Error getting app auth token: %v", err)
+		return "", fmt.Errorf("failed to get app auth token: %w", err)
 	}
 
-	svc := dynamodb.NewFromConfig(cfg)
-
-	key := map[string]types.AttributeValue{
-		"TeamId": &types.AttributeValueMemberS{Value: teamID},
-	}
-
-	result, err := svc.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String("Tokens"),
-		Key:       key,
-	})
-	if err != nil {
-		log.Printf("Error getting item from DynamoDB: %v", err)
-		return "", fmt.Errorf("failed to get item from DynamoDB: %w", err)
-	}
-
-	if result.Item == nil {
-		log.Printf("No item found with the key TeamId %s", teamID)
-		return "", fmt.Errorf("no item found with the key TeamId %s", teamID)
-	}
-
-	tokenAttr, exists := result.Item["AppAuthToken"]
-	if !exists {
-		log.Printf("Item does not contain a Token attribute")
-		return "", fmt.Errorf("item does not contain a Token attribute")
-	}
-	authToken, ok := tokenAttr.(*types.AttributeValueMemberS)
-	if !ok {
-		log.Printf("Token attribute is not a string")
-		return "", fmt.Errorf("token attribute is not a string")
+	if tokens.AppTokens.AuthToken == "" {
+		log.Printf("Team %s has no app auth token", teamID)
+		return "", fmt.Errorf("team %s has no app auth token", teamID)
 	}
 
-	return authToken.Value, nil
+	return tokens.AppTokens.AuthToken, nil
 }
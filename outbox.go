@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/google/uuid"
+	"github.com/slack-go/slack"
+)
+
+// Delivery of outbox messages is retried with exponential backoff from
+// outboxBaseDelay up to outboxMaxDelay, and given up after
+// outboxMaxAttempts, about a day.
+const (
+	outboxBaseDelay   = 30 * time.Second
+	outboxMaxDelay    = time.Hour
+	outboxMaxAttempts = 30
+	outboxBatch       = 50
+	// outboxLease is how long a claimed message is left to its sender
+	// before another run may try it again.
+	outboxLease = 5 * time.Minute
+)
+
+// errInvalidBlocks means a stored message has blocks that cannot be
+// decoded, which no retry will change.
+var errInvalidBlocks = errors.New("invalid message blocks")
+
+// permanentSlackErrors are chat.postMessage errors that retrying cannot
+// fix.
+var permanentSlackErrors = map[string]bool{
+	"account_inactive":  true,
+	"cannot_dm_bot":     true,
+	"channel_not_found": true,
+	"invalid_blocks":    true,
+	"is_archived":       true,
+	"msg_too_long":      true,
+	"no_text":           true,
+	"user_disabled":     true,
+	"user_not_found":    true,
+}
+
+// enqueueMessage stores a message to channel in teamID and triggers the
+// outbox job to deliver it, so callers never wait on Slack.
+func enqueueMessage(ctx context.Context, teamID, channel, text string, blocks []slack.Block) error {
+	m := &storage.OutboxMessage{
+		MessageID:     uuid.New().String(),
+		TeamID:        teamID,
+		Channel:       channel,
+		Text:          text,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+		NextAttemptAt: time.Now().Unix(),
+	}
+	if len(blocks) > 0 {
+		data, err := json.Marshal(blocks)
+		if err != nil {
+			return fmt.Errorf("failed to marshal message blocks: %w", err)
+		}
+		m.Blocks = string(data)
+	}
+
+	if err := store.PutOutbox(ctx, m); err != nil {
+		return err
+	}
+	jobs.Trigger(outboxJob)
+	return nil
+}
+
+// deliverOutbox attempts every due message once.
+func deliverOutbox(ctx context.Context) error {
+	now := time.Now()
+	due, err := store.DueOutbox(ctx, now.Unix(), outboxBatch)
+	if err != nil {
+		return fmt.Errorf("failed to load outbox: %w", err)
+	}
+
+	for _, m := range due {
+		// Another instance, or an overlapping run, may have loaded the
+		// same message; only the one that claims it sends it.
+		claimed, err := store.ClaimOutbox(ctx, m.MessageID, m.NextAttemptAt, now.Add(outboxLease).Unix())
+		if err != nil {
+			log.Printf("Error claiming message %s: %v", m.MessageID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		err = postOutboxMessage(m)
+		if err == nil {
+			if err := store.DeleteOutbox(ctx, m.MessageID); err != nil {
+				log.Printf("Error removing delivered message %s from outbox: %v", m.MessageID, err)
+			}
+			continue
+		}
+
+		m.Attempts++
+		m.LastError = err.Error()
+		var slackErr slack.SlackErrorResponse
+		if errors.Is(err, errInvalidBlocks) || (errors.As(err, &slackErr) && permanentSlackErrors[slackErr.Err]) || m.Attempts >= outboxMaxAttempts {
+			log.Printf("Giving up on message %s to %s after %d attempts: %v", m.MessageID, m.Channel, m.Attempts, err)
+			if err := store.DeleteOutbox(ctx, m.MessageID); err != nil {
+				log.Printf("Error removing message %s from outbox: %v", m.MessageID, err)
+			}
+			continue
+		}
+
+		delay := outboxBackoff(m.Attempts)
+		var rateLimited *slack.RateLimitedError
+		if errors.As(err, &rateLimited) && rateLimited.RetryAfter > delay {
+			delay = rateLimited.RetryAfter
+		}
+		m.NextAttemptAt = now.Add(delay).Unix()
+		log.Printf("Error delivering message %s, retrying in %s: %v", m.MessageID, delay, err)
+		if err := store.PutOutbox(ctx, &m); err != nil {
+			log.Printf("Error rescheduling message %s: %v", m.MessageID, err)
+		}
+	}
+	return nil
+}
+
+// outboxBackoff is the delay after the given number of failed attempts.
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxBaseDelay
+	for i := 1; i < attempts && delay < outboxMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxDelay {
+		delay = outboxMaxDelay
+	}
+	return delay
+}
+
+// postOutboxMessage sends m with the bot token of its team.
+func postOutboxMessage(m storage.OutboxMessage) error {
+	client, err := slackClients.Client(m.TeamID)
+	if err != nil {
+		return err
+	}
+
+	options := []slack.MsgOption{slack.MsgOptionText(m.Text, false)}
+	if m.Blocks != "" {
+		var blocks slack.Blocks
+		if err := json.Unmarshal([]byte(m.Blocks), &blocks); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidBlocks, err)
+		}
+		options = append(options, slack.MsgOptionBlocks(blocks.BlockSet...))
+	}
+
+	_, _, err = client.PostMessage(m.Channel, options...)
+	return err
+}
@@ -1,69 +1,189 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
 	"github.com/slack-go/slack"
 )
 
-func PublishHomePage(userID string, reviews []Review) {
+// homeSectionSize is how many of the latest reviews the Given and
+// Received sections list.
+const homeSectionSize = 3
 
-	headerText := slack.NewTextBlockObject("plain_text", "Welcome to Cbase Demo!", false, false)
-	headerSection := slack.NewHeaderBlock(headerText)
+// homeView is the data of slackViews/homepage.json. Reviews is nil on the
+// landing page, which has the create and view buttons, the viewer's given
+// and received reviews, drafts and analytics instead.
+type homeView struct {
+	UserID   string
+	Cycle    *homeCycle
+	Admin    bool
+	Reviews  *homeReviews
+	Given    *homeSection
+	Received *homeSection
+	// NotifyReceived is whether the user opted in to DMs about feedback
+	// they receive.
+	NotifyReceived bool
+	// Drafts are the most recent of the DraftCount drafts of the user.
+	Drafts     []homeDraft
+	DraftCount int
+	Analytics  []slack.Block
+}
+
+// homeCycle describes the active review cycle. Reviewed and Participants
+// are only set for participants.
+type homeCycle struct {
+	Name         string
+	EndDate      string
+	Closes       int64
+	Participant  bool
+	Reviewed     int
+	Participants int
+}
 
-	sectionText := slack.NewTextBlockObject("plain_text", " Let's evaluate, shall we.....", false, false)
-	sectionBlock := slack.NewSectionBlock(sectionText, nil, nil)
+// homeReviews is a page of reviews with the cursors of the pages around
+// it.
+type homeReviews struct {
+	Reviews    []homeReview
+	Prev, Next string
+}
 
-	imageURL := "https://ctf-images-01.coinbasecdn.net/c5bd0wqjc7v0/6jPp0W7xH2Pe8kwUS79ZSm/85e33ed928fac1e8e58e2d693f5005e0/CB_blog_image.png"
-	imageAltText := "Coinbase Logo"
-	imageBlock := slack.NewImageBlock(imageURL, imageAltText, "", nil)
+// homeSection is the latest few of Count reviews.
+type homeSection struct {
+	Count   int
+	Reviews []homeReview
+}
 
-	divider := slack.NewDividerBlock()
+// homeReview is a review as listed on the home tab. Actions is the edit
+// and delete menu, and Status the moderation status, both shown to the
+// author only.
+type homeReview struct {
+	Reviewer string
+	Reviewee string
+	Body     string
+	Status   string
+	Actions  *slack.Accessory
+}
 
-	blocks := []slack.Block{headerSection, sectionBlock, imageBlock, divider}
+// homeDraft is a draft that can be resumed from the home tab.
+type homeDraft struct {
+	DraftID     string
+	Reviewee    string
+	Excerpt     string
+	Expires     int64
+	ExpiresDate string
+}
 
-	for _, review := range reviews {
-		reviewBlock := slack.NewSectionBlock(
-			slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("*Reviewer:* %s\n*Employee Reviewed:* %s\n*Feedback:* %s", review.UserName, review.EmployeeSelected, review.Feedback), false, false),
-			nil, nil,
-		)
-		blocks = append(blocks, reviewBlock, slack.NewDividerBlock())
+// PublishHomePage renders the home tab of userID. A nil page shows the
+// create and view buttons; otherwise the page of reviews is listed with
+// buttons to move between pages.
+func PublishHomePage(teamID, userID string, page *storage.ReviewPage) {
+	client, err := slackClients.Client(teamID)
+	if err != nil {
+		log.Printf("Error resolving Slack client for team %s: %v", teamID, err)
+		return
 	}
 
-	if len(reviews) > 0 {
-		removeButton := slack.NewSectionBlock(
-			slack.NewTextBlockObject("mrkdwn", "Remove reviews from the interface", false, false),
-			nil,
-			slack.NewAccessory(slack.NewButtonBlockElement("remove_reviews_action", "remove_value", slack.NewTextBlockObject("plain_text", "Remove Reviews", true, false))),
-		)
-		blocks = append(blocks, removeButton, slack.NewDividerBlock())
+	ctx := context.TODO()
+	data := homeView{
+		UserID: userID,
+		Cycle:  cycleHomeData(ctx, teamID, userID),
+		Admin:  hasRole(ctx, teamID, userID, roleAdmin),
 	}
 
-	if len(reviews) == 0 {
-		createButton := slack.NewSectionBlock(
-			slack.NewTextBlockObject("mrkdwn", "Create a review of your co-worker", false, false),
-			nil,
-			slack.NewAccessory(slack.NewButtonBlockElement("create_action", "create_value", slack.NewTextBlockObject("plain_text", "Create", true, false))),
-		)
-		viewButton := slack.NewSectionBlock(
-			slack.NewTextBlockObject("mrkdwn", "View submitted reviews", false, false),
-			nil,
-			slack.NewAccessory(slack.NewButtonBlockElement("view_action", "view_value", slack.NewTextBlockObject("plain_text", "View Reviews", true, false))),
-		)
-
-		blocks = append(blocks, createButton, divider, viewButton)
+	if page != nil {
+		data.Reviews = &homeReviews{Prev: page.Prev, Next: page.Next}
+		for _, review := range page.Reviews {
+			data.Reviews.Reviews = append(data.Reviews.Reviews, homeEntry(review, teamID, userID))
+		}
+	} else {
+		// Anonymous reviews have no UserID, so they are found by the
+		// viewer's reviewer hash instead.
+		given := viewerQuery(ctx, teamID, userID)
+		given.AuthorID = userID
+		given.AuthorHash = reviewerHash(teamID, userID)
+		data.Given = homeReviewSection(ctx, given, userID)
+
+		received := viewerQuery(ctx, teamID, userID)
+		received.RevieweeID = userID
+		received.ApprovedOnly = true
+		data.Received = homeReviewSection(ctx, received, userID)
+
+		if prefs, err := store.GetPreferences(ctx, teamID, userID); err != nil {
+			log.Printf("Error loading preferences of %s: %v", userID, err)
+		} else {
+			data.NotifyReceived = prefs.NotifyReceived
+		}
+		data.Drafts, data.DraftCount = draftHomeData(ctx, userID)
+		data.Analytics = analyticsBlocks(ctx, teamID, userID)
 	}
 
-	view := slack.HomeTabViewRequest{
-		Type:   "home",
-		Blocks: slack.Blocks{BlockSet: blocks},
+	view, err := views.Home("homepage", data)
+	if err != nil {
+		log.Printf("Error rendering home tab of %s: %v", userID, err)
+		return
 	}
 
-	res, err := api.PublishView(userID, view, "")
+	res, err := client.PublishView(userID, view, "")
 	if err != nil {
 		log.Printf("Error publishing home tab: %v", err)
 	}
 
 	log.Printf("PublishView() response: %v", res)
 }
+
+// homeEntry is review as listed on the home tab of userID.
+func homeEntry(review storage.Review, teamID, userID string) homeReview {
+	entry := homeReview{
+		Reviewer: reviewerLabel(review),
+		Reviewee: revieweeLabel(review),
+		Body:     reviewBody(review),
+	}
+	if isAuthor(review, teamID, userID) {
+		entry.Status = statusLabel(review)
+		entry.Actions = reviewOverflow(review)
+	}
+	return entry
+}
+
+// homeReviewSection counts the reviews matching q and lists the latest of
+// them. It is nil if they cannot be loaded.
+func homeReviewSection(ctx context.Context, q storage.ReviewQuery, userID string) *homeSection {
+	count, err := store.CountReviews(ctx, q)
+	if err != nil {
+		log.Printf("Error counting reviews for %s: %v", userID, err)
+		return nil
+	}
+
+	q.Limit = homeSectionSize
+	page, err := store.QueryReviews(ctx, q)
+	if err != nil {
+		log.Printf("Error fetching reviews for %s: %v", userID, err)
+		return nil
+	}
+
+	section := &homeSection{Count: count}
+	for _, review := range page.Reviews {
+		section.Reviews = append(section.Reviews, homeEntry(review, q.TeamID, userID))
+	}
+	return section
+}
+
+// reviewerLabel names the author of review, hiding anonymous reviewers.
+func reviewerLabel(review storage.Review) string {
+	if review.Anonymous {
+		return "_Anonymous_"
+	}
+	return review.UserName
+}
+
+// revieweeLabel mentions the reviewee by user ID. Reviews written before
+// the roster existed only have a name.
+func revieweeLabel(review storage.Review) string {
+	if review.RevieweeID != "" {
+		return fmt.Sprintf("<@%s>", review.RevieweeID)
+	}
+	return review.EmployeeSelected
+}
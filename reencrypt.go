@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+)
+
+// reencryptAll reads every encrypted attribute and writes it back, so
+// values sealed under retired keys end up under the active key. Run it
+// after adding a new active key to the keyring, then remove the old key
+// once it finishes.
+//
+// Tokens and reviews are only written back if they did not change since
+// they were read, so the bot may keep running: whatever changed them in
+// the meantime already sealed them under the active key. Users and drafts
+// are written back as read, so a user token stored or a draft saved while
+// the command runs can be lost; run it when nobody is installing the app
+// or writing reviews.
+func reencryptAll(ctx context.Context, s storage.Store) error {
+	teamIDs, err := s.ListTeamIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("listing teams: %w", err)
+	}
+	teams := 0
+	for _, teamID := range teamIDs {
+		t, err := s.GetTeamTokens(ctx, teamID)
+		if err != nil {
+			return fmt.Errorf("reading tokens for team %s: %w", teamID, err)
+		}
+		bot, err := s.ReplaceBotTokens(ctx, teamID, t.BotTokens.RefreshToken, t.BotTokens)
+		if err != nil {
+			return fmt.Errorf("writing bot tokens for team %s: %w", teamID, err)
+		}
+		app, err := s.ReplaceAppTokens(ctx, teamID, t.AppTokens.RefreshToken, t.AppTokens)
+		if err != nil {
+			return fmt.Errorf("writing app tokens for team %s: %w", teamID, err)
+		}
+		if !bot || !app {
+			fmt.Printf("Tokens of team %s were refreshed meanwhile and are left as they are\n", teamID)
+		}
+		teams++
+	}
+	fmt.Printf("Re-encrypted tokens for %d teams\n", teams)
+
+	reviews := 0
+	err = s.EachReview(ctx, func(r storage.Review) error {
+		// Rewriting the same text is not a change, so the revision stays
+		// and pending approval requests remain valid.
+		ok, err := s.ReplaceReview(ctx, &r, r.Revision)
+		if err != nil {
+			return fmt.Errorf("writing review %s: %w", r.SubmissionID, err)
+		}
+		if ok {
+			reviews++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Re-encrypted %d reviews\n", reviews)
+
+	users := 0
+	err = s.EachUser(ctx, func(u storage.User) error {
+		if err := s.PutUser(ctx, &u); err != nil {
+			return fmt.Errorf("writing user %s: %w", u.UserID, err)
+		}
+		users++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Re-encrypted %d users\n", users)
+
+	drafts := 0
+	err = s.EachDraft(ctx, func(d storage.Draft) error {
+		if err := s.PutDraft(ctx, &d); err != nil {
+			return fmt.Errorf("writing draft %s of %s: %w", d.DraftID, d.UserID, err)
+		}
+		drafts++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Re-encrypted %d drafts\n", drafts)
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package reviewtemplate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/slack-go/slack"
+)
+
+// maxCheckboxes is the most options a checkboxes element may have. Longer
+// multiple-choice questions use a multi-select menu instead.
+const maxCheckboxes = 10
+
+// Blocks returns an input block for each question of t, prefilled from
+// answers. Text questions use the block ID of the question and the action
+// ID "<question>_input", so the feedback question keeps the block and
+// action IDs of the original form.
+func (t *Template) Blocks(answers []storage.Answer) []slack.Block {
+	prefill := make(map[string]storage.Answer, len(answers))
+	for _, a := range answers {
+		prefill[a.QuestionID] = a
+	}
+
+	var blocks []slack.Block
+	for _, q := range t.Questions {
+		answer := prefill[q.ID]
+		switch q.Type {
+		case Text:
+			blocks = append(blocks, q.input(q.ID, q.Label, &slack.PlainTextInputBlockElement{
+				Type:         slack.METPlainTextInput,
+				ActionID:     q.actionID(),
+				Placeholder:  plainText(q.Placeholder),
+				InitialValue: answer.Text,
+				Multiline:    true,
+			}))
+		case Rating:
+			blocks = append(blocks, q.input(q.ID, q.Label, q.ratingSelect(answer.Rating)))
+		case Choice:
+			blocks = append(blocks, q.input(q.ID, q.Label, q.choiceElement(answer.Choices)))
+		case Competency:
+			given := make(map[string]int, len(answer.Ratings))
+			for _, r := range answer.Ratings {
+				given[r.Competency] = r.Rating
+			}
+			for i, c := range q.Competencies {
+				blocks = append(blocks, q.input(competencyBlockID(q.ID, i), q.Label+": "+c, q.ratingSelect(given[c])))
+			}
+		}
+	}
+	return blocks
+}
+
+// Answers reads the answers to t from the state of a submitted view.
+// Optional questions that were left blank are omitted.
+func (t *Template) Answers(values map[string]map[string]slack.BlockAction) []storage.Answer {
+	var answers []storage.Answer
+	for _, q := range t.Questions {
+		answer := storage.Answer{QuestionID: q.ID, Type: q.Type, Label: q.Label}
+		switch q.Type {
+		case Text:
+			answer.Text = strings.TrimSpace(values[q.ID][q.actionID()].Value)
+			if answer.Text == "" {
+				continue
+			}
+		case Rating:
+			answer.Rating = selectedRating(values[q.ID][q.actionID()])
+			answer.ScaleMax = q.Scale.Max
+			if answer.Rating == 0 {
+				continue
+			}
+		case Choice:
+			for _, o := range values[q.ID][q.actionID()].SelectedOptions {
+				answer.Choices = append(answer.Choices, o.Value)
+			}
+			if selected := values[q.ID][q.actionID()].SelectedOption; selected.Value != "" {
+				answer.Choices = append(answer.Choices, selected.Value)
+			}
+			if len(answer.Choices) == 0 {
+				continue
+			}
+		case Competency:
+			answer.ScaleMax = q.Scale.Max
+			for i, c := range q.Competencies {
+				if rating := selectedRating(values[competencyBlockID(q.ID, i)][q.actionID()]); rating != 0 {
+					answer.Ratings = append(answer.Ratings, storage.CompetencyRating{Competency: c, Rating: rating})
+				}
+			}
+			if len(answer.Ratings) == 0 {
+				continue
+			}
+		}
+		answers = append(answers, answer)
+	}
+	return answers
+}
+
+// Feedback returns the text answer to the feedback question, which is also
+// stored as the review's Feedback.
+func Feedback(answers []storage.Answer) string {
+	for _, a := range answers {
+		if a.QuestionID == FeedbackQuestionID && a.Type == Text {
+			return a.Text
+		}
+	}
+	return ""
+}
+
+// Format renders a stored answer as mrkdwn. It only uses what was stored
+// with the answer, so it works for any template version.
+func Format(a storage.Answer) string {
+	switch a.Type {
+	case Rating:
+		return fmt.Sprintf("%d/%d", a.Rating, a.ScaleMax)
+	case Choice:
+		return strings.Join(a.Choices, ", ")
+	case Competency:
+		parts := make([]string, 0, len(a.Ratings))
+		for _, r := range a.Ratings {
+			parts = append(parts, fmt.Sprintf("%s %d/%d", r.Competency, r.Rating, a.ScaleMax))
+		}
+		return strings.Join(parts, ", ")
+	default:
+		return a.Text
+	}
+}
+
+func (q Question) actionID() string {
+	return q.ID + "_input"
+}
+
+func competencyBlockID(questionID string, i int) string {
+	return questionID + "." + strconv.Itoa(i)
+}
+
+func (q Question) input(blockID, label string, element slack.BlockElement) *slack.InputBlock {
+	block := slack.NewInputBlock(blockID, plainText(label), plainText(q.Hint), element)
+	block.Optional = !q.Required
+	return block
+}
+
+// ratingSelect is a menu of the points on q's scale, with the end labels
+// shown next to the lowest and highest points.
+func (q Question) ratingSelect(initial int) *slack.SelectBlockElement {
+	var options []*slack.OptionBlockObject
+	var selected *slack.OptionBlockObject
+	for n := q.Scale.Min; n <= q.Scale.Max; n++ {
+		text := strconv.Itoa(n)
+		if n == q.Scale.Min && q.Scale.MinLabel != "" {
+			text += " - " + q.Scale.MinLabel
+		}
+		if n == q.Scale.Max && q.Scale.MaxLabel != "" {
+			text += " - " + q.Scale.MaxLabel
+		}
+		option := slack.NewOptionBlockObject(strconv.Itoa(n), plainText(text), nil)
+		if n == initial {
+			selected = option
+		}
+		options = append(options, option)
+	}
+
+	element := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, plainText("Choose a rating"), q.actionID(), options...)
+	element.InitialOption = selected
+	return element
+}
+
+func (q Question) choiceElement(initial []string) slack.BlockElement {
+	chosen := make(map[string]bool, len(initial))
+	for _, c := range initial {
+		chosen[c] = true
+	}
+
+	var options, selected []*slack.OptionBlockObject
+	for _, o := range q.Options {
+		option := slack.NewOptionBlockObject(o, plainText(o), nil)
+		if chosen[o] {
+			selected = append(selected, option)
+		}
+		options = append(options, option)
+	}
+
+	switch {
+	case q.Multiple && len(options) <= maxCheckboxes:
+		element := slack.NewCheckboxGroupsBlockElement(q.actionID(), options...)
+		element.InitialOptions = selected
+		return element
+	case q.Multiple:
+		element := slack.NewOptionsMultiSelectBlockElement(slack.MultiOptTypeStatic, plainText("Choose any"), q.actionID(), options...)
+		element.InitialOptions = selected
+		return element
+	default:
+		element := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, plainText("Choose one"), q.actionID(), options...)
+		if len(selected) > 0 {
+			element.InitialOption = selected[0]
+		}
+		return element
+	}
+}
+
+func selectedRating(action slack.BlockAction) int {
+	n, _ := strconv.Atoi(action.SelectedOption.Value)
+	return n
+}
+
+// plainText returns nil for an empty string so optional text fields are
+// left out of the view.
+func plainText(text string) *slack.TextBlockObject {
+	if text == "" {
+		return nil
+	}
+	return slack.NewTextBlockObject(slack.PlainTextType, text, false, false)
+}
@@ -0,0 +1,165 @@
+package reviewtemplate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/slack-go/slack"
+)
+
+// submitted returns the view state Slack would send back for blocks
+// submitted with their initial values.
+func submitted(blocks []slack.Block) map[string]map[string]slack.BlockAction {
+	options := func(selected []*slack.OptionBlockObject) []slack.OptionBlockObject {
+		var values []slack.OptionBlockObject
+		for _, o := range selected {
+			values = append(values, *o)
+		}
+		return values
+	}
+
+	values := make(map[string]map[string]slack.BlockAction)
+	for _, b := range blocks {
+		input := b.(*slack.InputBlock)
+		var action slack.BlockAction
+		switch e := input.Element.(type) {
+		case *slack.PlainTextInputBlockElement:
+			action = slack.BlockAction{ActionID: e.ActionID, Value: e.InitialValue}
+		case *slack.SelectBlockElement:
+			action = slack.BlockAction{ActionID: e.ActionID}
+			if e.InitialOption != nil {
+				action.SelectedOption = *e.InitialOption
+			}
+		case *slack.CheckboxGroupsBlockElement:
+			action = slack.BlockAction{ActionID: e.ActionID, SelectedOptions: options(e.InitialOptions)}
+		case *slack.MultiSelectBlockElement:
+			action = slack.BlockAction{ActionID: e.ActionID, SelectedOptions: options(e.InitialOptions)}
+		}
+		values[input.BlockID] = map[string]slack.BlockAction{action.ActionID: action}
+	}
+	return values
+}
+
+var roundTripTemplate = &Template{ID: "general", Version: 1, Questions: []Question{
+	{ID: "feedback", Type: Text, Label: "Feedback", Required: true},
+	{ID: "overall", Type: Rating, Label: "Overall", Required: true, Scale: Scale{Min: 1, Max: 5, MinLabel: "Poor", MaxLabel: "Great"}},
+	{ID: "team", Type: Choice, Label: "Team", Options: []string{"Sales", "Support"}},
+	{ID: "strengths", Type: Choice, Label: "Strengths", Multiple: true, Options: []string{"Quality", "Speed", "Ideas"}},
+	{ID: "areas", Type: Choice, Label: "Areas", Multiple: true, Options: []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}},
+	{ID: "skills", Type: Competency, Label: "Skills", Scale: Scale{Min: 1, Max: 4}, Competencies: []string{"Ownership", "Communication", "Craft"}},
+}}
+
+func TestBlocks(t *testing.T) {
+	blocks := roundTripTemplate.Blocks(nil)
+	want := []struct {
+		blockID  string
+		optional bool
+		element  slack.MessageElementType
+	}{
+		{"feedback", false, slack.METPlainTextInput},
+		{"overall", false, slack.MessageElementType(slack.OptTypeStatic)},
+		{"team", true, slack.MessageElementType(slack.OptTypeStatic)},
+		{"strengths", true, slack.METCheckboxGroups},
+		{"areas", true, slack.MessageElementType(slack.MultiOptTypeStatic)},
+		{"skills.0", true, slack.MessageElementType(slack.OptTypeStatic)},
+		{"skills.1", true, slack.MessageElementType(slack.OptTypeStatic)},
+		{"skills.2", true, slack.MessageElementType(slack.OptTypeStatic)},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("Blocks() returned %d blocks, want %d", len(blocks), len(want))
+	}
+	for i, w := range want {
+		b := blocks[i].(*slack.InputBlock)
+		if b.BlockID != w.blockID || b.Optional != w.optional || b.Element.ElementType() != w.element {
+			t.Errorf("block %d = %s optional %v %s, want %s optional %v %s", i, b.BlockID, b.Optional, b.Element.ElementType(), w.blockID, w.optional, w.element)
+		}
+	}
+	if label := blocks[5].(*slack.InputBlock).Label.Text; label != "Skills: Ownership" {
+		t.Errorf("competency label = %q", label)
+	}
+	if options := blocks[1].(*slack.InputBlock).Element.(*slack.SelectBlockElement).Options; len(options) != 5 || options[0].Text.Text != "1 - Poor" || options[4].Text.Text != "5 - Great" {
+		t.Errorf("rating options = %+v", options)
+	}
+}
+
+func TestBlocksAnswersRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		answers []storage.Answer
+	}{
+		{"blank", nil},
+		{"everything", []storage.Answer{
+			{QuestionID: "feedback", Type: Text, Label: "Feedback", Text: "Great quarter"},
+			{QuestionID: "overall", Type: Rating, Label: "Overall", Rating: 4, ScaleMax: 5},
+			{QuestionID: "team", Type: Choice, Label: "Team", Choices: []string{"Support"}},
+			{QuestionID: "strengths", Type: Choice, Label: "Strengths", Choices: []string{"Quality", "Ideas"}},
+			{QuestionID: "areas", Type: Choice, Label: "Areas", Choices: []string{"b", "k"}},
+			{QuestionID: "skills", Type: Competency, Label: "Skills", ScaleMax: 4, Ratings: []storage.CompetencyRating{
+				{Competency: "Ownership", Rating: 1},
+				{Competency: "Craft", Rating: 4},
+			}},
+		}},
+		{"some", []storage.Answer{
+			{QuestionID: "feedback", Type: Text, Label: "Feedback", Text: "Thanks"},
+			{QuestionID: "skills", Type: Competency, Label: "Skills", ScaleMax: 4, Ratings: []storage.CompetencyRating{
+				{Competency: "Communication", Rating: 2},
+			}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := roundTripTemplate.Answers(submitted(roundTripTemplate.Blocks(tt.answers)))
+			if !reflect.DeepEqual(got, tt.answers) {
+				t.Fatalf("Answers(Blocks(answers)) = %+v, want %+v", got, tt.answers)
+			}
+		})
+	}
+}
+
+func TestAnswersOfOtherVersions(t *testing.T) {
+	// Answers to questions or options a version no longer has are
+	// dropped, and unanswered text is trimmed away.
+	answers := []storage.Answer{
+		{QuestionID: "feedback", Type: Text, Label: "Feedback", Text: "  "},
+		{QuestionID: "removed", Type: Text, Label: "Removed", Text: "Old"},
+		{QuestionID: "team", Type: Choice, Label: "Team", Choices: []string{"Marketing"}},
+		{QuestionID: "skills", Type: Competency, Label: "Skills", ScaleMax: 4, Ratings: []storage.CompetencyRating{
+			{Competency: "Teamwork", Rating: 3},
+			{Competency: "Craft", Rating: 9},
+		}},
+	}
+	if got := roundTripTemplate.Answers(submitted(roundTripTemplate.Blocks(answers))); got != nil {
+		t.Fatalf("Answers = %+v, want none", got)
+	}
+}
+
+func TestFeedback(t *testing.T) {
+	answers := []storage.Answer{
+		{QuestionID: "overall", Type: Rating, Rating: 3},
+		{QuestionID: FeedbackQuestionID, Type: Text, Text: "Well done"},
+	}
+	if got := Feedback(answers); got != "Well done" {
+		t.Errorf("Feedback = %q", got)
+	}
+	if got := Feedback(answers[:1]); got != "" {
+		t.Errorf("Feedback without a feedback answer = %q", got)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		answer storage.Answer
+		want   string
+	}{
+		{storage.Answer{Type: Text, Text: "Nice"}, "Nice"},
+		{storage.Answer{Type: Rating, Rating: 3, ScaleMax: 5}, "3/5"},
+		{storage.Answer{Type: Choice, Choices: []string{"Quality", "Speed"}}, "Quality, Speed"},
+		{storage.Answer{Type: Competency, ScaleMax: 4, Ratings: []storage.CompetencyRating{{Competency: "Craft", Rating: 2}, {Competency: "Ownership", Rating: 4}}}, "Craft 2/4, Ownership 4/4"},
+	}
+	for _, tt := range tests {
+		if got := Format(tt.answer); got != tt.want {
+			t.Errorf("Format(%+v) = %q, want %q", tt.answer, got, tt.want)
+		}
+	}
+}
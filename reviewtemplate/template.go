@@ -0,0 +1,236 @@
+// Package reviewtemplate loads the YAML review templates that the feedback
+// modal is generated from, and converts between modal state and stored
+// answers.
+package reviewtemplate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Question types.
+const (
+	Text       = "text"
+	Rating     = "rating"
+	Choice     = "choice"
+	Competency = "competency"
+)
+
+// FeedbackQuestionID is the free-text question whose answer is also kept
+// as the review's Feedback.
+const FeedbackQuestionID = "feedback"
+
+// Template is one version of a review form.
+type Template struct {
+	ID        string     `yaml:"id"`
+	Version   int        `yaml:"version"`
+	Name      string     `yaml:"name"`
+	Questions []Question `yaml:"questions"`
+}
+
+// Question is a single item on a review form.
+type Question struct {
+	ID          string `yaml:"id"`
+	Type        string `yaml:"type"`
+	Label       string `yaml:"label"`
+	Hint        string `yaml:"hint"`
+	Placeholder string `yaml:"placeholder"`
+	Required    bool   `yaml:"required"`
+	// Scale applies to rating and competency questions.
+	Scale Scale `yaml:"scale"`
+	// Options and Multiple apply to choice questions.
+	Options  []string `yaml:"options"`
+	Multiple bool     `yaml:"multiple"`
+	// Competencies are each rated on Scale.
+	Competencies []string `yaml:"competencies"`
+}
+
+// Scale is the range of a rating.
+type Scale struct {
+	Min      int    `yaml:"min"`
+	Max      int    `yaml:"max"`
+	MinLabel string `yaml:"min_label"`
+	MaxLabel string `yaml:"max_label"`
+}
+
+// Default is used when no template files are configured. It matches the
+// original single free-text form.
+var Default = &Template{
+	ID:      "default",
+	Version: 1,
+	Name:    "Feedback",
+	Questions: []Question{{
+		ID:          FeedbackQuestionID,
+		Type:        Text,
+		Label:       "Feedback",
+		Placeholder: "Enter your feedback here...",
+		Required:    true,
+	}},
+}
+
+var idPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Set holds every loaded version of every template.
+type Set struct {
+	versions map[string][]*Template // sorted by Version
+}
+
+// NewSet returns a Set holding templates. It fails on invalid templates or
+// duplicate versions.
+func NewSet(templates ...*Template) (*Set, error) {
+	s := &Set{versions: make(map[string][]*Template)}
+	for _, t := range templates {
+		if err := t.validate(); err != nil {
+			return nil, err
+		}
+		if s.Get(t.ID, t.Version) != nil {
+			return nil, fmt.Errorf("template %s version %d is defined twice", t.ID, t.Version)
+		}
+		s.versions[t.ID] = append(s.versions[t.ID], t)
+		sort.Slice(s.versions[t.ID], func(i, j int) bool {
+			return s.versions[t.ID][i].Version < s.versions[t.ID][j].Version
+		})
+	}
+	return s, nil
+}
+
+// Load reads every *.yaml file in dir. A file may hold one template or,
+// as separate YAML documents, several versions of it.
+func Load(dir string) (*Set, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []*Template
+	for _, path := range paths {
+		parsed, err := loadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		templates = append(templates, parsed...)
+	}
+
+	return NewSet(templates...)
+}
+
+// loadFile decodes every YAML document in path, skipping empty ones.
+func loadFile(path string) ([]*Template, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d := yaml.NewDecoder(f)
+	d.SetStrict(true)
+	var templates []*Template
+	for {
+		var t *Template
+		err := d.Decode(&t)
+		if err == io.EOF {
+			return templates, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			templates = append(templates, t)
+		}
+	}
+}
+
+// Get returns a specific version of a template, or nil.
+func (s *Set) Get(id string, version int) *Template {
+	for _, t := range s.versions[id] {
+		if t.Version == version {
+			return t
+		}
+	}
+	return nil
+}
+
+// Latest returns the newest version of a template, or nil.
+func (s *Set) Latest(id string) *Template {
+	versions := s.versions[id]
+	if len(versions) == 0 {
+		return nil
+	}
+	return versions[len(versions)-1]
+}
+
+// Resolve returns the requested version of a template if it is still
+// loaded, and its latest version otherwise.
+func (s *Set) Resolve(id string, version int) *Template {
+	if t := s.Get(id, version); t != nil {
+		return t
+	}
+	return s.Latest(id)
+}
+
+// IDs returns the ID of every loaded template, sorted.
+func (s *Set) IDs() []string {
+	ids := make([]string, 0, len(s.versions))
+	for id := range s.versions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (t *Template) validate() error {
+	if !idPattern.MatchString(t.ID) {
+		return fmt.Errorf("template id %q must be lowercase letters, digits and underscores", t.ID)
+	}
+	if t.Version < 1 {
+		return fmt.Errorf("template %s: version must be at least 1", t.ID)
+	}
+	if len(t.Questions) == 0 {
+		return fmt.Errorf("template %s version %d has no questions", t.ID, t.Version)
+	}
+
+	seen := make(map[string]bool)
+	for _, q := range t.Questions {
+		where := fmt.Sprintf("template %s version %d question %q", t.ID, t.Version, q.ID)
+		if !idPattern.MatchString(q.ID) {
+			return fmt.Errorf("%s: id must be lowercase letters, digits and underscores", where)
+		}
+		if seen[q.ID] {
+			return fmt.Errorf("%s: duplicate id", where)
+		}
+		seen[q.ID] = true
+
+		if q.Label == "" {
+			return fmt.Errorf("%s: label is required", where)
+		}
+
+		switch q.Type {
+		case Text:
+		case Rating, Competency:
+			if q.Scale.Min < 1 || q.Scale.Min >= q.Scale.Max || q.Scale.Max-q.Scale.Min >= 100 {
+				return fmt.Errorf("%s: scale must run from at least 1 up to at most 100 points", where)
+			}
+			if q.Type == Competency && len(q.Competencies) == 0 {
+				return fmt.Errorf("%s: competencies are required", where)
+			}
+		case Choice:
+			if len(q.Options) == 0 || len(q.Options) > 100 {
+				return fmt.Errorf("%s: between 1 and 100 options are required", where)
+			}
+			for _, o := range q.Options {
+				if len(o) > 75 {
+					return fmt.Errorf("%s: option %q is longer than 75 characters", where, o)
+				}
+			}
+		default:
+			return fmt.Errorf("%s: unknown type %q", where, q.Type)
+		}
+	}
+	return nil
+}
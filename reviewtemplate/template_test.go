@@ -0,0 +1,183 @@
+package reviewtemplate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func validTemplate() *Template {
+	return &Template{ID: "general", Version: 1, Questions: []Question{
+		{ID: "feedback", Type: Text, Label: "Feedback"},
+		{ID: "overall", Type: Rating, Label: "Overall", Scale: Scale{Min: 1, Max: 5}},
+		{ID: "skills", Type: Competency, Label: "Skills", Scale: Scale{Min: 1, Max: 3}, Competencies: []string{"Ownership"}},
+		{ID: "strengths", Type: Choice, Label: "Strengths", Options: []string{"Quality"}},
+	}}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Template)
+		err    string
+	}{
+		{"valid", func(*Template) {}, ""},
+		{"template id", func(t *Template) { t.ID = "General" }, "template id"},
+		{"version", func(t *Template) { t.Version = 0 }, "version must be at least 1"},
+		{"no questions", func(t *Template) { t.Questions = nil }, "has no questions"},
+		{"question id", func(t *Template) { t.Questions[0].ID = "feed back" }, "id must be"},
+		{"duplicate id", func(t *Template) { t.Questions[1].ID = "feedback" }, "duplicate id"},
+		{"label", func(t *Template) { t.Questions[0].Label = "" }, "label is required"},
+		{"unknown type", func(t *Template) { t.Questions[0].Type = "essay" }, `unknown type "essay"`},
+		{"scale from zero", func(t *Template) { t.Questions[1].Scale.Min = 0 }, "scale must run"},
+		{"empty scale", func(t *Template) { t.Questions[1].Scale.Max = 1 }, "scale must run"},
+		{"longest scale", func(t *Template) { t.Questions[1].Scale.Max = 100 }, ""},
+		{"scale too long", func(t *Template) { t.Questions[1].Scale.Max = 101 }, "scale must run"},
+		{"competency scale", func(t *Template) { t.Questions[2].Scale = Scale{} }, "scale must run"},
+		{"no competencies", func(t *Template) { t.Questions[2].Competencies = nil }, "competencies are required"},
+		{"no options", func(t *Template) { t.Questions[3].Options = nil }, "between 1 and 100 options"},
+		{"too many options", func(t *Template) { t.Questions[3].Options = make([]string, 101) }, "between 1 and 100 options"},
+		{"long option", func(t *Template) { t.Questions[3].Options = []string{strings.Repeat("x", 76)} }, "longer than 75 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := validTemplate()
+			tt.modify(template)
+			err := template.validate()
+			if tt.err == "" && err != nil {
+				t.Fatalf("validate() = %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("validate() = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const general1 = `id: general
+version: 1
+questions:
+  - id: feedback
+    type: text
+    label: Feedback
+    hint: |
+      What went well?
+      ---
+      What could be better?
+`
+
+const general2 = `# Version 2 adds a rating.
+id: general
+version: 2
+questions:
+  - id: feedback
+    type: text
+    label: Feedback
+  - id: overall
+    type: rating
+    label: Overall
+    scale: {min: 1, max: 5}
+`
+
+const peer = `id: peer
+version: 3
+questions: [{id: feedback, type: text, label: Peer feedback}]
+`
+
+func writeTemplates(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"general.yaml": "---\n" + general1 + "...\n---\n\n---\n" + general2,
+		"peer.yaml":    peer,
+		"notes.txt":    "not a template",
+	})
+	set, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := set.IDs(); strings.Join(ids, ",") != "general,peer" {
+		t.Fatalf("IDs() = %v", ids)
+	}
+	v1 := set.Get("general", 1)
+	if v1 == nil || len(v1.Questions) != 1 || v1.Questions[0].Hint != "What went well?\n---\nWhat could be better?\n" {
+		t.Fatalf("version 1 = %+v", v1)
+	}
+	if v2 := set.Latest("general"); v2 == nil || v2.Version != 2 || v2.Questions[1].Scale.Max != 5 {
+		t.Fatalf("Latest(general) = %+v", v2)
+	}
+	if p := set.Latest("peer"); p == nil || p.Version != 3 || p.Questions[0].Label != "Peer feedback" {
+		t.Fatalf("Latest(peer) = %+v", p)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{"unknown field", map[string]string{"general.yaml": general1 + "colour: blue\n"}, "parsing"},
+		{"unknown field in a later version", map[string]string{"general.yaml": general1 + "---\n" + strings.Replace(general2, "label: Overall", "lable: Overall", 1)}, "parsing"},
+		{"invalid", map[string]string{"general.yaml": "id: general\nversion: 1\n"}, "has no questions"},
+		{"same version twice", map[string]string{"general.yaml": general1, "copy.yaml": general1}, "defined twice"},
+		{"malformed", map[string]string{"general.yaml": "id: [general\n"}, "parsing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeTemplates(t, tt.files))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Load() = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	v2 := &Template{ID: "general", Version: 2, Questions: validTemplate().Questions}
+	v4 := &Template{ID: "general", Version: 4, Questions: validTemplate().Questions}
+	set, err := NewSet(v4, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id      string
+		version int
+		want    *Template
+	}{
+		{"general", 2, v2},
+		{"general", 4, v4},
+		// Reviews written with a version that is no longer loaded are
+		// shown with the latest one.
+		{"general", 1, v4},
+		{"general", 3, v4},
+		{"general", 0, v4},
+		{"peer", 1, nil},
+	}
+	for _, tt := range tests {
+		if got := set.Resolve(tt.id, tt.version); got != tt.want {
+			t.Errorf("Resolve(%s, %d) = %+v, want %+v", tt.id, tt.version, got, tt.want)
+		}
+	}
+	if got := set.Get("general", 3); got != nil {
+		t.Errorf("Get(general, 3) = %+v", got)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/slack-go/slack"
+)
+
+// maxSuggestions is the most options Slack accepts in a block_suggestion
+// response.
+const maxSuggestions = 100
+
+// syncRosters syncs the roster and user group roles of every installed
+// team. It returns the errors of every team that could not be synced.
+func syncRosters(ctx context.Context) error {
+	teamIDs, err := store.ListTeamIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list teams: %w", err)
+	}
+
+	var errs []error
+	for _, teamID := range teamIDs {
+		if err := syncRoster(ctx, teamID); err != nil {
+			log.Printf("Error syncing roster for team %s: %v", teamID, err)
+			errs = append(errs, fmt.Errorf("team %s: %w", teamID, err))
+		}
+		if err := syncGroupRoles(ctx, teamID); err != nil {
+			log.Printf("Error syncing user group roles for team %s: %v", teamID, err)
+			errs = append(errs, fmt.Errorf("team %s: %w", teamID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// syncRoster replaces the stored roster of teamID with its current members
+// from users.list, leaving out bots, deactivated accounts and guests.
+func syncRoster(ctx context.Context, teamID string) error {
+	client, err := slackClients.Client(teamID)
+	if err != nil {
+		return err
+	}
+
+	users, err := client.GetUsersContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var members []storage.RosterMember
+	for _, u := range users {
+		if u.Deleted || u.IsBot || u.IsAppUser || u.IsRestricted || u.IsUltraRestricted || u.ID == "USLACKBOT" {
+			continue
+		}
+
+		name := u.Profile.DisplayName
+		if name == "" {
+			name = u.Name
+		}
+		members = append(members, storage.RosterMember{
+			TeamID:     teamID,
+			UserID:     u.ID,
+			Name:       name,
+			RealName:   u.RealName,
+			SearchText: strings.ToLower(name + " " + u.RealName),
+		})
+	}
+
+	if err := store.ReplaceRoster(ctx, teamID, members); err != nil {
+		return err
+	}
+	rosterSizes.Store(teamID, len(members))
+
+	log.Printf("Synced %d roster members for team %s", len(members), teamID)
+	return nil
+}
+
+// rosterSizes caches the number of roster members of each team, which
+// only changes when the roster is synced.
+var rosterSizes sync.Map
+
+// rosterSize returns the number of roster members of teamID, counting
+// them in storage the first time.
+func rosterSize(ctx context.Context, teamID string) (int, error) {
+	if n, ok := rosterSizes.Load(teamID); ok {
+		return n.(int), nil
+	}
+	n, err := store.CountRoster(ctx, teamID)
+	if err != nil {
+		return 0, err
+	}
+	rosterSizes.Store(teamID, n)
+	return n, nil
+}
+
+// rosterOption renders m as a select menu option whose value is the Slack
+// user ID.
+func rosterOption(m storage.RosterMember) *slack.OptionBlockObject {
+	label := m.Name
+	if m.RealName != "" && m.RealName != m.Name {
+		label = m.Name + " (" + m.RealName + ")"
+	}
+	return slack.NewOptionBlockObject(m.UserID, slack.NewTextBlockObject("plain_text", label, false, false), nil)
+}
+
+// employeeSuggestionHandler answers the type-ahead search of the
+// employee_select external select from the stored roster.
+func employeeSuggestionHandler(w http.ResponseWriter, r *http.Request, teamID, query string) {
+	members, err := store.SearchRoster(r.Context(), teamID, strings.ToLower(strings.TrimSpace(query)), maxSuggestions)
+	if err != nil {
+		log.Printf("Error searching roster: %v", err)
+		http.Error(w, "Failed to search roster", http.StatusInternalServerError)
+		return
+	}
+
+	response := slack.OptionsResponse{Options: make([]*slack.OptionBlockObject, 0, len(members))}
+	for _, m := range members {
+		response.Options = append(response.Options, rosterOption(m))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error writing suggestions: %v", err)
+	}
+}
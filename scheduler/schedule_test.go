@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNext(t *testing.T) {
+	// Monday 15 January 2024.
+	from := time.Date(2024, 1, 15, 10, 7, 30, 0, time.UTC)
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2024, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"10h", from, from.Add(10 * time.Hour)},
+		{" 5m ", from, from.Add(5 * time.Minute)},
+		{"@every 90s", from, from.Add(90 * time.Second)},
+		{"@hourly", from, at(1, 15, 11, 0)},
+		{"@daily", from, at(1, 16, 0, 0)},
+		{"@midnight", from, at(1, 16, 0, 0)},
+		{"@weekly", from, at(1, 21, 0, 0)},
+		{"* * * * *", from, at(1, 15, 10, 8)},
+		{"*/15 * * * *", from, at(1, 15, 10, 15)},
+		{"*/15 * * * *", at(1, 15, 10, 15), at(1, 15, 10, 30)},
+		{"5/20 * * * *", from, at(1, 15, 10, 25)},
+		{"5,10 8 * * *", from, at(1, 16, 8, 5)},
+		{"30 9 * * 1-5", from, at(1, 16, 9, 30)},
+		{"30 9 * * 1-5", time.Date(2024, 1, 19, 10, 0, 0, 0, time.UTC), at(1, 22, 9, 30)},
+		{"0 0 1 * *", from, at(2, 1, 0, 0)},
+		{"0 0 * * 0", from, at(1, 21, 0, 0)},
+		{"0 0 * * 7", from, at(1, 21, 0, 0)},
+		{"0 0 29 2 *", from, at(2, 29, 0, 0)},
+		{"0 0 1 */3 *", from, at(4, 1, 0, 0)},
+		// With both day fields restricted, either one matching is enough.
+		{"0 12 13 * 5", from, at(1, 19, 12, 0)},
+		{"0 12 16 * 5", from, at(1, 16, 12, 0)},
+		// An impossible date gives up five years ahead.
+		{"0 0 31 2 *", from, time.Date(2029, 1, 15, 10, 8, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.spec, err)
+			}
+			if got := s.Next(tt.from); !got.Equal(tt.want) {
+				t.Fatalf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"0s",
+		"-5m",
+		"@every",
+		"@every soon",
+		"@yearly",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1-x * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+	}
+	for _, spec := range tests {
+		t.Run(spec, func(t *testing.T) {
+			if s, err := Parse(spec); err == nil {
+				t.Fatalf("Parse(%q) = %v, want an error", spec, s)
+			}
+		})
+	}
+}
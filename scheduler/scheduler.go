@@ -0,0 +1,203 @@
+// Package scheduler runs named background jobs on interval or cron
+// schedules. Failed runs are retried with exponential backoff, and the
+// last success of each job is persisted so a restart does not rerun jobs
+// that are not due.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+)
+
+// Default backoff after a failed run.
+const (
+	DefaultRetryBase = time.Minute
+	DefaultRetryMax  = time.Hour
+)
+
+// Job is a named task run on a schedule.
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Run      func(ctx context.Context) error
+	// Jitter delays each scheduled run by a random duration up to Jitter,
+	// so instances sharing a schedule do not all call Slack at once.
+	Jitter time.Duration
+	// RetryBase and RetryMax bound the exponential backoff after a failed
+	// run. A retry is never later than the next scheduled run.
+	RetryBase time.Duration
+	RetryMax  time.Duration
+}
+
+// Scheduler runs registered jobs until its context is done.
+type Scheduler struct {
+	store storage.JobStore
+
+	mu      sync.Mutex
+	jobs    map[string]*entry
+	started bool
+	wg      sync.WaitGroup
+}
+
+type entry struct {
+	job     Job
+	trigger chan struct{}
+}
+
+// New returns a Scheduler that persists job state in store.
+func New(store storage.JobStore) *Scheduler {
+	return &Scheduler{
+		store: store,
+		jobs:  make(map[string]*entry),
+	}
+}
+
+// Register adds job. Jobs must be registered before Start.
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Schedule == nil || job.Run == nil {
+		return errors.New("job needs a name, a schedule and a run function")
+	}
+	if job.RetryBase <= 0 {
+		job.RetryBase = DefaultRetryBase
+	}
+	if job.RetryMax <= 0 {
+		job.RetryMax = DefaultRetryMax
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return fmt.Errorf("job %s registered after the scheduler started", job.Name)
+	}
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+	s.jobs[job.Name] = &entry{job: job, trigger: make(chan struct{}, 1)}
+	return nil
+}
+
+// Start runs every registered job in its own goroutine until ctx is done.
+// A job that never succeeded, or whose next run was missed while the bot
+// was down, runs right away.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.started = true
+	for _, e := range s.jobs {
+		e := e
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.loop(ctx, e)
+		}()
+	}
+}
+
+// Wait blocks until every job has returned after the context passed to
+// Start is done.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// Trigger runs the job called name as soon as it is idle, without jitter.
+// Triggers made while it is running are merged into one extra run.
+func (s *Scheduler) Trigger(name string) {
+	s.mu.Lock()
+	e, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case e.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	job := e.job
+
+	run, err := s.store.GetJobRun(ctx, job.Name)
+	if err != nil {
+		log.Printf("Error loading state of job %s: %v", job.Name, err)
+		run = &storage.JobRun{Name: job.Name}
+	}
+
+	next := time.Now()
+	if run.LastSuccess != 0 {
+		next = job.Schedule.Next(time.Unix(run.LastSuccess, 0))
+	}
+
+	for {
+		wait := time.Until(next)
+		if job.Jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(job.Jitter)))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-e.trigger:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		start := time.Now()
+		err := runJob(ctx, job)
+		if ctx.Err() != nil {
+			return
+		}
+
+		next = job.Schedule.Next(start)
+		if err == nil {
+			run.LastSuccess = start.Unix()
+			run.Failures = 0
+			run.LastError = ""
+		} else {
+			run.Failures++
+			run.LastError = err.Error()
+			retry := start.Add(backoff(job, run.Failures))
+			if retry.Before(next) {
+				next = retry
+			}
+			log.Printf("Job %s failed (%d in a row), retrying at %s: %v", job.Name, run.Failures, next.Format(time.RFC3339), err)
+		}
+
+		if err := s.store.PutJobRun(ctx, run); err != nil {
+			log.Printf("Error saving state of job %s: %v", job.Name, err)
+		}
+	}
+}
+
+// runJob runs job once, reporting a panic as an error so one bad run does
+// not stop the job for good.
+func runJob(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// backoff is the delay after the given number of consecutive failures.
+func backoff(job Job, failures int) time.Duration {
+	delay := job.RetryBase
+	for i := 1; i < failures && delay < job.RetryMax; i++ {
+		delay *= 2
+	}
+	if delay > job.RetryMax {
+		delay = job.RetryMax
+	}
+	return delay
+}
@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+)
+
+func TestBackoff(t *testing.T) {
+	job := Job{RetryBase: time.Minute, RetryMax: time.Hour}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := backoff(job, tt.failures); got != tt.want {
+			t.Errorf("backoff after %d failures = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+
+	// A base above the maximum is capped too.
+	if got := backoff(Job{RetryBase: time.Hour, RetryMax: time.Minute}, 1); got != time.Minute {
+		t.Errorf("backoff with base above max = %s, want %s", got, time.Minute)
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name    string
+		run     func(context.Context) error
+		wantErr bool
+	}{
+		{"success", func(context.Context) error { return nil }, false},
+		{"error", func(context.Context) error { return failed }, true},
+		{"panic", func(context.Context) error { panic("boom") }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runJob(context.Background(), Job{Name: tt.name, Run: tt.run})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runJob = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	run := func(context.Context) error { return nil }
+	s := New(storage.NewMemoryStore())
+
+	tests := []struct {
+		name    string
+		job     Job
+		wantErr bool
+	}{
+		{"valid", Job{Name: "a", Schedule: Every(time.Minute), Run: run}, false},
+		{"duplicate", Job{Name: "a", Schedule: Every(time.Minute), Run: run}, true},
+		{"no name", Job{Schedule: Every(time.Minute), Run: run}, true},
+		{"no schedule", Job{Name: "b", Run: run}, true},
+		{"no run", Job{Name: "c", Schedule: Every(time.Minute)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Register(tt.job); (err != nil) != tt.wantErr {
+				t.Fatalf("Register = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if e := s.jobs["a"]; e.job.RetryBase != DefaultRetryBase || e.job.RetryMax != DefaultRetryMax {
+		t.Errorf("retry bounds = %s, %s; want the defaults", e.job.RetryBase, e.job.RetryMax)
+	}
+}
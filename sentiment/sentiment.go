@@ -0,0 +1,125 @@
+// Package sentiment scores text with a word lexicon, without calling any
+// external service.
+package sentiment
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//go:embed lexicon.tsv
+var defaultLexicon string
+
+// normalization controls how quickly the summed word scores approach the
+// ends of the scale.
+const normalization = 15
+
+// negationWindow is how many words after a negator have their score
+// flipped.
+const negationWindow = 3
+
+var negators = map[string]bool{
+	"not": true, "no": true, "never": true, "none": true, "nothing": true,
+	"neither": true, "nor": true, "without": true, "hardly": true, "barely": true,
+	"isn't": true, "wasn't": true, "aren't": true, "weren't": true, "don't": true,
+	"doesn't": true, "didn't": true, "can't": true, "cannot": true, "couldn't": true,
+	"won't": true, "wouldn't": true, "shouldn't": true,
+}
+
+// Lexicon maps lowercase words to scores, conventionally from -5 to 5.
+type Lexicon struct {
+	words map[string]float64
+}
+
+// Default returns the lexicon bundled with the bot.
+func Default() *Lexicon {
+	l, err := Parse(strings.NewReader(defaultLexicon))
+	if err != nil {
+		panic(fmt.Sprintf("bundled lexicon is invalid: %v", err))
+	}
+	return l
+}
+
+// Load reads a lexicon file.
+func Load(path string) (*Lexicon, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	l, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing lexicon %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Parse reads a lexicon with one tab-separated word and score per line.
+// Blank lines and lines starting with # are ignored.
+func Parse(r io.Reader) (*Lexicon, error) {
+	l := &Lexicon{words: make(map[string]float64)}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want word<TAB>score", line)
+		}
+		score, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		l.words[strings.ToLower(strings.TrimSpace(fields[0]))] = score
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(l.words) == 0 {
+		return nil, fmt.Errorf("lexicon is empty")
+	}
+	return l, nil
+}
+
+// Score rates text from -1 (very negative) to 1 (very positive). Words
+// shortly after a negator such as "not" count with the opposite sign.
+func (l *Lexicon) Score(text string) float64 {
+	// Slack often sends typographic apostrophes, as in "don’t".
+	text = strings.ReplaceAll(strings.ToLower(text), "’", "'")
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+
+	sum := 0.0
+	negated := 0
+	for _, w := range words {
+		w = strings.Trim(w, "'")
+		if negators[w] {
+			negated = negationWindow
+			continue
+		}
+		if score, ok := l.words[w]; ok {
+			if negated > 0 {
+				score = -score
+			}
+			sum += score
+		}
+		if negated > 0 {
+			negated--
+		}
+	}
+
+	return sum / math.Sqrt(sum*sum+normalization)
+}
@@ -0,0 +1,83 @@
+package sentiment
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{"valid", "# comment\n\nGood\t2\nbad\t-3.5\n", false},
+		{"no tab", "good 2\n", true},
+		{"extra field", "good\t2\t3\n", true},
+		{"bad score", "good\thigh\n", true},
+		{"empty", "# nothing here\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.in))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	l, err := Parse(strings.NewReader("good\t2\nbad\t-3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	norm := func(sum float64) float64 { return sum / math.Sqrt(sum*sum+normalization) }
+
+	tests := []struct {
+		text string
+		want float64
+	}{
+		{"", 0},
+		{"nothing scored here", 0},
+		{"good", norm(2)},
+		{"Good, GOOD!", norm(4)},
+		{"'good'", norm(2)},
+		{"bad", norm(-3)},
+		{"good but bad", norm(-1)},
+		{"not good", norm(-2)},
+		{"not very good", norm(-2)},
+		{"not very very very good", norm(2)},
+		{"don’t think it was bad", norm(-3)},
+		{"don’t think bad", norm(3)},
+		{"never bad", norm(3)},
+		{"never bad, always good", norm(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := l.Score(tt.text); math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("Score(%q) = %f, want %f", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultLexicon(t *testing.T) {
+	l := Default()
+	tests := []struct {
+		text     string
+		positive bool
+	}{
+		{"Excellent work, really helpful in every review.", true},
+		{"Rude in meetings and often late.", false},
+		{"The handover was not good.", false},
+		{"Never rude, always helpful.", true},
+	}
+	for _, tt := range tests {
+		score := l.Score(tt.text)
+		if score < -1 || score > 1 || (score > 0) != tt.positive {
+			t.Errorf("Score(%q) = %f, want positive %v within [-1, 1]", tt.text, score, tt.positive)
+		}
+	}
+}
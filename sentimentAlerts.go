@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/BigPhatNerd/cbaseSLACK/sentiment"
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+)
+
+// lexicon scores new and edited reviews.
+var lexicon *sentiment.Lexicon
+
+// loadLexicon loads sentiment.LEXICON_FILE, or the bundled lexicon if it
+// is not set.
+func loadLexicon() (*sentiment.Lexicon, error) {
+	if configure.Sentiment.LexiconFile == "" {
+		return sentiment.Default(), nil
+	}
+	return sentiment.Load(configure.Sentiment.LexiconFile)
+}
+
+func negativeThreshold() float64 {
+	if configure.Sentiment.NegativeThreshold != 0 {
+		return configure.Sentiment.NegativeThreshold
+	}
+	return -0.5
+}
+
+func alertRun() int {
+	if configure.Sentiment.AlertRun > 0 {
+		return configure.Sentiment.AlertRun
+	}
+	return 3
+}
+
+// scoreReview sets the sentiment of review from all of its text.
+func scoreReview(review *storage.Review) {
+	var texts []string
+	for _, a := range reviewAnswers(*review) {
+		if a.Text != "" {
+			texts = append(texts, a.Text)
+		}
+	}
+	score := lexicon.Score(strings.Join(texts, "\n"))
+	review.Sentiment = &score
+}
+
+// stronglyNegative reports whether r scored at or below the threshold.
+func stronglyNegative(r storage.Review) bool {
+	return r.Sentiment != nil && *r.Sentiment <= negativeThreshold()
+}
+
+// checkNegativeRun alerts the manager of revieweeID when their latest
+// approved reviews are a run of strongly negative ones. It alerts once,
+// when the run reaches the configured length, and marks the newest review
+// of the run so that editing or approving its reviews does not alert
+// again.
+func checkNegativeRun(teamID, revieweeID string) {
+	if revieweeID == "" {
+		return
+	}
+	manager := configure.Org.Managers[revieweeID]
+	if manager == "" {
+		return
+	}
+
+	ctx := context.TODO()
+	run := alertRun()
+	latest, err := latestApprovedReviews(ctx, teamID, revieweeID, run+1)
+	if err != nil {
+		log.Printf("Error loading reviews of %s: %v", revieweeID, err)
+		return
+	}
+
+	negative := 0
+	for _, r := range latest {
+		if !stronglyNegative(r) {
+			break
+		}
+		if r.NegativeAlerted {
+			return
+		}
+		negative++
+	}
+	if negative != run {
+		return
+	}
+
+	// Marking the review first keeps other instances, and edits made
+	// meanwhile, from alerting about the same run.
+	newest := latest[0]
+	newest.NegativeAlerted = true
+	ok, err := store.ReplaceReview(ctx, &newest, newest.Revision)
+	if err != nil {
+		log.Printf("Error marking review %s as alerted: %v", newest.SubmissionID, err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	text := fmt.Sprintf("<@%s> has received %d strongly negative reviews in a row. It may be a good time to check in with them.", revieweeID, run)
+	if err := enqueueMessage(ctx, teamID, manager, text, nil); err != nil {
+		log.Printf("Error queueing alert about %s: %v", revieweeID, err)
+		return
+	}
+	log.Printf("Alerted %s about negative feedback for %s", manager, revieweeID)
+}
+
+// latestApprovedReviews returns up to n of the newest approved reviews of
+// revieweeID, reading further pages for as long as they are needed.
+func latestApprovedReviews(ctx context.Context, teamID, revieweeID string, n int) ([]storage.Review, error) {
+	q := storage.ReviewQuery{
+		TeamID:       teamID,
+		RevieweeID:   revieweeID,
+		ApprovedOnly: true,
+		Limit:        n,
+	}
+	var reviews []storage.Review
+	for len(reviews) < n {
+		page, err := store.QueryReviews(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, page.Reviews...)
+		if page.Next == "" {
+			break
+		}
+		q.Cursor = page.Next
+	}
+	if len(reviews) > n {
+		reviews = reviews[:n]
+	}
+	return reviews, nil
+}
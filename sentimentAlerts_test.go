@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/scheduler"
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+)
+
+// queuedMessages returns the messages waiting in the outbox of the test
+// store.
+func queuedMessages(t *testing.T) []storage.OutboxMessage {
+	t.Helper()
+	messages, err := store.DueOutbox(context.Background(), time.Now().Add(time.Minute).Unix(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+// testJobs gives enqueueMessage a scheduler to trigger for the length of
+// the test.
+func testJobs(t *testing.T) {
+	previous := jobs
+	t.Cleanup(func() { jobs = previous })
+	jobs = scheduler.New(storage.NewMemoryStore())
+}
+
+func TestCheckNegativeRun(t *testing.T) {
+	previous := configure
+	t.Cleanup(func() { configure = previous })
+	configure.Org.Managers = map[string]string{"U2": "M1"}
+	configure.Sentiment.NegativeThreshold = 0
+	configure.Sentiment.AlertRun = 3
+
+	score := func(s float64) *float64 { return &s }
+	review := func(id, day string, sentiment float64, status string) storage.Review {
+		return storage.Review{
+			SubmissionID: id, TeamID: "T1", RevieweeID: "U2",
+			Timestamp: "2024-01-" + day + "T00:00:00Z",
+			Sentiment: score(sentiment), Status: status,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		reviews []storage.Review
+		alerted string
+	}{
+		{"run", []storage.Review{
+			review("S1", "01", 0.5, ""),
+			review("S2", "02", -0.9, ""),
+			review("S3", "03", -0.9, storage.StatusApproved),
+			review("S4", "04", -0.6, ""),
+		}, "S4"},
+		{"too short", []storage.Review{
+			review("S1", "01", 0.5, ""),
+			review("S2", "02", -0.9, ""),
+			review("S3", "03", -0.9, ""),
+		}, ""},
+		// Only approved reviews count, however many others are between.
+		{"past unapproved", []storage.Review{
+			review("S1", "01", -0.9, ""),
+			review("S2", "02", 0.9, storage.StatusRejected),
+			review("S3", "03", 0.9, storage.StatusPending),
+			review("S4", "04", 0.9, storage.StatusChangesRequested),
+			review("S5", "05", -0.9, ""),
+			review("S6", "06", 0.9, storage.StatusPending),
+			review("S7", "07", -0.9, ""),
+		}, "S7"},
+		{"broken by a positive review", []storage.Review{
+			review("S1", "01", -0.9, ""),
+			review("S2", "02", -0.9, ""),
+			review("S3", "03", 0.2, ""),
+			review("S4", "04", -0.9, ""),
+		}, ""},
+		{"longer than the run", []storage.Review{
+			review("S1", "01", -0.9, ""),
+			review("S2", "02", -0.9, ""),
+			review("S3", "03", -0.9, ""),
+			review("S4", "04", -0.9, ""),
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exportStore(t, tt.reviews...)
+			testJobs(t)
+			checkNegativeRun("T1", "U2")
+
+			messages := queuedMessages(t)
+			if tt.alerted == "" && len(messages) != 0 {
+				t.Errorf("alerted with %+v", messages)
+			}
+			if tt.alerted != "" && (len(messages) != 1 || messages[0].Channel != "M1" || messages[0].TeamID != "T1") {
+				t.Errorf("queued %+v, want one alert to M1", messages)
+			}
+			for _, r := range tt.reviews {
+				got, err := store.GetReview(context.Background(), r.SubmissionID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := r.SubmissionID == tt.alerted; got.NegativeAlerted != want {
+					t.Errorf("review %s NegativeAlerted = %v, want %v", r.SubmissionID, got.NegativeAlerted, want)
+				}
+			}
+		})
+	}
+}
+
+// TestCheckNegativeRunOnce checks that checking an alerted run again, as
+// an edit of one of its reviews does, does not alert about it twice.
+func TestCheckNegativeRunOnce(t *testing.T) {
+	previous := configure
+	t.Cleanup(func() { configure = previous })
+	configure.Org.Managers = map[string]string{"U2": "M1"}
+	configure.Sentiment.AlertRun = 2
+
+	score := -0.9
+	exportStore(t,
+		storage.Review{SubmissionID: "S1", TeamID: "T1", RevieweeID: "U2", Timestamp: "2024-01-01T00:00:00Z", Sentiment: &score},
+		storage.Review{SubmissionID: "S2", TeamID: "T1", RevieweeID: "U2", Timestamp: "2024-01-02T00:00:00Z", Sentiment: &score, NegativeAlerted: true, Revision: 1},
+	)
+	testJobs(t)
+	checkNegativeRun("T1", "U2")
+
+	if messages := queuedMessages(t); len(messages) != 0 {
+		t.Errorf("alerted again with %+v", messages)
+	}
+
+	for _, id := range []string{"S1", "S2"} {
+		r, err := store.GetReview(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Revision != map[string]int{"S1": 0, "S2": 1}[id] || r.NegativeAlerted != (id == "S2") {
+			t.Errorf("review %s was changed to %+v", id, r)
+		}
+	}
+}
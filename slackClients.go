@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+// slackClients provides the bot client of every team to all handlers and
+// jobs.
+var slackClients = &clientProvider{}
+
+// clientProvider keeps one bot client per team, built from the stored
+// token on first use. Whenever a token is refreshed the client is swapped
+// atomically, so callers never keep using a stale token; a call already
+// holding the old client is retried with the new token by botHTTPClient.
+type clientProvider struct {
+	// clients maps a team ID to its *teamClient.
+	clients sync.Map
+}
+
+type teamClient struct {
+	token  string
+	client *slack.Client
+}
+
+func newTeamClient(teamID, token string) *teamClient {
+	return &teamClient{
+		token:  token,
+		client: slack.New(token, slack.OptionHTTPClient(newBotHTTPClient(teamID, token))),
+	}
+}
+
+// Client returns a client that acts as the bot installed in teamID.
+func (p *clientProvider) Client(teamID string) (*slack.Client, error) {
+	if c, ok := p.clients.Load(teamID); ok {
+		return c.(*teamClient).client, nil
+	}
+
+	token, err := FetchBotAuthToken(teamID)
+	if err != nil {
+		return nil, err
+	}
+	// A token swapped in while this one was loaded is newer, so keep it.
+	c, _ := p.clients.LoadOrStore(teamID, newTeamClient(teamID, token))
+	return c.(*teamClient).client, nil
+}
+
+// Swap makes later calls for teamID use token. It must be called after
+// the token is stored.
+func (p *clientProvider) Swap(teamID, token string) {
+	if c, ok := p.clients.Load(teamID); ok && c.(*teamClient).token == token {
+		return
+	}
+	p.clients.Store(teamID, newTeamClient(teamID, token))
+}
@@ -9,26 +9,14 @@ import (
 	"log"
 	"net/http"
 	"net/url"
-	"strconv"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
 	"github.com/google/uuid"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 )
 
-type Review struct {
-	UserName         string `dynamodbav:"UserName"`
-	EmployeeSelected string `dynamodbav:"EmployeeSelected"`
-	Feedback         string `dynamodbav:"Feedback"`
-}
-
 func OauthCallbackHandler(w http.ResponseWriter, r *http.Request) {
 	code := r.URL.Query().Get("code")
 	if code == "" {
@@ -87,58 +75,85 @@ func exchangeCodeForBotToken(code string) error {
 	// print the response to the console
 	log.Printf("OAUTHRESONSE: %v\n", response)
 
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		log.Fatalf("unable to load SDK config, %v", err)
-	}
-
-	svc := dynamodb.NewFromConfig(cfg)
-
-	_, err = svc.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName: aws.String("Tokens"),
-		Item: map[string]types.AttributeValue{
-			"TeamId":          &types.AttributeValueMemberS{Value: response.Team.Id},
-			"BotAccessToken":  &types.AttributeValueMemberS{Value: response.BotAccessToken},
-			"BotRefreshToken": &types.AttributeValueMemberS{Value: response.BotRefreshToken},
-			"BotTokenExpires": &types.AttributeValueMemberN{Value: strconv.Itoa(response.BotTokenExpires)},
-			"Scope":           &types.AttributeValueMemberS{Value: response.Scope},
-			"BotUserId":       &types.AttributeValueMemberS{Value: response.BotUserId},
-			"AppId":           &types.AttributeValueMemberS{Value: response.AppId},
-			"TeamName":        &types.AttributeValueMemberS{Value: response.Team.Name},
+	err = store.PutTeamTokens(context.TODO(), &storage.TeamTokens{
+		TeamID:   response.Team.Id,
+		TeamName: response.Team.Name,
+		Scope:    response.Scope,
+		BotTokens: storage.BotTokens{
+			AccessToken:  response.BotAccessToken,
+			RefreshToken: response.BotRefreshToken,
+			ExpiresAt:    time.Now().Add(time.Second * time.Duration(response.BotTokenExpires)).Unix(),
+			BotUserID:    response.BotUserId,
+			AppID:        response.AppId,
 		},
 	})
 
 	if err != nil {
-		log.Printf("Failed to store token Bot token in DynamoDB: %v", err)
-		return fmt.Errorf("failed to store token in DynamoDB: %w", err)
+		log.Printf("Failed to store bot token: %v", err)
+		return fmt.Errorf("failed to store bot token: %w", err)
 	}
+	slackClients.Swap(response.Team.Id, response.BotAccessToken)
 	log.Printf("Bot token stored successfully for team %s", response.Team.Name)
 
 	return nil
 }
 
-func scheduleRefreshBotToken(ctx context.Context, teamID string, interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				if err := RefreshBotToken(ctx, teamID); err != nil {
-					log.Printf("Error refreshing bot token: %v", err)
-				} else {
-					log.Println("Bot token refreshed successfully")
-				}
-			}
-		}
-	}()
-}
-
+// RefreshBotToken refreshes the bot token of teamID and swaps its client to
+// the new token. Slack rotates the refresh token on every refresh, so the
+// new tokens are only stored if no other instance stored its own since the
+// refresh token was read; if one did, its tokens are used instead.
 func RefreshBotToken(ctx context.Context, teamID string) error {
 	botRefreshToken, err := FetchBotRefreshToken(ctx, teamID)
 	if err != nil {
 		log.Printf("Error fetching bot refresh token: %v", err)
+		return err
+	}
+	refreshed, err := requestBotTokens(botRefreshToken)
+	if err != nil {
+		if current, ok := botTokensReplaced(ctx, teamID, botRefreshToken); ok {
+			slackClients.Swap(teamID, current.AccessToken)
+			log.Printf("Bot token of team %s was refreshed by another instance", teamID)
+			return nil
+		}
+		return err
+	}
+
+	stored, err := store.ReplaceBotTokens(ctx, teamID, botRefreshToken, *refreshed)
+	if err != nil {
+		log.Printf("Failed to update bot tokens: %v", err)
+		return err
+	}
+	if !stored {
+		current, ok := botTokensReplaced(ctx, teamID, botRefreshToken)
+		if !ok {
+			return fmt.Errorf("bot tokens of team %s changed while refreshing but could not be read", teamID)
+		}
+		slackClients.Swap(teamID, current.AccessToken)
+		log.Printf("Bot token of team %s was refreshed by another instance first", teamID)
+		return nil
+	}
+	slackClients.Swap(teamID, refreshed.AccessToken)
+
+	log.Printf("Tokens updated successfully")
+	return nil
+}
 
+// botTokensReplaced re-reads the bot tokens of teamID and returns them if
+// their refresh token is no longer spent.
+func botTokensReplaced(ctx context.Context, teamID, spent string) (*storage.BotTokens, bool) {
+	tokens, err := store.GetTeamTokens(ctx, teamID)
+	if err != nil {
+		log.Printf("Error re-reading bot tokens of team %s: %v", teamID, err)
+		return nil, false
+	}
+	if tokens.BotTokens.RefreshToken == spent {
+		return nil, false
 	}
+	return &tokens.BotTokens, true
+}
+
+// requestBotTokens exchanges botRefreshToken for new bot tokens.
+func requestBotTokens(botRefreshToken string) (*storage.BotTokens, error) {
 	values := url.Values{
 		"client_id":     {configure.Slack.ClientID},
 		"client_secret": {configure.Slack.ClientSecret},
@@ -149,7 +164,7 @@ func RefreshBotToken(ctx context.Context, teamID string) error {
 	resp, err := http.PostForm("https://slack.com/api/oauth.v2.access", values)
 	if err != nil {
 		log.Printf("Failed to refresh token: %v", err)
-		return err
+		return nil, err
 	}
 
 	defer resp.Body.Close()
@@ -157,11 +172,11 @@ func RefreshBotToken(ctx context.Context, teamID string) error {
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("Failed to read response body: %v", err)
-		return err
+		return nil, err
 	}
 
 	var response struct {
-		OK              bool   `josn:"ok"`
+		OK              bool   `json:"ok"`
 		BotAccessToken  string `json:"access_token"`
 		BotRefreshToken string `json:"refresh_token"`
 		BotTokenExpires int    `json:"expires_in"`
@@ -171,142 +186,58 @@ func RefreshBotToken(ctx context.Context, teamID string) error {
 
 	if err := json.Unmarshal(body, &response); err != nil {
 		log.Printf("Failed to unmarshal response: %v", err)
-		return err
+		return nil, err
 	}
 
 	if !response.OK {
 		log.Printf("failed to refresh bot token: %v", string(body))
-		return fmt.Errorf("failed to refresh bot token: %s", string(body))
+		return nil, fmt.Errorf("failed to refresh bot token: %s", string(body))
 	}
 
-	return updateBotTokensInDynamoDB(ctx, teamID, response.BotAccessToken, response.BotRefreshToken, response.BotTokenExpires, response.BotUserId, response.AppId)
-}
-
-func updateBotTokensInDynamoDB(ctx context.Context, teamID, botAccessToken, botRefreshToken string, botTokenExpires int, botUserId, appId string) error {
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		log.Printf("Failed to load SDK config: %v", err)
-		return err
-	}
-	expiryTimestamp := time.Now().Add(time.Second * time.Duration(botTokenExpires)).Unix()
-	svc := dynamodb.NewFromConfig(cfg)
-
-	_, err = svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
-		TableName: aws.String("Tokens"),
-		Key: map[string]types.AttributeValue{
-			"TeamId": &types.AttributeValueMemberS{Value: teamID},
-		},
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":bat":  &types.AttributeValueMemberS{Value: botAccessToken},
-			":brt":  &types.AttributeValueMemberS{Value: botRefreshToken},
-			":bte":  &types.AttributeValueMemberN{Value: strconv.FormatInt(expiryTimestamp, 10)},
-			":bui":  &types.AttributeValueMemberS{Value: botUserId},
-			":aid":  &types.AttributeValueMemberS{Value: appId},
-			":expr": &types.AttributeValueMemberN{Value: strconv.FormatInt(expiryTimestamp, 10)},
-		},
-		UpdateExpression: aws.String("SET BotAccessToken = :bat, BotRefreshToken = :brt, BotTokenExpires = :bte, BotUserId = :bui, AppId = :aid, ExpiryTimestamp = :expr"),
-		ReturnValues:     types.ReturnValueAllNew,
-	})
-
-	if err != nil {
-		log.Printf("Failed to update tokens in DynamoDB: %v", err)
-		return err
-	}
-
-	log.Printf("Tokens updated successfully in DynamoDB")
-	return nil
+	expiryTimestamp := time.Now().Add(time.Second * time.Duration(response.BotTokenExpires)).Unix()
+	return &storage.BotTokens{
+		AccessToken:  response.BotAccessToken,
+		RefreshToken: response.BotRefreshToken,
+		ExpiresAt:    expiryTimestamp,
+		BotUserID:    response.BotUserId,
+		AppID:        response.AppId,
+	}, nil
 }
 
 func FetchBotRefreshToken(ctx context.Context, teamID string) (string, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+	tokens, err := store.GetTeamTokens(ctx, teamID)
 	if err != nil {
-		log.Printf("Error loading AWS SDK config: %v", err)
-		return "", fmt.Errorf("unable to load AWS SDK config: %w", err)
+		log.Printf("Error getting bot refresh token: %v", err)
+		return "", fmt.Errorf("failed to get bot refresh token: %w", err)
 	}
 
-	svc := dynamodb.NewFromConfig(cfg)
-
-	key := map[string]types.AttributeValue{
-		"TeamId": &types.AttributeValueMemberS{Value: teamID},
+	if tokens.BotTokens.RefreshToken == "" {
+		log.Printf("Team %s has no BotRefreshToken", teamID)
+		return "", fmt.Errorf("team %s has no BotRefreshToken", teamID)
 	}
 
-	// Retrieve the item from the DynamoDB table
-	result, err := svc.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String("Tokens"),
-		Key:       key,
-	})
-	if err != nil {
-		log.Printf("Error getting item from DynamoDB: %v", err)
-		return "", fmt.Errorf("failed to get item from DynamoDB: %w", err)
-	}
-
-	if result.Item == nil {
-		log.Printf("No item found with the key TeamID %s", teamID)
-		return "", fmt.Errorf("no item found with the key TeamID %s", teamID)
-	}
-
-	// Extract the BotRefreshToken from the result
-	tokenAttr, exists := result.Item["BotRefreshToken"]
-	if !exists {
-		log.Printf("Item does not contain a BotRefreshToken attribute")
-		return "", fmt.Errorf("item does not contain a BotRefreshToken attribute")
-	}
-	refreshToken, ok := tokenAttr.(*types.AttributeValueMemberS)
-	if !ok {
-		log.Printf("BotRefreshToken attribute is not a string")
-		return "", fmt.Errorf("BotRefreshToken attribute is not a string")
-	}
-
-	return refreshToken.Value, nil
+	return tokens.BotTokens.RefreshToken, nil
 }
 
 func FetchBotAuthToken(teamID string) (string, error) {
-	// Load the AWS SDK config
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		log.Printf("Error loading SDK config: %v", err)
-		return "", fmt.Errorf("unable to load SDK config: %w", err)
-	}
-
-	// Create a new DynamoDB client
-	svc := dynamodb.NewFromConfig(cfg)
-
-	// Define the key for the item to retrieve
-	key := map[string]types.AttributeValue{
-		"TeamId": &types.AttributeValueMemberS{Value: teamID},
-	}
-
-	// Retrieve the item from the DynamoDB table
-	result, err := svc.GetItem(context.TODO(), &dynamodb.GetItemInput{
-		TableName: aws.String("Tokens"),
-		Key:       key,
-	})
+	tokens, err := store.GetTeamTokens(context.TODO(), teamID)
 	if err != nil {
-		log.Printf("Error getting item from DynamoDB: %v", err)
-		return "", fmt.Errorf("failed to get item from DynamoDB: %w", err)
-	}
-
-	if result.Item == nil {
-		log.Printf("No item found with the key TeamID %s", teamID)
-		return "", fmt.Errorf("no item found with the key TeamID %s", teamID)
+		log.Printf("Error getting bot auth token: %v", err)
+		return "", fmt.Errorf("failed to get bot auth token: %w", err)
 	}
 
-	// Extract the BotAccessToken from the result
-	tokenAttr, exists := result.Item["BotAccessToken"]
-	if !exists {
-		log.Printf("Item does not contain a BotAccessToken attribute")
-		return "", fmt.Errorf("item does not contain a BotAccessToken attribute")
-	}
-	botAccessToken, ok := tokenAttr.(*types.AttributeValueMemberS)
-	if !ok {
-		log.Printf("BotAccessToken attribute is not a string")
-		return "", fmt.Errorf("botAccessToken attribute is not a string")
+	if tokens.BotTokens.AccessToken == "" {
+		log.Printf("Team %s has no BotAccessToken", teamID)
+		return "", fmt.Errorf("team %s has no BotAccessToken", teamID)
 	}
 
-	return botAccessToken.Value, nil
+	return tokens.BotTokens.AccessToken, nil
 }
 
-func EventsHandler(w http.ResponseWriter, r *http.Request) {
+// verifySlackRequest checks the signing secret signature of r and returns
+// its body, restoring r.Body so it can be read again. On failure it writes
+// the error response itself and returns false.
+func verifySlackRequest(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
 	signatureHeader := r.Header.Get("X-Slack-Signature")
 	timestampHeader := r.Header.Get("X-Slack-Request-Timestamp")
 	log.Printf("X-Slack-Signature: %s, X-Slack-Request-Timestamp: %s\n", signatureHeader, timestampHeader)
@@ -315,7 +246,7 @@ func EventsHandler(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 
@@ -323,17 +254,26 @@ func EventsHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Printf("Failed to initialize secrets verifier: %v", err)
 		http.Error(w, "Verification failed", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 
 	if _, err := sv.Write(body); err != nil {
 		log.Printf("Failed to write body to secrets verifier: %v", err)
 		http.Error(w, "Verification failed", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 	if err := sv.Ensure(); err != nil {
 		log.Printf("Failed to ensure request signature: %v", err)
 		http.Error(w, "Verification failed", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return body, true
+}
+
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	body, ok := verifySlackRequest(w, r)
+	if !ok {
 		return
 	}
 	log.Printf("Request body: %s\n", body)
@@ -371,13 +311,15 @@ func EventsHandler(w http.ResponseWriter, r *http.Request) {
 			userID := ev.User
 			log.Printf("App home opened event received: %+v\n", ev)
 
-			PublishHomePage(userID, nil)
-
+			// Slack redelivers events not acknowledged within three
+			// seconds, so publish after answering.
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK) // Explicitly set status code to 200 OK
 			w.Write([]byte(`{"response": "Event received"}`))
 			log.Printf("Events: %s %s, Status: %d\n", r.Method, r.URL.Path, http.StatusOK)
 
+			go PublishHomePage(eventsAPIEvent.TeamID, userID, nil)
+
 		default:
 			log.Printf("Unsupported inner event type received: %+v\n", ev)
 		}
@@ -390,6 +332,12 @@ func EventsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func InteractionHandler(w http.ResponseWriter, r *http.Request) {
+	// Edits and deletes trust the user in the payload, so it must really
+	// come from Slack.
+	if _, ok := verifySlackRequest(w, r); !ok {
+		return
+	}
+
 	if err := r.ParseForm(); err != nil {
 		log.Printf("Error parsing form: %v", err)
 		http.Error(w, "Error parsing form", http.StatusBadRequest)
@@ -404,95 +352,65 @@ func InteractionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	switch callback.Type {
-	case slack.InteractionTypeViewSubmission:
-
-		userID := callback.User.ID
-		userName := callback.User.Name
+	teamID := callback.Team.ID
+	client, err := slackClients.Client(teamID)
+	if err != nil {
+		log.Printf("Error resolving Slack client for team %s: %v", teamID, err)
+		http.Error(w, "Unknown team", http.StatusInternalServerError)
+		return
+	}
 
-		values := callback.View.State.Values
-		employeeSelected := values["employee_select"]["employee_select_action"].SelectedOption.Value
-		feedback := values["feedback"]["feedback_input"].Value
-		log.Printf("Employee selected: %s, Feedback: %s\n, UserID: %s\n, userName: %s\n", employeeSelected, feedback, userID, userName)
-		err := storeSurveyData(userID, userName, employeeSelected, feedback)
-		if err != nil {
-			log.Printf("Error storing survey data: %v", err)
-			http.Error(w, "Error storing data", http.StatusInternalServerError)
+	switch callback.Type {
+	case slack.InteractionTypeBlockSuggestion:
+		if callback.ActionID == "employee_select_action" {
+			employeeSuggestionHandler(w, r, teamID, callback.Value)
 			return
 		}
+		log.Printf("Unsupported block suggestion for action %s", callback.ActionID)
+		w.WriteHeader(http.StatusOK)
+		return
 
-		go func() {
-			if err := showSuccessModal(callback.TriggerID); err != nil {
-				log.Printf("Error showing success modal: %v", err)
-			}
-		}()
+	case slack.InteractionTypeViewSubmission:
+		switch callback.View.CallbackID {
+		case deleteReviewCallbackID:
+			submitDeleteReview(w, callback)
+		case cycleCallbackID:
+			submitCycle(w, callback)
+		case moderationCommentCallbackID:
+			submitModerationComment(w, client, callback)
+		case wizardRevieweeCallbackID, wizardTypeCallbackID, wizardPromptsCallbackID, wizardConfirmCallbackID:
+			submitWizardStep(w, client, callback)
+		default:
+			submitFeedback(w, client, callback)
+		}
+		return
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("{}"))
+	case slack.InteractionTypeViewClosed:
+		switch callback.View.CallbackID {
+		case feedbackCallbackID:
+			saveDraft(w, callback)
+		case wizardPromptsCallbackID, wizardConfirmCallbackID:
+			saveWizardDraft(w, callback)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
 		return
 
 	case slack.InteractionTypeBlockActions:
 		for _, action := range callback.ActionCallback.BlockActions {
 			switch action.ActionID {
 			case "create_action":
-				options := []*slack.OptionBlockObject{
-					slack.NewOptionBlockObject("ted_smith", slack.NewTextBlockObject("plain_text", "Ted Smith", false, false), nil),
-					slack.NewOptionBlockObject("janet_kelso", slack.NewTextBlockObject("plain_text", "Janet Kelso", false, false), nil),
-					slack.NewOptionBlockObject("mike_brown", slack.NewTextBlockObject("plain_text", "Mike Brown", false, false), nil),
-					slack.NewOptionBlockObject("wilson_horrell", slack.NewTextBlockObject("plain_text", "Wilson Horrell", false, false), nil),
-				}
-
-				element := slack.NewOptionsSelectBlockElement("static_select", slack.NewTextBlockObject("plain_text", "Select an option...", false, false), "employee_select_action", options...)
-
-				inputBlock := slack.NewInputBlock("employee_select", slack.NewTextBlockObject("plain_text", "Select an Employee", false, false), nil, element)
-
-				// Define the modal
-				modalRequest := slack.ModalViewRequest{
-					Type:   "modal",
-					Title:  slack.NewTextBlockObject("plain_text", "Feedback Form", false, false),
-					Close:  slack.NewTextBlockObject("plain_text", "Cancel", false, false),
-					Submit: slack.NewTextBlockObject("plain_text", "Submit", false, false),
-					Blocks: slack.Blocks{
-						BlockSet: []slack.Block{
-							inputBlock,
-							slack.NewInputBlock(
-								"feedback", // Block ID
-								slack.NewTextBlockObject("plain_text", "Feedback", false, false), // Label
-								nil, // Hint (optional, can be nil)
-								&slack.PlainTextInputBlockElement{ // Element
-									Type:        "plain_text_input",
-									ActionID:    "feedback_input",
-									Placeholder: slack.NewTextBlockObject("plain_text", "Enter your feedback here...", false, false),
-									Multiline:   true,
-								},
-							),
-						},
-					},
-				}
-				modalRequestJSON, err := json.Marshal(modalRequest)
-				if err != nil {
-					log.Printf("Error marshalling modal request: %v", err)
-					http.Error(w, "Failed to marshal modal request", http.StatusInternalServerError)
-				}
-				log.Printf("Modal request: %s\n", modalRequestJSON)
-				log.Printf("Callback trigger ID: %s\n", callback.TriggerID)
-				log.Printf("Type of triggerID: %T\n", callback.TriggerID)
-				_, err = api.OpenView(callback.TriggerID, modalRequest)
-				if err != nil {
-					log.Printf("Error opening modal: %v", err)
-					http.Error(w, "Failed to open modal", http.StatusInternalServerError)
-					return
-				}
-
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusOK)
-				w.Write([]byte(`{"response": "Modal opened"}`))
+				openWizard(w, client, callback)
 				return
 
-			case "view_action":
-				// Fetch the last 10 reviews from DynamoDB
-				reviews, err := fetchLast10Reviews()
+			case "view_action", "reviews_next_action", "reviews_prev_action":
+				// view_action starts at the newest page; the paging buttons
+				// carry the cursor of the page they lead to.
+				cursor := ""
+				if action.ActionID != "view_action" {
+					cursor = action.Value
+				}
+				page, err := fetchReviewPage(teamID, callback.User.ID, cursor)
 				if err != nil {
 					log.Printf("Error fetching reviews: %v", err)
 					http.Error(w, "Failed to fetch reviews", http.StatusInternalServerError)
@@ -500,7 +418,7 @@ func InteractionHandler(w http.ResponseWriter, r *http.Request) {
 				}
 
 				// Publish the home page with the reviews
-				go PublishHomePage(callback.User.ID, reviews)
+				go PublishHomePage(teamID, callback.User.ID, page)
 
 				// Respond immediately to the button click without waiting for the reviews to be displayed
 				w.Header().Set("Content-Type", "application/json")
@@ -508,8 +426,28 @@ func InteractionHandler(w http.ResponseWriter, r *http.Request) {
 				w.Write([]byte("{}"))
 				return
 
+			case notifyToggleActionID:
+				handleNotifyToggle(w, callback, action)
+				return
+
+			case "resume_draft_action":
+				resumeDraft(w, client, callback, action)
+				return
+
+			case "create_cycle_action":
+				openCycleModal(w, client, callback)
+				return
+
+			case "approve_review_action", "request_changes_action", "reject_review_action":
+				handleModerationAction(w, client, callback, action)
+				return
+
+			case "review_overflow_action":
+				handleReviewOverflow(w, client, callback, action)
+				return
+
 			case "remove_reviews_action":
-				go PublishHomePage(callback.User.ID, []Review{})
+				go PublishHomePage(teamID, callback.User.ID, nil)
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusOK)
 				w.Write([]byte("{}"))
@@ -520,94 +458,63 @@ func InteractionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func storeSurveyData(userID, userName, employeeSelected, feedback string) error {
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		return fmt.Errorf("unable to load SDK config, %v", err)
-	}
-
-	svc := dynamodb.NewFromConfig(cfg)
-	submissionID := uuid.New().String()
-
-	_, err = svc.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName: aws.String("SurveyData"),
-		Item: map[string]types.AttributeValue{
-			"SubmissionID":         &types.AttributeValueMemberS{Value: submissionID},
-			"ConstantPartitionKey": &types.AttributeValueMemberS{Value: "ALL"},
-			"UserID":               &types.AttributeValueMemberS{Value: userID},
-			"UserName":             &types.AttributeValueMemberS{Value: userName},
-			"EmployeeSelected":     &types.AttributeValueMemberS{Value: employeeSelected},
-			"Feedback":             &types.AttributeValueMemberS{Value: feedback},
-			"Timestamp":            &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)},
-		},
-	})
+// storeSurveyData records review as a new submission, assigning its
+// SubmissionID and Timestamp. Reviews not already written for a cycle are
+// tagged with the team's active cycle, if any.
+func storeSurveyData(review *storage.Review) error {
+	ctx := context.TODO()
+	review.SubmissionID = uuid.New().String()
+	review.Timestamp = time.Now().UTC().Format(time.RFC3339)
+
+	if review.CycleID == "" {
+		cycle, err := activeCycle(ctx, review.TeamID)
+		if err != nil {
+			return fmt.Errorf("failed to load active cycle: %w", err)
+		}
+		if cycle != nil {
+			review.CycleID = cycle.CycleID
+		}
+	}
+
+	err := store.PutReview(ctx, review)
 	if err != nil {
-		return fmt.Errorf("failed to put item in DynamoDB: %v", err)
+		return fmt.Errorf("failed to store survey data: %v", err)
 	}
 
 	return nil
 }
 
-func showSuccessModal(triggerID string) error {
-	responseModal := createSuccessModal()
+func showSuccessModal(client *slack.Client, triggerID, message string) error {
+	responseModal := createSuccessModal(message)
 
-	_, err := api.OpenView(triggerID, responseModal)
+	_, err := client.OpenView(triggerID, responseModal)
 	if err != nil {
 		return fmt.Errorf("failed to open success modal: %v", err)
 	}
 	return err // Return the error to be handled by the caller
 }
 
-func createSuccessModal() slack.ModalViewRequest {
-
-	titleText := slack.NewTextBlockObject("plain_text", "Success", false, false)
-	sectionText := slack.NewTextBlockObject("mrkdwn", "Your feedback has been successfully submitted. Thank you!", false, false)
-	section := slack.NewSectionBlock(sectionText, nil, nil)
-	blocks := slack.Blocks{
-		BlockSet: []slack.Block{section},
-	}
-	return slack.ModalViewRequest{
-		Type:   "modal",
-		Title:  titleText,
-		Blocks: blocks,
-		Close:  slack.NewTextBlockObject("plain_text", "Close", false, false),
-	}
+func createSuccessModal(message string) slack.ModalViewRequest {
+	return renderModal("success", successView{Message: message}, "Success", message)
 }
 
-func fetchLast10Reviews() ([]Review, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		log.Printf("Unable to load SDK config: %v", err)
-		return nil, err
-	}
-	svc := dynamodb.NewFromConfig(cfg)
-
-	// Assuming you have a GSI on Timestamp to fetch the latest reviews
-	// This example does not include pagination, error handling, or GSI details
-	out, err := svc.Query(context.TODO(), &dynamodb.QueryInput{
-		TableName:              aws.String("SurveyData"),
-		IndexName:              aws.String("TimestampIndex"),
-		ScanIndexForward:       aws.Bool(false), // false for descending order
-		Limit:                  aws.Int32(10),
-		KeyConditionExpression: aws.String("ConstantPartitionKey = :cpk"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":cpk": &types.AttributeValueMemberS{Value: "ALL"},
-		},
-	})
+// reviewsPerPage is how many reviews the home tab shows at once.
+const reviewsPerPage = 10
+
+// fetchReviewPage returns the page of reviews userID may see at cursor,
+// or the newest page when cursor is empty.
+func fetchReviewPage(teamID, userID, cursor string) (*storage.ReviewPage, error) {
+	ctx := context.TODO()
+	q := viewerQuery(ctx, teamID, userID)
+	q.ApprovedOnly = true
+	q.Limit = reviewsPerPage
+	q.Cursor = cursor
+
+	page, err := store.QueryReviews(ctx, q)
 	if err != nil {
+		log.Printf("Failed to fetch reviews: %v", err)
 		return nil, err
 	}
 
-	var reviews []Review
-	for _, item := range out.Items {
-		review := Review{}
-		err := attributevalue.UnmarshalMap(item, &review)
-		if err != nil {
-			log.Printf("Failed to unmarshal DynamoDB item to Review: %v", err)
-			return nil, err
-		}
-		reviews = append(reviews, review)
-	}
-
-	return reviews, nil
+	return page, nil
 }
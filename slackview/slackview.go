@@ -0,0 +1,168 @@
+// Package slackview renders Slack views from Block Kit JSON files written
+// as Go text templates, so their copy and layout can be changed without
+// touching handler code.
+//
+// Each *.json file is a template named after the file without its
+// extension. Whole values are inserted with the json function, as in
+// {"value": {{json .ID}}}, and text inside a string with str, as in
+// {"text": "Hello {{str .Name}}"}; both escape what they insert. A comma
+// may be left after the last element of an array or object, which makes
+// it easy to emit blocks from a range or an if.
+package slackview
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/slack-go/slack"
+)
+
+// Set is the loaded view templates.
+type Set struct {
+	templates map[string]*template.Template
+}
+
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"str": func(s string) (string, error) {
+		b, err := json.Marshal(s)
+		if err != nil {
+			return "", err
+		}
+		return string(b[1 : len(b)-1]), nil
+	},
+}
+
+// Load parses the *.json files at the top of fsys.
+func Load(fsys fs.FS) (*Set, error) {
+	paths, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Set{templates: make(map[string]*template.Template)}
+	for _, p := range paths {
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(path.Base(p), ".json")
+		t, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", p, err)
+		}
+		s.templates[name] = t
+	}
+	return s, nil
+}
+
+// Home renders the home tab view name with data.
+func (s *Set) Home(name string, data interface{}) (slack.HomeTabViewRequest, error) {
+	var view slack.HomeTabViewRequest
+	if err := s.render(name, data, &view); err != nil {
+		return view, err
+	}
+	if view.Type != slack.VTHomeTab {
+		return view, fmt.Errorf("view %s: type is %q, not %q", name, view.Type, slack.VTHomeTab)
+	}
+	return view, checkBlocks(name, view.Blocks)
+}
+
+// Modal renders the modal view name with data.
+func (s *Set) Modal(name string, data interface{}) (slack.ModalViewRequest, error) {
+	var view slack.ModalViewRequest
+	if err := s.render(name, data, &view); err != nil {
+		return view, err
+	}
+	if view.Type != slack.VTModal {
+		return view, fmt.Errorf("view %s: type is %q, not %q", name, view.Type, slack.VTModal)
+	}
+	if view.Title == nil || view.Title.Text == "" {
+		return view, fmt.Errorf("view %s: modal has no title", name)
+	}
+	return view, checkBlocks(name, view.Blocks)
+}
+
+// render executes the template name and decodes the JSON it produces into
+// view.
+func (s *Set) render(name string, data interface{}, view interface{}) error {
+	t, ok := s.templates[name]
+	if !ok {
+		return fmt.Errorf("view %s is not defined", name)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return fmt.Errorf("view %s: %w", name, err)
+	}
+
+	out := trimTrailingCommas(buf.Bytes())
+	if err := json.Unmarshal(out, view); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			line := bytes.Count(out[:syntax.Offset], []byte("\n")) + 1
+			return fmt.Errorf("view %s: invalid JSON on line %d of the output: %w", name, line, err)
+		}
+		return fmt.Errorf("view %s: %w", name, err)
+	}
+	return nil
+}
+
+// checkBlocks rejects block types Slack would not accept.
+func checkBlocks(name string, blocks slack.Blocks) error {
+	for i, b := range blocks.BlockSet {
+		if _, ok := b.(*slack.UnknownBlock); ok {
+			return fmt.Errorf("view %s: block %d has unknown type %q", name, i, b.BlockType())
+		}
+	}
+	return nil
+}
+
+// trimTrailingCommas removes commas that directly precede a closing
+// bracket or brace, ignoring whitespace and anything inside strings.
+func trimTrailingCommas(in []byte) []byte {
+	out := make([]byte, 0, len(in))
+	inString, escaped := false, false
+	comma := -1
+	for _, c := range in {
+		if inString {
+			out = append(out, c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case ' ', '\t', '\n', '\r':
+		case ']', '}':
+			if comma >= 0 {
+				out = append(out[:comma], out[comma+1:]...)
+			}
+			comma = -1
+		case ',':
+			comma = len(out)
+		default:
+			comma = -1
+			if c == '"' {
+				inString = true
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package slackview
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/slack-go/slack"
+)
+
+func TestTrimTrailingCommas(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"none", `{"a":[1,2]}`, `{"a":[1,2]}`},
+		{"array", `[1,2,]`, `[1,2]`},
+		{"object", `{"a":1,}`, `{"a":1}`},
+		{"whitespace", "[\n  1,\n  2,\n]", "[\n  1,\n  2\n]"},
+		{"nested", `{"a":[{"b":1,},],}`, `{"a":[{"b":1}]}`},
+		{"inside string", `{"a":",]"}`, `{"a":",]"}`},
+		{"escaped quote", `{"a":"x\",]",}`, `{"a":"x\",]"}`},
+		{"escaped backslash", `{"a":"x\\",}`, `{"a":"x\\"}`},
+		{"empty", ``, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(trimTrailingCommas([]byte(tt.in))); got != tt.want {
+				t.Fatalf("trimTrailingCommas(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModal(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ok.json": {Data: []byte(`{
+			"type": "modal",
+			"title": {"type": "plain_text", "text": {{json .Title}}},
+			"blocks": [
+				{{range .Items}}
+				{"type": "section", "text": {"type": "mrkdwn", "text": "Item {{str .}}"}},
+				{{end}}
+			],
+		}`)},
+		"home.json":     {Data: []byte(`{"type": "home", "blocks": []}`)},
+		"notitle.json":  {Data: []byte(`{"type": "modal", "blocks": []}`)},
+		"badblock.json": {Data: []byte(`{"type": "modal", "title": {"type": "plain_text", "text": "T"}, "blocks": [{"type": "carousel"}]}`)},
+		"badjson.json":  {Data: []byte("{\n\"type\": \"modal\"\n\"title\": {}\n}")},
+		"missing.json":  {Data: []byte(`{"type": "modal", "title": {"type": "plain_text", "text": {{json .Nope}}}}`)},
+		"ignored.txt":   {Data: []byte(`not a view`)},
+		"nested/x.json": {Data: []byte(`{}`)},
+	}
+	s, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	data := map[string]interface{}{"Title": `Say "hi"`, "Items": []string{`a "b"`, "c"}}
+	view, err := s.Modal("ok", data)
+	if err != nil {
+		t.Fatalf("Modal: %v", err)
+	}
+	if view.Title.Text != `Say "hi"` || len(view.Blocks.BlockSet) != 2 {
+		t.Fatalf("Modal rendered title %q and %d blocks", view.Title.Text, len(view.Blocks.BlockSet))
+	}
+	if section := view.Blocks.BlockSet[0].(*slack.SectionBlock); section.Text.Text != `Item a "b"` {
+		t.Fatalf("first block text = %q", section.Text.Text)
+	}
+
+	tests := []struct {
+		name    string
+		wantErr string
+	}{
+		{"home", "type is"},
+		{"notitle", "no title"},
+		{"badblock", "unknown type"},
+		{"badjson", "line 3"},
+		{"missing", "view missing"},
+		{"ignored", "not defined"},
+		{"x", "not defined"},
+		{"undefined", "not defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Modal(tt.name, data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Modal(%s) = %v, want an error containing %q", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := s.Home("home", nil); err != nil {
+		t.Fatalf("Home: %v", err)
+	}
+	if _, err := s.Home("ok", data); err == nil {
+		t.Fatal("Home rendered a modal")
+	}
+}
+
+func TestLoadInvalidTemplate(t *testing.T) {
+	fsys := fstest.MapFS{"broken.json": {Data: []byte(`{"text": "{{.Name"}`)}}
+	if _, err := Load(fsys); err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Fatalf("Load = %v, want an error naming broken.json", err)
+	}
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Direction is which way a cursor walks from its key.
+type Direction string
+
+const (
+	// Older pages continue after the cursor key, toward older reviews.
+	Older Direction = "next"
+	// Newer pages end just before the cursor key, toward newer reviews.
+	Newer Direction = "prev"
+)
+
+// cursor is the decoded form of the opaque page cursors handed to callers.
+// Key holds the index key of the review the page boundary sits on.
+type cursor struct {
+	Dir Direction         `json:"d"`
+	Key map[string]string `json:"k"`
+}
+
+func encodeCursor(dir Direction, key map[string]string) string {
+	data, _ := json.Marshal(cursor{Dir: dir, Key: key})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor: %w", err)
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("malformed cursor: %w", err)
+	}
+	if c.Dir != Older && c.Dir != Newer {
+		return nil, fmt.Errorf("malformed cursor: unknown direction %q", c.Dir)
+	}
+	return &c, nil
+}
+
+// reviewKey is the TimestampIndex key of r.
+func reviewKey(r Review) map[string]string {
+	return map[string]string{
+		"SubmissionID":         r.SubmissionID,
+		"ConstantPartitionKey": "ALL",
+		"Timestamp":            r.Timestamp,
+	}
+}
+
+// newReviewPage fills in the cursors of a page of reviews, newest first.
+// hasMore reports whether more reviews exist past the page in the
+// direction it was read.
+func newReviewPage(reviews []Review, from *cursor, hasMore bool) *ReviewPage {
+	page := &ReviewPage{Reviews: reviews}
+	if len(reviews) == 0 {
+		return page
+	}
+
+	first, last := reviews[0], reviews[len(reviews)-1]
+	if from == nil || from.Dir == Older {
+		if hasMore {
+			page.Next = encodeCursor(Older, reviewKey(last))
+		}
+		if from != nil {
+			page.Prev = encodeCursor(Newer, reviewKey(first))
+		}
+	} else {
+		if hasMore {
+			page.Prev = encodeCursor(Newer, reviewKey(first))
+		}
+		page.Next = encodeCursor(Older, reviewKey(last))
+	}
+	return page
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  Direction
+		key  map[string]string
+	}{
+		{"older", Older, reviewKey(Review{SubmissionID: "S1", Timestamp: "2024-01-15T10:00:00Z"})},
+		{"newer", Newer, reviewKey(Review{SubmissionID: "S2", Timestamp: "2024-01-16T10:00:00Z"})},
+		{"index key", Older, map[string]string{"SubmissionID": "S3", "Timestamp": "2024-01-17T10:00:00Z", "RevieweeID": "U1"}},
+		{"no key", Newer, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := decodeCursor(encodeCursor(tt.dir, tt.key))
+			if err != nil {
+				t.Fatalf("decodeCursor: %v", err)
+			}
+			if c.Dir != tt.dir || !reflect.DeepEqual(c.Key, tt.key) {
+				t.Fatalf("decoded %+v, want %s %v", c, tt.dir, tt.key)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := map[string]string{
+		"empty":             "",
+		"not base64":        "!!!",
+		"not json":          encode("next"),
+		"unknown direction": encode(`{"d":"sideways","k":{}}`),
+		"no direction":      encode(`{"k":{"SubmissionID":"S1"}}`),
+		"wrong key type":    encode(`{"d":"next","k":["S1"]}`),
+	}
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			if c, err := decodeCursor(s); err == nil {
+				t.Fatalf("decodeCursor(%q) = %+v, want an error", s, c)
+			}
+		})
+	}
+}
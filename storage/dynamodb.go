@@ -0,0 +1,1161 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoStore is a Store backed by DynamoDB tables.
+type DynamoStore struct {
+	client *dynamodb.Client
+	tables Tables
+}
+
+// NewDynamoStore loads the default AWS config and returns a DynamoStore.
+// Empty table names fall back to the defaults of Tables, such as Tokens,
+// SurveyData and Users.
+func NewDynamoStore(ctx context.Context, tables Tables) (*DynamoStore, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config: %w", err)
+	}
+
+	return &DynamoStore{
+		client: dynamodb.NewFromConfig(cfg),
+		tables: tables.withDefaults(),
+	}, nil
+}
+
+func (s *DynamoStore) PutTeamTokens(ctx context.Context, t *TeamTokens) error {
+	item, err := attributevalue.MarshalMap(t)
+	if err != nil {
+		return fmt.Errorf("failed to marshal team tokens: %w", err)
+	}
+	item["ExpiryTimestamp"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(t.BotTokens.ExpiresAt, 10)}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tables.Tokens),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put item in DynamoDB: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetTeamTokens(ctx context.Context, teamID string) (*TeamTokens, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Tokens),
+		Key: map[string]types.AttributeValue{
+			"TeamId": &types.AttributeValueMemberS{Value: teamID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item from DynamoDB: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: no tokens for team %s", ErrNotFound, teamID)
+	}
+
+	var t TeamTokens
+	if err := attributevalue.UnmarshalMap(result.Item, &t); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal team tokens: %w", err)
+	}
+	return &t, nil
+}
+
+// refreshTokenCondition matches a stored team whose refresh token in
+// attribute is refreshToken. An empty one also matches a team that never
+// stored the attribute.
+func refreshTokenCondition(attribute, refreshToken string, values map[string]types.AttributeValue) string {
+	values[":old"] = &types.AttributeValueMemberS{Value: refreshToken}
+	if refreshToken == "" {
+		return "attribute_exists(TeamId) AND (attribute_not_exists(" + attribute + ") OR " + attribute + " = :old)"
+	}
+	return attribute + " = :old"
+}
+
+func (s *DynamoStore) ReplaceBotTokens(ctx context.Context, teamID, refreshToken string, t BotTokens) (bool, error) {
+	expiresAt := strconv.FormatInt(t.ExpiresAt, 10)
+	values := map[string]types.AttributeValue{
+		":bat":  &types.AttributeValueMemberS{Value: t.AccessToken},
+		":brt":  &types.AttributeValueMemberS{Value: t.RefreshToken},
+		":bte":  &types.AttributeValueMemberN{Value: expiresAt},
+		":bui":  &types.AttributeValueMemberS{Value: t.BotUserID},
+		":aid":  &types.AttributeValueMemberS{Value: t.AppID},
+		":expr": &types.AttributeValueMemberN{Value: expiresAt},
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tables.Tokens),
+		Key: map[string]types.AttributeValue{
+			"TeamId": &types.AttributeValueMemberS{Value: teamID},
+		},
+		UpdateExpression:          aws.String("SET BotAccessToken = :bat, BotRefreshToken = :brt, BotTokenExpires = :bte, BotUserId = :bui, AppId = :aid, ExpiryTimestamp = :expr"),
+		ConditionExpression:       aws.String(refreshTokenCondition("BotRefreshToken", refreshToken, values)),
+		ExpressionAttributeValues: values,
+	})
+	var conflict *types.ConditionalCheckFailedException
+	if errors.As(err, &conflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to replace bot tokens in DynamoDB: %w", err)
+	}
+	return true, nil
+}
+
+func (s *DynamoStore) ReplaceAppTokens(ctx context.Context, teamID, refreshToken string, t AppTokens) (bool, error) {
+	values := map[string]types.AttributeValue{
+		":t":   &types.AttributeValueMemberS{Value: t.AuthToken},
+		":r":   &types.AttributeValueMemberS{Value: t.RefreshToken},
+		":e":   &types.AttributeValueMemberN{Value: strconv.FormatInt(t.ExpiresAt, 10)},
+		":iat": &types.AttributeValueMemberN{Value: strconv.FormatInt(t.IssuedAt, 10)},
+		":uid": &types.AttributeValueMemberS{Value: t.UserID},
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tables.Tokens),
+		Key: map[string]types.AttributeValue{
+			"TeamId": &types.AttributeValueMemberS{Value: teamID},
+		},
+		UpdateExpression:          aws.String("SET AppAuthToken = :t, AppRefreshToken = :r, AppTokenExpiresAt = :e, AppTokenIssuedAt = :iat, AppUserID = :uid"),
+		ConditionExpression:       aws.String(refreshTokenCondition("AppRefreshToken", refreshToken, values)),
+		ExpressionAttributeValues: values,
+	})
+	var conflict *types.ConditionalCheckFailedException
+	if errors.As(err, &conflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to replace app tokens in DynamoDB: %w", err)
+	}
+	return true, nil
+}
+
+func (s *DynamoStore) ListTeamIDs(ctx context.Context) ([]string, error) {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName:            aws.String(s.tables.Tokens),
+		ProjectionExpression: aws.String("TeamId"),
+	})
+
+	var teamIDs []string
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan teams: %w", err)
+		}
+		for _, item := range out.Items {
+			if id, ok := item["TeamId"].(*types.AttributeValueMemberS); ok {
+				teamIDs = append(teamIDs, id.Value)
+			}
+		}
+	}
+	return teamIDs, nil
+}
+
+func (s *DynamoStore) PutReview(ctx context.Context, r *Review) error {
+	item, err := attributevalue.MarshalMap(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal review: %w", err)
+	}
+	// Every review shares one partition so TimestampIndex can order them all.
+	// UserIDIndex, ReviewerHashIndex and RevieweeIDIndex order the reviews
+	// of one named author, one anonymous author or one reviewee by
+	// Timestamp. Index keys cannot be empty strings, which is why Review
+	// leaves out an empty UserID, ReviewerHash or RevieweeID.
+	item["ConstantPartitionKey"] = &types.AttributeValueMemberS{Value: "ALL"}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tables.Reviews),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put item in DynamoDB: %w", err)
+	}
+	return nil
+}
+
+// revisionCondition matches a stored review at revision. Reviews written
+// before revisions have no Revision attribute and are at revision 0.
+func revisionCondition(revision int) (string, map[string]types.AttributeValue) {
+	values := map[string]types.AttributeValue{
+		":rev": &types.AttributeValueMemberN{Value: strconv.Itoa(revision)},
+	}
+	if revision == 0 {
+		return "attribute_exists(SubmissionID) AND (attribute_not_exists(Revision) OR Revision = :rev)", values
+	}
+	return "Revision = :rev", values
+}
+
+func (s *DynamoStore) ReplaceReview(ctx context.Context, r *Review, revision int) (bool, error) {
+	item, err := attributevalue.MarshalMap(r)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal review: %w", err)
+	}
+	item["ConstantPartitionKey"] = &types.AttributeValueMemberS{Value: "ALL"}
+
+	condition, values := revisionCondition(revision)
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(s.tables.Reviews),
+		Item:                      item,
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	})
+	var conflict *types.ConditionalCheckFailedException
+	if errors.As(err, &conflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to replace review %s: %w", r.SubmissionID, err)
+	}
+	return true, nil
+}
+
+func (s *DynamoStore) SetApprovalRequests(ctx context.Context, submissionID string, revision int, requests []MessageRef) (bool, error) {
+	list, err := attributevalue.Marshal(requests)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal approval requests: %w", err)
+	}
+
+	condition, values := revisionCondition(revision)
+	values[":requests"] = list
+	_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tables.Reviews),
+		Key: map[string]types.AttributeValue{
+			"SubmissionID": &types.AttributeValueMemberS{Value: submissionID},
+		},
+		UpdateExpression:          aws.String("SET ApprovalRequests = :requests"),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	})
+	var conflict *types.ConditionalCheckFailedException
+	if errors.As(err, &conflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record approval requests of review %s: %w", submissionID, err)
+	}
+	return true, nil
+}
+
+func (s *DynamoStore) GetReview(ctx context.Context, submissionID string) (*Review, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Reviews),
+		Key: map[string]types.AttributeValue{
+			"SubmissionID": &types.AttributeValueMemberS{Value: submissionID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item from DynamoDB: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: review %s", ErrNotFound, submissionID)
+	}
+
+	var r Review
+	if err := attributevalue.UnmarshalMap(result.Item, &r); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal review: %w", err)
+	}
+	return &r, nil
+}
+
+func (s *DynamoStore) DeleteReview(ctx context.Context, submissionID string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tables.Reviews),
+		Key: map[string]types.AttributeValue{
+			"SubmissionID": &types.AttributeValueMemberS{Value: submissionID},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete item from DynamoDB: %w", err)
+	}
+	return nil
+}
+
+// reviewIndex is a review index sorted by Timestamp, partitioned on Key.
+type reviewIndex struct {
+	Name  string
+	Key   string
+	Value string
+}
+
+// reviewIndexesFor picks the indexes q is read from: RevieweeIDIndex or
+// UserIDIndex when q is about one reviewee or one named author, otherwise
+// TimestampIndex, which holds every review. Anonymous reviews have no
+// UserID and are only in ReviewerHashIndex, so a query for an author that
+// also matches AuthorHash reads both author indexes. DynamoDB does not
+// allow filtering on the key of the index being queried, so each returned
+// query no longer filters on it.
+func reviewIndexesFor(q ReviewQuery) []indexQuery {
+	switch {
+	case q.RevieweeID != "":
+		index := reviewIndex{Name: "RevieweeIDIndex", Key: "RevieweeID", Value: q.RevieweeID}
+		q.RevieweeID = ""
+		if q.Visible != nil && !q.Visible.All {
+			v := *q.Visible
+			v.All = contains(v.RevieweeIDs, index.Value)
+			v.RevieweeIDs = nil
+			q.Visible = &v
+		}
+		return []indexQuery{{index, q}}
+	case q.AuthorID != "":
+		named, anonymous := q, q
+		named.AuthorID, named.AuthorHash = "", ""
+		if q.Visible != nil && !q.Visible.All {
+			v := *q.Visible
+			v.All = v.AuthorID == q.AuthorID
+			v.AuthorID = ""
+			named.Visible = &v
+		}
+		queries := []indexQuery{{reviewIndex{Name: "UserIDIndex", Key: "UserID", Value: q.AuthorID}, named}}
+		if q.AuthorHash == "" {
+			return queries
+		}
+
+		anonymous.AuthorID, anonymous.AuthorHash = "", ""
+		if q.Visible != nil && !q.Visible.All {
+			v := *q.Visible
+			v.All = v.AuthorHash == q.AuthorHash
+			v.AuthorHash = ""
+			anonymous.Visible = &v
+		}
+		return append(queries, indexQuery{reviewIndex{Name: "ReviewerHashIndex", Key: "ReviewerHash", Value: q.AuthorHash}, anonymous})
+	default:
+		return []indexQuery{{reviewIndex{Name: "TimestampIndex", Key: "ConstantPartitionKey", Value: "ALL"}, q}}
+	}
+}
+
+// indexQuery is the part of a ReviewQuery read from one index.
+type indexQuery struct {
+	index reviewIndex
+	q     ReviewQuery
+}
+
+func contains(ids []string, id string) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+// reviewQueryInput builds the query of iq, without paging.
+func (s *DynamoStore) reviewQueryInput(iq indexQuery) *dynamodb.QueryInput {
+	filter, values, names := reviewFilter(iq.q)
+	values[":key"] = &types.AttributeValueMemberS{Value: iq.index.Value}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(s.tables.Reviews),
+		IndexName:                 aws.String(iq.index.Name),
+		ScanIndexForward:          aws.Bool(false), // false for descending order
+		KeyConditionExpression:    aws.String(iq.index.Key + " = :key"),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeValues: values,
+	}
+	// DynamoDB rejects an empty name map.
+	if len(names) > 0 {
+		input.ExpressionAttributeNames = names
+	}
+	return input
+}
+
+func (s *DynamoStore) QueryReviews(ctx context.Context, q ReviewQuery) (*ReviewPage, error) {
+	var from *cursor
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		from = c
+	}
+
+	// Each index returns up to one review past the page in read order, so
+	// merging them still shows whether there is another page.
+	var reviews []Review
+	for _, iq := range reviewIndexesFor(q) {
+		page, err := s.queryIndex(ctx, iq, from, q.Limit+1)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, page...)
+	}
+	forward := from != nil && from.Dir == Newer
+	sort.SliceStable(reviews, func(i, j int) bool {
+		if forward {
+			return reviews[i].Timestamp < reviews[j].Timestamp
+		}
+		return reviews[i].Timestamp > reviews[j].Timestamp
+	})
+
+	hasMore := len(reviews) > q.Limit
+	if hasMore {
+		reviews = reviews[:q.Limit]
+	}
+	if forward {
+		for i, j := 0, len(reviews)-1; i < j; i, j = i+1, j-1 {
+			reviews[i], reviews[j] = reviews[j], reviews[i]
+		}
+	}
+	return newReviewPage(reviews, from, hasMore), nil
+}
+
+// queryIndex reads up to limit reviews of iq from the cursor, in the
+// order they are read: newest first, or oldest first for Newer pages.
+func (s *DynamoStore) queryIndex(ctx context.Context, iq indexQuery, from *cursor, limit int) ([]Review, error) {
+	input := s.reviewQueryInput(iq)
+	input.Limit = aws.Int32(int32(limit))
+	if from != nil {
+		// The start key is the table key plus the key of the index, whose
+		// partition is the one being queried. It need not be in the
+		// index, so a cursor taken from another index works too.
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"SubmissionID": &types.AttributeValueMemberS{Value: from.Key["SubmissionID"]},
+			"Timestamp":    &types.AttributeValueMemberS{Value: from.Key["Timestamp"]},
+			iq.index.Key:   &types.AttributeValueMemberS{Value: iq.index.Value},
+		}
+		// Newer pages are read walking the index forward from the cursor.
+		input.ScanIndexForward = aws.Bool(from.Dir == Newer)
+	}
+
+	// The filter runs after Limit is applied, so keep reading pages until
+	// enough reviews match or the index is exhausted.
+	var reviews []Review
+	for len(reviews) < limit {
+		out, err := s.client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query reviews: %w", err)
+		}
+
+		var page []Review
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal reviews: %w", err)
+		}
+		reviews = append(reviews, page...)
+
+		if out.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+	if len(reviews) > limit {
+		reviews = reviews[:limit]
+	}
+	return reviews, nil
+}
+
+func (s *DynamoStore) CountReviews(ctx context.Context, q ReviewQuery) (int, error) {
+	total := 0
+	for _, iq := range reviewIndexesFor(q) {
+		input := s.reviewQueryInput(iq)
+		input.Select = types.SelectCount
+
+		paginator := dynamodb.NewQueryPaginator(s.client, input)
+		for paginator.HasMorePages() {
+			out, err := paginator.NextPage(ctx)
+			if err != nil {
+				return 0, fmt.Errorf("failed to count reviews: %w", err)
+			}
+			total += int(out.Count)
+		}
+	}
+	return total, nil
+}
+
+// reviewFilter translates the filters of q into a filter expression with
+// its values and attribute names. ReviewQuery.matches is the in-memory
+// equivalent.
+func reviewFilter(q ReviewQuery) (string, map[string]types.AttributeValue, map[string]string) {
+	conditions := []string{"TeamID = :tid"}
+	values := map[string]types.AttributeValue{
+		":tid": &types.AttributeValueMemberS{Value: q.TeamID},
+	}
+	names := make(map[string]string)
+
+	if q.AuthorID != "" {
+		author := "UserID = :author"
+		values[":author"] = &types.AttributeValueMemberS{Value: q.AuthorID}
+		if q.AuthorHash != "" {
+			author = "(UserID = :author OR ReviewerHash = :authorHash)"
+			values[":authorHash"] = &types.AttributeValueMemberS{Value: q.AuthorHash}
+		}
+		conditions = append(conditions, author)
+	}
+
+	if q.CycleID != "" {
+		conditions = append(conditions, "CycleID = :cycle")
+		values[":cycle"] = &types.AttributeValueMemberS{Value: q.CycleID}
+	}
+
+	if q.RevieweeID != "" {
+		conditions = append(conditions, "RevieweeID = :reviewee")
+		values[":reviewee"] = &types.AttributeValueMemberS{Value: q.RevieweeID}
+	}
+
+	// Timestamp is a reserved word.
+	if q.Since != "" {
+		conditions = append(conditions, "#ts >= :since")
+		values[":since"] = &types.AttributeValueMemberS{Value: q.Since}
+		names["#ts"] = "Timestamp"
+	}
+	if q.Until != "" {
+		conditions = append(conditions, "#ts < :until")
+		values[":until"] = &types.AttributeValueMemberS{Value: q.Until}
+		names["#ts"] = "Timestamp"
+	}
+
+	if q.ApprovedOnly {
+		conditions = append(conditions, "(attribute_not_exists(ReviewStatus) OR ReviewStatus = :approved)")
+		values[":approved"] = &types.AttributeValueMemberS{Value: StatusApproved}
+	}
+
+	if q.Visible != nil && !q.Visible.All {
+		conditions = append(conditions, visibilityFilter(*q.Visible, values))
+	}
+
+	return strings.Join(conditions, " AND "), values, names
+}
+
+// visibilityFilter translates v into a condition, adding its values.
+// IN takes at most 100 operands, so long reviewee lists are split.
+func visibilityFilter(v Visibility, values map[string]types.AttributeValue) string {
+	var alternatives []string
+	for start := 0; start < len(v.RevieweeIDs); start += 100 {
+		end := start + 100
+		if end > len(v.RevieweeIDs) {
+			end = len(v.RevieweeIDs)
+		}
+		var names []string
+		for i := start; i < end; i++ {
+			name := ":reviewee" + strconv.Itoa(i)
+			values[name] = &types.AttributeValueMemberS{Value: v.RevieweeIDs[i]}
+			names = append(names, name)
+		}
+		alternatives = append(alternatives, "RevieweeID IN ("+strings.Join(names, ", ")+")")
+	}
+	if v.AuthorID != "" {
+		alternatives = append(alternatives, "UserID = :viewer")
+		values[":viewer"] = &types.AttributeValueMemberS{Value: v.AuthorID}
+	}
+	if v.AuthorHash != "" {
+		alternatives = append(alternatives, "ReviewerHash = :viewerHash")
+		values[":viewerHash"] = &types.AttributeValueMemberS{Value: v.AuthorHash}
+	}
+
+	if len(alternatives) == 0 {
+		// Nothing is visible; every review has a SubmissionID.
+		return "attribute_not_exists(SubmissionID)"
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+func (s *DynamoStore) EachReview(ctx context.Context, fn func(Review) error) error {
+	return s.scan(ctx, s.tables.Reviews, func(item map[string]types.AttributeValue) error {
+		var r Review
+		if err := attributevalue.UnmarshalMap(item, &r); err != nil {
+			return fmt.Errorf("failed to unmarshal review: %w", err)
+		}
+		return fn(r)
+	})
+}
+
+func (s *DynamoStore) PutUser(ctx context.Context, u *User) error {
+	item, err := attributevalue.MarshalMap(u)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tables.Users),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put item in DynamoDB: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) EachUser(ctx context.Context, fn func(User) error) error {
+	return s.scan(ctx, s.tables.Users, func(item map[string]types.AttributeValue) error {
+		var u User
+		if err := attributevalue.UnmarshalMap(item, &u); err != nil {
+			return fmt.Errorf("failed to unmarshal user: %w", err)
+		}
+		return fn(u)
+	})
+}
+
+// scan pages through every item in table.
+func (s *DynamoStore) scan(ctx context.Context, table string, fn func(map[string]types.AttributeValue) error) error {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName: aws.String(table),
+	})
+
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", table, err)
+		}
+		for _, item := range out.Items {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *DynamoStore) ReplaceRoster(ctx context.Context, teamID string, members []RosterMember) error {
+	keep := make(map[string]bool, len(members))
+	var writes []types.WriteRequest
+	for _, m := range members {
+		keep[m.UserID] = true
+		item, err := attributevalue.MarshalMap(m)
+		if err != nil {
+			return fmt.Errorf("failed to marshal roster member: %w", err)
+		}
+		writes = append(writes, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.tables.Roster),
+		KeyConditionExpression: aws.String("TeamID = :tid"),
+		ProjectionExpression:   aws.String("UserID"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":tid": &types.AttributeValueMemberS{Value: teamID},
+		},
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to query roster: %w", err)
+		}
+		for _, item := range out.Items {
+			id, ok := item["UserID"].(*types.AttributeValueMemberS)
+			if !ok || keep[id.Value] {
+				continue
+			}
+			writes = append(writes, types.WriteRequest{DeleteRequest: &types.DeleteRequest{
+				Key: map[string]types.AttributeValue{
+					"TeamID": &types.AttributeValueMemberS{Value: teamID},
+					"UserID": id,
+				},
+			}})
+		}
+	}
+
+	return s.batchWrite(ctx, s.tables.Roster, writes)
+}
+
+func (s *DynamoStore) GetRosterMember(ctx context.Context, teamID, userID string) (*RosterMember, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Roster),
+		Key: map[string]types.AttributeValue{
+			"TeamID": &types.AttributeValueMemberS{Value: teamID},
+			"UserID": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item from DynamoDB: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: %s is not on the roster of team %s", ErrNotFound, userID, teamID)
+	}
+
+	var m RosterMember
+	if err := attributevalue.UnmarshalMap(result.Item, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal roster member: %w", err)
+	}
+	return &m, nil
+}
+
+func (s *DynamoStore) CountRoster(ctx context.Context, teamID string) (int, error) {
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.tables.Roster),
+		KeyConditionExpression: aws.String("TeamID = :tid"),
+		Select:                 types.SelectCount,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":tid": &types.AttributeValueMemberS{Value: teamID},
+		},
+	})
+
+	total := 0
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count roster: %w", err)
+		}
+		total += int(out.Count)
+	}
+	return total, nil
+}
+
+func (s *DynamoStore) SearchRoster(ctx context.Context, teamID, query string, limit int) ([]RosterMember, error) {
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.tables.Roster),
+		KeyConditionExpression: aws.String("TeamID = :tid"),
+		FilterExpression:       aws.String("contains(SearchText, :q)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":tid": &types.AttributeValueMemberS{Value: teamID},
+			":q":   &types.AttributeValueMemberS{Value: query},
+		},
+	})
+
+	var members []RosterMember
+	for paginator.HasMorePages() && len(members) < limit {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query roster: %w", err)
+		}
+
+		var page []RosterMember
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal roster members: %w", err)
+		}
+		members = append(members, page...)
+	}
+
+	if len(members) > limit {
+		members = members[:limit]
+	}
+	return members, nil
+}
+
+func (s *DynamoStore) PutCycle(ctx context.Context, c *Cycle) error {
+	item, err := attributevalue.MarshalMap(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cycle: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tables.Cycles),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put item in DynamoDB: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetCycle(ctx context.Context, teamID, cycleID string) (*Cycle, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Cycles),
+		Key: map[string]types.AttributeValue{
+			"TeamID":  &types.AttributeValueMemberS{Value: teamID},
+			"CycleID": &types.AttributeValueMemberS{Value: cycleID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item from DynamoDB: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: cycle %s of team %s", ErrNotFound, cycleID, teamID)
+	}
+
+	var c Cycle
+	if err := attributevalue.UnmarshalMap(result.Item, &c); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cycle: %w", err)
+	}
+	return &c, nil
+}
+
+func (s *DynamoStore) ListCycles(ctx context.Context, teamID string) ([]Cycle, error) {
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.tables.Cycles),
+		KeyConditionExpression: aws.String("TeamID = :tid"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":tid": &types.AttributeValueMemberS{Value: teamID},
+		},
+	})
+
+	var cycles []Cycle
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query cycles: %w", err)
+		}
+
+		var page []Cycle
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal cycles: %w", err)
+		}
+		cycles = append(cycles, page...)
+	}
+
+	sortCycles(cycles)
+	return cycles, nil
+}
+
+func (s *DynamoStore) PutDraft(ctx context.Context, d *Draft) error {
+	item, err := attributevalue.MarshalMap(d)
+	if err != nil {
+		return fmt.Errorf("failed to marshal draft: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tables.Drafts),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put item in DynamoDB: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetDraft(ctx context.Context, userID, draftID string) (*Draft, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Drafts),
+		Key: map[string]types.AttributeValue{
+			"UserID":  &types.AttributeValueMemberS{Value: userID},
+			"DraftID": &types.AttributeValueMemberS{Value: draftID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item from DynamoDB: %w", err)
+	}
+
+	var d Draft
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, &d); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal draft: %w", err)
+		}
+	}
+	// The TTL deletes items some time after they expire, not exactly then.
+	if result.Item == nil || d.ExpiresAt <= time.Now().Unix() {
+		return nil, fmt.Errorf("%w: draft %s of %s", ErrNotFound, draftID, userID)
+	}
+	return &d, nil
+}
+
+func (s *DynamoStore) ListDrafts(ctx context.Context, userID string) ([]Draft, error) {
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.tables.Drafts),
+		KeyConditionExpression: aws.String("UserID = :uid"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":uid": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+
+	var drafts []Draft
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query drafts: %w", err)
+		}
+
+		var page []Draft
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal drafts: %w", err)
+		}
+		drafts = append(drafts, page...)
+	}
+	return liveDrafts(drafts, time.Now().Unix()), nil
+}
+
+func (s *DynamoStore) EachDraft(ctx context.Context, fn func(Draft) error) error {
+	now := time.Now().Unix()
+	return s.scan(ctx, s.tables.Drafts, func(item map[string]types.AttributeValue) error {
+		var d Draft
+		if err := attributevalue.UnmarshalMap(item, &d); err != nil {
+			return fmt.Errorf("failed to unmarshal draft: %w", err)
+		}
+		// DynamoDB deletes expired items some time after they expire.
+		if d.ExpiresAt <= now {
+			return nil
+		}
+		return fn(d)
+	})
+}
+
+func (s *DynamoStore) DeleteDraft(ctx context.Context, userID, draftID string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tables.Drafts),
+		Key: map[string]types.AttributeValue{
+			"UserID":  &types.AttributeValueMemberS{Value: userID},
+			"DraftID": &types.AttributeValueMemberS{Value: draftID},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete item from DynamoDB: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetPreferences(ctx context.Context, teamID, userID string) (*Preferences, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Prefs),
+		Key: map[string]types.AttributeValue{
+			"TeamID": &types.AttributeValueMemberS{Value: teamID},
+			"UserID": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item from DynamoDB: %w", err)
+	}
+
+	p := Preferences{TeamID: teamID, UserID: userID}
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, &p); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal preferences: %w", err)
+		}
+	}
+	return &p, nil
+}
+
+func (s *DynamoStore) PutPreferences(ctx context.Context, p *Preferences) error {
+	item, err := attributevalue.MarshalMap(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal preferences: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tables.Prefs),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put item in DynamoDB: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) PutOutbox(ctx context.Context, m *OutboxMessage) error {
+	item, err := attributevalue.MarshalMap(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox message: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tables.Outbox),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put item in DynamoDB: %w", err)
+	}
+	return nil
+}
+
+// DueOutbox scans the whole outbox, which only holds undelivered messages
+// and so stays small.
+func (s *DynamoStore) DueOutbox(ctx context.Context, now int64, limit int) ([]OutboxMessage, error) {
+	var messages []OutboxMessage
+	err := s.scan(ctx, s.tables.Outbox, func(item map[string]types.AttributeValue) error {
+		var m OutboxMessage
+		if err := attributevalue.UnmarshalMap(item, &m); err != nil {
+			return fmt.Errorf("failed to unmarshal outbox message: %w", err)
+		}
+		messages = append(messages, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dueOutbox(messages, now, limit), nil
+}
+
+func (s *DynamoStore) ClaimOutbox(ctx context.Context, messageID string, due, until int64) (bool, error) {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tables.Outbox),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+		UpdateExpression:    aws.String("SET NextAttemptAt = :until"),
+		ConditionExpression: aws.String("NextAttemptAt = :due"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":due":   &types.AttributeValueMemberN{Value: strconv.FormatInt(due, 10)},
+			":until": &types.AttributeValueMemberN{Value: strconv.FormatInt(until, 10)},
+		},
+	})
+	var conflict *types.ConditionalCheckFailedException
+	if errors.As(err, &conflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim outbox message %s: %w", messageID, err)
+	}
+	return true, nil
+}
+
+func (s *DynamoStore) DeleteOutbox(ctx context.Context, messageID string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tables.Outbox),
+		Key: map[string]types.AttributeValue{
+			"MessageID": &types.AttributeValueMemberS{Value: messageID},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete item from DynamoDB: %w", err)
+	}
+	return nil
+}
+
+// AddStats updates stats items, which are keyed by TeamID and StatKey and
+// hold the counter in Total, since Count and Value are reserved words.
+func (s *DynamoStore) AddStats(ctx context.Context, teamID string, deltas map[string]int) error {
+	for key, delta := range deltas {
+		_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(s.tables.Stats),
+			Key: map[string]types.AttributeValue{
+				"TeamID":  &types.AttributeValueMemberS{Value: teamID},
+				"StatKey": &types.AttributeValueMemberS{Value: key},
+			},
+			UpdateExpression: aws.String("ADD Total :d"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":d": &types.AttributeValueMemberN{Value: strconv.Itoa(delta)},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update stat %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (s *DynamoStore) ReplaceStats(ctx context.Context, teamID string, counters map[string]int) error {
+	existing, err := s.GetStats(ctx, teamID)
+	if err != nil {
+		return err
+	}
+
+	var writes []types.WriteRequest
+	for key, n := range counters {
+		writes = append(writes, types.WriteRequest{PutRequest: &types.PutRequest{Item: map[string]types.AttributeValue{
+			"TeamID":  &types.AttributeValueMemberS{Value: teamID},
+			"StatKey": &types.AttributeValueMemberS{Value: key},
+			"Total":   &types.AttributeValueMemberN{Value: strconv.Itoa(n)},
+		}}})
+	}
+	for key := range existing {
+		if _, ok := counters[key]; ok {
+			continue
+		}
+		writes = append(writes, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: map[string]types.AttributeValue{
+			"TeamID":  &types.AttributeValueMemberS{Value: teamID},
+			"StatKey": &types.AttributeValueMemberS{Value: key},
+		}}})
+	}
+
+	return s.batchWrite(ctx, s.tables.Stats, writes)
+}
+
+func (s *DynamoStore) GetStats(ctx context.Context, teamID string) (map[string]int, error) {
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.tables.Stats),
+		KeyConditionExpression: aws.String("TeamID = :tid"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":tid": &types.AttributeValueMemberS{Value: teamID},
+		},
+	})
+
+	stats := make(map[string]int)
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query stats: %w", err)
+		}
+
+		var items []struct {
+			StatKey string `dynamodbav:"StatKey"`
+			Total   int    `dynamodbav:"Total"`
+		}
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &items); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stats: %w", err)
+		}
+		for _, item := range items {
+			stats[item.StatKey] = item.Total
+		}
+	}
+	return stats, nil
+}
+
+// Unprocessed batch items are retried after a delay doubling from
+// batchRetryBase up to batchRetryMax.
+const (
+	batchRetryBase = 50 * time.Millisecond
+	batchRetryMax  = 5 * time.Second
+)
+
+// batchWrite sends writes to table in batches of 25, retrying any items
+// DynamoDB leaves unprocessed until ctx is done.
+func (s *DynamoStore) batchWrite(ctx context.Context, table string, writes []types.WriteRequest) error {
+	for len(writes) > 0 {
+		n := len(writes)
+		if n > 25 {
+			n = 25
+		}
+
+		pending := map[string][]types.WriteRequest{table: writes[:n]}
+		for delay := batchRetryBase; len(pending[table]) > 0; delay *= 2 {
+			out, err := s.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return fmt.Errorf("failed to batch write %s: %w", table, err)
+			}
+			pending = out.UnprocessedItems
+			if len(pending[table]) == 0 {
+				break
+			}
+
+			if delay > batchRetryMax {
+				delay = batchRetryMax
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("failed to batch write %s: %w", table, ctx.Err())
+			case <-time.After(delay):
+			}
+		}
+		writes = writes[n:]
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetJobRun(ctx context.Context, name string) (*JobRun, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tables.Jobs),
+		Key: map[string]types.AttributeValue{
+			"Name": &types.AttributeValueMemberS{Value: name},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item from DynamoDB: %w", err)
+	}
+
+	r := JobRun{Name: name}
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, &r); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal job run: %w", err)
+		}
+	}
+	return &r, nil
+}
+
+func (s *DynamoStore) PutJobRun(ctx context.Context, r *JobRun) error {
+	item, err := attributevalue.MarshalMap(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job run: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tables.Jobs),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put item in DynamoDB: %w", err)
+	}
+	return nil
+}
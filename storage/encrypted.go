@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// Cipher seals and opens individual attribute values. A value only opens
+// with the context it was sealed with.
+type Cipher interface {
+	Encrypt(ctx context.Context, plaintext, aad string) (string, error)
+	Decrypt(ctx context.Context, value, aad string) (string, error)
+}
+
+// field is an encrypted attribute and the context binding it to its
+// record: the logical table, the record key and the attribute path.
+// Configured table names are left out so tables can be renamed.
+type field struct {
+	value *string
+	aad   string
+}
+
+func newField(value *string, table, key, attribute string) field {
+	return field{value: value, aad: table + "|" + key + "|" + attribute}
+}
+
+// encryptedStore encrypts credentials and feedback text on the way into
+// the wrapped Store and decrypts them on the way out. Methods that do not
+// touch those attributes are promoted from the embedded Store unchanged.
+type encryptedStore struct {
+	Store
+	cipher Cipher
+}
+
+// NewEncryptedStore wraps inner so that bot, app and user tokens and
+// review feedback are only ever persisted encrypted by c.
+func NewEncryptedStore(inner Store, c Cipher) Store {
+	return &encryptedStore{Store: inner, cipher: c}
+}
+
+func (s *encryptedStore) encrypt(ctx context.Context, fields ...field) error {
+	for _, f := range fields {
+		v, err := s.cipher.Encrypt(ctx, *f.value, f.aad)
+		if err != nil {
+			return err
+		}
+		*f.value = v
+	}
+	return nil
+}
+
+func (s *encryptedStore) decrypt(ctx context.Context, fields ...field) error {
+	for _, f := range fields {
+		v, err := s.cipher.Decrypt(ctx, *f.value, f.aad)
+		if err != nil {
+			return err
+		}
+		*f.value = v
+	}
+	return nil
+}
+
+func botTokenFields(teamID string, t *BotTokens) []field {
+	return []field{
+		newField(&t.AccessToken, "Tokens", teamID, "BotAccessToken"),
+		newField(&t.RefreshToken, "Tokens", teamID, "BotRefreshToken"),
+	}
+}
+
+func appTokenFields(teamID string, t *AppTokens) []field {
+	return []field{
+		newField(&t.AuthToken, "Tokens", teamID, "AppAuthToken"),
+		newField(&t.RefreshToken, "Tokens", teamID, "AppRefreshToken"),
+	}
+}
+
+func teamTokenFields(t *TeamTokens) []field {
+	return append(botTokenFields(t.TeamID, &t.BotTokens), appTokenFields(t.TeamID, &t.AppTokens)...)
+}
+
+func (s *encryptedStore) PutTeamTokens(ctx context.Context, t *TeamTokens) error {
+	sealed := *t
+	if err := s.encrypt(ctx, teamTokenFields(&sealed)...); err != nil {
+		return err
+	}
+	return s.Store.PutTeamTokens(ctx, &sealed)
+}
+
+func (s *encryptedStore) GetTeamTokens(ctx context.Context, teamID string) (*TeamTokens, error) {
+	t, err := s.Store.GetTeamTokens(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.decrypt(ctx, teamTokenFields(t)...); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ReplaceBotTokens compares refreshToken with the stored one once it is
+// decrypted, since sealing the same token twice gives different values,
+// and then makes the write conditional on the sealed value it read.
+func (s *encryptedStore) ReplaceBotTokens(ctx context.Context, teamID, refreshToken string, t BotTokens) (bool, error) {
+	sealed, ok, err := s.storedRefreshToken(ctx, teamID, refreshToken, func(t *TeamTokens) field {
+		return botTokenFields(teamID, &t.BotTokens)[1]
+	})
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := s.encrypt(ctx, botTokenFields(teamID, &t)...); err != nil {
+		return false, err
+	}
+	return s.Store.ReplaceBotTokens(ctx, teamID, sealed, t)
+}
+
+func (s *encryptedStore) ReplaceAppTokens(ctx context.Context, teamID, refreshToken string, t AppTokens) (bool, error) {
+	sealed, ok, err := s.storedRefreshToken(ctx, teamID, refreshToken, func(t *TeamTokens) field {
+		return appTokenFields(teamID, &t.AppTokens)[1]
+	})
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := s.encrypt(ctx, appTokenFields(teamID, &t)...); err != nil {
+		return false, err
+	}
+	return s.Store.ReplaceAppTokens(ctx, teamID, sealed, t)
+}
+
+// storedRefreshToken returns the refresh token field picks out of the
+// stored tokens of teamID as it is stored, and whether it decrypts to
+// refreshToken.
+func (s *encryptedStore) storedRefreshToken(ctx context.Context, teamID, refreshToken string, pick func(*TeamTokens) field) (string, bool, error) {
+	t, err := s.Store.GetTeamTokens(ctx, teamID)
+	if errors.Is(err, ErrNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	f := pick(t)
+	sealed := *f.value
+	if err := s.decrypt(ctx, f); err != nil {
+		return "", false, err
+	}
+	return sealed, *f.value == refreshToken, nil
+}
+
+func (s *encryptedStore) PutReview(ctx context.Context, r *Review) error {
+	sealed := *r
+	if err := s.encrypt(ctx, reviewFields(&sealed)...); err != nil {
+		return err
+	}
+	return s.Store.PutReview(ctx, &sealed)
+}
+
+func (s *encryptedStore) ReplaceReview(ctx context.Context, r *Review, revision int) (bool, error) {
+	sealed := *r
+	if err := s.encrypt(ctx, reviewFields(&sealed)...); err != nil {
+		return false, err
+	}
+	return s.Store.ReplaceReview(ctx, &sealed, revision)
+}
+
+func (s *encryptedStore) GetReview(ctx context.Context, submissionID string) (*Review, error) {
+	r, err := s.Store.GetReview(ctx, submissionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.decrypt(ctx, reviewFields(r)...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *encryptedStore) QueryReviews(ctx context.Context, q ReviewQuery) (*ReviewPage, error) {
+	page, err := s.Store.QueryReviews(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Reviews {
+		if err := s.decrypt(ctx, reviewFields(&page.Reviews[i])...); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+func (s *encryptedStore) EachReview(ctx context.Context, fn func(Review) error) error {
+	return s.Store.EachReview(ctx, func(r Review) error {
+		if err := s.decrypt(ctx, reviewFields(&r)...); err != nil {
+			return err
+		}
+		return fn(r)
+	})
+}
+
+// reviewFields returns the free-text fields of r, which are encrypted. It
+// gives r its own copies of Answers and StatusHistory first so the
+// caller's slices, which may be shared with the underlying store, are not
+// modified.
+func reviewFields(r *Review) []field {
+	r.Answers = append([]Answer(nil), r.Answers...)
+	r.StatusHistory = append([]StatusChange(nil), r.StatusHistory...)
+	fields := []field{newField(&r.Feedback, "Reviews", r.SubmissionID, "Feedback")}
+	for i := range r.Answers {
+		fields = append(fields, newField(&r.Answers[i].Text, "Reviews", r.SubmissionID, "Answers."+r.Answers[i].QuestionID+".Text"))
+	}
+	// The history is only ever appended to, so positions are stable.
+	for i := range r.StatusHistory {
+		fields = append(fields, newField(&r.StatusHistory[i].Comment, "Reviews", r.SubmissionID, "StatusHistory."+strconv.Itoa(i)+".Comment"))
+	}
+	return fields
+}
+
+func (s *encryptedStore) PutUser(ctx context.Context, u *User) error {
+	sealed := *u
+	if err := s.encrypt(ctx, userFields(&sealed)...); err != nil {
+		return err
+	}
+	return s.Store.PutUser(ctx, &sealed)
+}
+
+func (s *encryptedStore) EachUser(ctx context.Context, fn func(User) error) error {
+	return s.Store.EachUser(ctx, func(u User) error {
+		if err := s.decrypt(ctx, userFields(&u)...); err != nil {
+			return err
+		}
+		return fn(u)
+	})
+}
+
+func userFields(u *User) []field {
+	return []field{newField(&u.Token, "Users", u.UserID, "Token")}
+}
+
+// draftFields returns the free-text fields of d, copying Answers first for
+// the same reason as reviewFields.
+func draftFields(d *Draft) []field {
+	d.Answers = append([]Answer(nil), d.Answers...)
+	var fields []field
+	for i := range d.Answers {
+		fields = append(fields, newField(&d.Answers[i].Text, "Drafts", d.UserID+"/"+d.DraftID, "Answers."+d.Answers[i].QuestionID+".Text"))
+	}
+	return fields
+}
+
+func (s *encryptedStore) PutDraft(ctx context.Context, d *Draft) error {
+	sealed := *d
+	if err := s.encrypt(ctx, draftFields(&sealed)...); err != nil {
+		return err
+	}
+	return s.Store.PutDraft(ctx, &sealed)
+}
+
+func (s *encryptedStore) GetDraft(ctx context.Context, userID, draftID string) (*Draft, error) {
+	d, err := s.Store.GetDraft(ctx, userID, draftID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.decrypt(ctx, draftFields(d)...); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *encryptedStore) ListDrafts(ctx context.Context, userID string) ([]Draft, error) {
+	drafts, err := s.Store.ListDrafts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range drafts {
+		if err := s.decrypt(ctx, draftFields(&drafts[i])...); err != nil {
+			return nil, err
+		}
+	}
+	return drafts, nil
+}
+
+func (s *encryptedStore) EachDraft(ctx context.Context, fn func(Draft) error) error {
+	return s.Store.EachDraft(ctx, func(d Draft) error {
+		if err := s.decrypt(ctx, draftFields(&d)...); err != nil {
+			return err
+		}
+		return fn(d)
+	})
+}
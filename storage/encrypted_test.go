@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// sealCipher seals values as sealed:<n>:<aad>:<plaintext>, numbering each
+// one so that sealing the same value twice differs, as real ciphers do.
+type sealCipher struct {
+	n int
+}
+
+func (c *sealCipher) Encrypt(ctx context.Context, plaintext, aad string) (string, error) {
+	c.n++
+	return fmt.Sprintf("sealed:%d:%s:%s", c.n, aad, plaintext), nil
+}
+
+func (c *sealCipher) Decrypt(ctx context.Context, value, aad string) (string, error) {
+	parts := strings.SplitN(value, ":", 4)
+	if len(parts) != 4 || parts[0] != "sealed" || parts[2] != aad {
+		return "", fmt.Errorf("cannot open %q with %q", value, aad)
+	}
+	return parts[3], nil
+}
+
+func TestEncryptedReplaceTokens(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMemoryStore()
+	s := NewEncryptedStore(inner, &sealCipher{})
+	err := s.PutTeamTokens(ctx, &TeamTokens{
+		TeamID:    "T1",
+		BotTokens: BotTokens{AccessToken: "xoxb-1", RefreshToken: "xoxe-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name      string
+		team      string
+		refresh   string
+		next      string
+		wantOK    bool
+		wantStore string
+	}{
+		{"current", "T1", "xoxe-1", "xoxe-2", true, "xoxe-2"},
+		{"spent", "T1", "xoxe-1", "xoxe-3", false, "xoxe-2"},
+		{"rewrite", "T1", "xoxe-2", "xoxe-2", true, "xoxe-2"},
+		{"unknown team", "T2", "", "xoxe-4", false, "xoxe-2"},
+	}
+	for _, step := range steps {
+		ok, err := s.ReplaceBotTokens(ctx, step.team, step.refresh, BotTokens{AccessToken: "xoxb", RefreshToken: step.next})
+		if err != nil || ok != step.wantOK {
+			t.Fatalf("%s: ReplaceBotTokens = %v, %v; want %v", step.name, ok, err, step.wantOK)
+		}
+		got, err := s.GetTeamTokens(ctx, "T1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.BotTokens.RefreshToken != step.wantStore {
+			t.Fatalf("%s: stored refresh token %q, want %q", step.name, got.BotTokens.RefreshToken, step.wantStore)
+		}
+	}
+
+	raw, _ := inner.GetTeamTokens(ctx, "T1")
+	if !strings.HasPrefix(raw.BotTokens.RefreshToken, "sealed:") {
+		t.Fatalf("refresh token stored unsealed: %q", raw.BotTokens.RefreshToken)
+	}
+
+	// App tokens that were never stored are replaced from an empty one.
+	ok, err := s.ReplaceAppTokens(ctx, "T1", "", AppTokens{AuthToken: "xoxe.xoxp-1", RefreshToken: "xoxe-a1"})
+	if err != nil || !ok {
+		t.Fatalf("ReplaceAppTokens = %v, %v; want true", ok, err)
+	}
+	if ok, _ := s.ReplaceAppTokens(ctx, "T1", "", AppTokens{RefreshToken: "xoxe-a2"}); ok {
+		t.Fatal("ReplaceAppTokens replaced tokens stored since they were read")
+	}
+}
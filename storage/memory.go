@@ -0,0 +1,517 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps everything in process memory. It is
+// meant for running the bot locally without AWS; nothing survives a restart.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	teams   map[string]TeamTokens
+	reviews map[string]Review
+	users   map[string]User
+	roster  map[string]map[string]RosterMember
+	cycles  map[string]map[string]Cycle
+	stats   map[string]map[string]int
+	drafts  map[string]map[string]Draft
+	prefs   map[string]Preferences
+	outbox  map[string]OutboxMessage
+	jobs    map[string]JobRun
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		teams:   make(map[string]TeamTokens),
+		reviews: make(map[string]Review),
+		users:   make(map[string]User),
+		roster:  make(map[string]map[string]RosterMember),
+		cycles:  make(map[string]map[string]Cycle),
+		stats:   make(map[string]map[string]int),
+		drafts:  make(map[string]map[string]Draft),
+		prefs:   make(map[string]Preferences),
+		outbox:  make(map[string]OutboxMessage),
+		jobs:    make(map[string]JobRun),
+	}
+}
+
+func (s *MemoryStore) PutTeamTokens(ctx context.Context, t *TeamTokens) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.teams[t.TeamID] = *t
+	return nil
+}
+
+func (s *MemoryStore) GetTeamTokens(ctx context.Context, teamID string) (*TeamTokens, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.teams[teamID]
+	if !ok {
+		return nil, fmt.Errorf("%w: no tokens for team %s", ErrNotFound, teamID)
+	}
+	return &t, nil
+}
+
+func (s *MemoryStore) ReplaceBotTokens(ctx context.Context, teamID, refreshToken string, t BotTokens) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team, ok := s.teams[teamID]
+	if !ok || team.BotTokens.RefreshToken != refreshToken {
+		return false, nil
+	}
+	team.BotTokens = t
+	s.teams[teamID] = team
+	return true, nil
+}
+
+func (s *MemoryStore) ReplaceAppTokens(ctx context.Context, teamID, refreshToken string, t AppTokens) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team, ok := s.teams[teamID]
+	if !ok || team.AppTokens.RefreshToken != refreshToken {
+		return false, nil
+	}
+	team.AppTokens = t
+	s.teams[teamID] = team
+	return true, nil
+}
+
+func (s *MemoryStore) ListTeamIDs(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	teamIDs := make([]string, 0, len(s.teams))
+	for teamID := range s.teams {
+		teamIDs = append(teamIDs, teamID)
+	}
+	sort.Strings(teamIDs)
+	return teamIDs, nil
+}
+
+func (s *MemoryStore) PutReview(ctx context.Context, r *Review) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reviews[r.SubmissionID] = *r
+	return nil
+}
+
+func (s *MemoryStore) ReplaceReview(ctx context.Context, r *Review, revision int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.reviews[r.SubmissionID]; !ok || stored.Revision != revision {
+		return false, nil
+	}
+	s.reviews[r.SubmissionID] = *r
+	return true, nil
+}
+
+func (s *MemoryStore) SetApprovalRequests(ctx context.Context, submissionID string, revision int, requests []MessageRef) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.reviews[submissionID]
+	if !ok || r.Revision != revision {
+		return false, nil
+	}
+	r.ApprovalRequests = requests
+	s.reviews[submissionID] = r
+	return true, nil
+}
+
+func (s *MemoryStore) GetReview(ctx context.Context, submissionID string) (*Review, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.reviews[submissionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: review %s", ErrNotFound, submissionID)
+	}
+	return &r, nil
+}
+
+func (s *MemoryStore) DeleteReview(ctx context.Context, submissionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.reviews, submissionID)
+	return nil
+}
+
+func (s *MemoryStore) CountReviews(ctx context.Context, q ReviewQuery) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := 0
+	for _, r := range s.reviews {
+		if q.matches(r) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) QueryReviews(ctx context.Context, q ReviewQuery) (*ReviewPage, error) {
+	var from *cursor
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		from = c
+	}
+
+	s.mu.RLock()
+	reviews := make([]Review, 0, len(s.reviews))
+	for _, r := range s.reviews {
+		if q.matches(r) {
+			reviews = append(reviews, r)
+		}
+	}
+	s.mu.RUnlock()
+
+	newer := func(a, b Review) bool {
+		if a.Timestamp != b.Timestamp {
+			return a.Timestamp > b.Timestamp
+		}
+		return a.SubmissionID > b.SubmissionID
+	}
+	sort.Slice(reviews, func(i, j int) bool {
+		return newer(reviews[i], reviews[j])
+	})
+
+	if from == nil {
+		hasMore := len(reviews) > q.Limit
+		if hasMore {
+			reviews = reviews[:q.Limit]
+		}
+		return newReviewPage(reviews, nil, hasMore), nil
+	}
+
+	key := Review{SubmissionID: from.Key["SubmissionID"], Timestamp: from.Key["Timestamp"]}
+	if from.Dir == Older {
+		start := sort.Search(len(reviews), func(i int) bool { return newer(key, reviews[i]) })
+		reviews = reviews[start:]
+		hasMore := len(reviews) > q.Limit
+		if hasMore {
+			reviews = reviews[:q.Limit]
+		}
+		return newReviewPage(reviews, from, hasMore), nil
+	}
+
+	end := sort.Search(len(reviews), func(i int) bool { return !newer(reviews[i], key) })
+	reviews = reviews[:end]
+	hasMore := len(reviews) > q.Limit
+	if hasMore {
+		reviews = reviews[len(reviews)-q.Limit:]
+	}
+	return newReviewPage(reviews, from, hasMore), nil
+}
+
+func (s *MemoryStore) EachReview(ctx context.Context, fn func(Review) error) error {
+	s.mu.RLock()
+	reviews := make([]Review, 0, len(s.reviews))
+	for _, r := range s.reviews {
+		reviews = append(reviews, r)
+	}
+	s.mu.RUnlock()
+
+	for _, r := range reviews {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) PutUser(ctx context.Context, u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[u.UserID] = *u
+	return nil
+}
+
+func (s *MemoryStore) EachUser(ctx context.Context, fn func(User) error) error {
+	s.mu.RLock()
+	users := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	s.mu.RUnlock()
+
+	for _, u := range users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) ReplaceRoster(ctx context.Context, teamID string, members []RosterMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	roster := make(map[string]RosterMember, len(members))
+	for _, m := range members {
+		roster[m.UserID] = m
+	}
+	s.roster[teamID] = roster
+	return nil
+}
+
+func (s *MemoryStore) GetRosterMember(ctx context.Context, teamID, userID string) (*RosterMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m, ok := s.roster[teamID][userID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not on the roster of team %s", ErrNotFound, userID, teamID)
+	}
+	return &m, nil
+}
+
+func (s *MemoryStore) SearchRoster(ctx context.Context, teamID, query string, limit int) ([]RosterMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var members []RosterMember
+	for _, m := range s.roster[teamID] {
+		if strings.Contains(m.SearchText, query) {
+			members = append(members, m)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].UserID < members[j].UserID
+	})
+
+	if len(members) > limit {
+		members = members[:limit]
+	}
+	return members, nil
+}
+
+func (s *MemoryStore) CountRoster(ctx context.Context, teamID string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.roster[teamID]), nil
+}
+
+func (s *MemoryStore) PutCycle(ctx context.Context, c *Cycle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cycles[c.TeamID] == nil {
+		s.cycles[c.TeamID] = make(map[string]Cycle)
+	}
+	s.cycles[c.TeamID][c.CycleID] = *c
+	return nil
+}
+
+func (s *MemoryStore) GetCycle(ctx context.Context, teamID, cycleID string) (*Cycle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.cycles[teamID][cycleID]
+	if !ok {
+		return nil, fmt.Errorf("%w: cycle %s of team %s", ErrNotFound, cycleID, teamID)
+	}
+	return &c, nil
+}
+
+func (s *MemoryStore) ListCycles(ctx context.Context, teamID string) ([]Cycle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cycles := make([]Cycle, 0, len(s.cycles[teamID]))
+	for _, c := range s.cycles[teamID] {
+		cycles = append(cycles, c)
+	}
+	sortCycles(cycles)
+	return cycles, nil
+}
+
+func (s *MemoryStore) AddStats(ctx context.Context, teamID string, deltas map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stats[teamID] == nil {
+		s.stats[teamID] = make(map[string]int)
+	}
+	for key, delta := range deltas {
+		s.stats[teamID][key] += delta
+	}
+	return nil
+}
+
+func (s *MemoryStore) ReplaceStats(ctx context.Context, teamID string, counters map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]int, len(counters))
+	for key, n := range counters {
+		stats[key] = n
+	}
+	s.stats[teamID] = stats
+	return nil
+}
+
+func (s *MemoryStore) GetStats(ctx context.Context, teamID string) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := make(map[string]int, len(s.stats[teamID]))
+	for key, n := range s.stats[teamID] {
+		stats[key] = n
+	}
+	return stats, nil
+}
+
+func (s *MemoryStore) PutDraft(ctx context.Context, d *Draft) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.drafts[d.UserID] == nil {
+		s.drafts[d.UserID] = make(map[string]Draft)
+	}
+	s.drafts[d.UserID][d.DraftID] = *d
+	return nil
+}
+
+func (s *MemoryStore) GetDraft(ctx context.Context, userID, draftID string) (*Draft, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d, ok := s.drafts[userID][draftID]
+	if !ok || d.ExpiresAt <= time.Now().Unix() {
+		return nil, fmt.Errorf("%w: draft %s of %s", ErrNotFound, draftID, userID)
+	}
+	return &d, nil
+}
+
+func (s *MemoryStore) ListDrafts(ctx context.Context, userID string) ([]Draft, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	drafts := make([]Draft, 0, len(s.drafts[userID]))
+	for _, d := range s.drafts[userID] {
+		drafts = append(drafts, d)
+	}
+	return liveDrafts(drafts, time.Now().Unix()), nil
+}
+
+func (s *MemoryStore) EachDraft(ctx context.Context, fn func(Draft) error) error {
+	s.mu.RLock()
+	var drafts []Draft
+	for _, userDrafts := range s.drafts {
+		for _, d := range userDrafts {
+			drafts = append(drafts, d)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, d := range liveDrafts(drafts, time.Now().Unix()) {
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteDraft(ctx context.Context, userID, draftID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.drafts[userID], draftID)
+	return nil
+}
+
+func (s *MemoryStore) GetPreferences(ctx context.Context, teamID, userID string) (*Preferences, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.prefs[teamID+"/"+userID]
+	if !ok {
+		p = Preferences{TeamID: teamID, UserID: userID}
+	}
+	return &p, nil
+}
+
+func (s *MemoryStore) PutPreferences(ctx context.Context, p *Preferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prefs[p.TeamID+"/"+p.UserID] = *p
+	return nil
+}
+
+func (s *MemoryStore) PutOutbox(ctx context.Context, m *OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outbox[m.MessageID] = *m
+	return nil
+}
+
+func (s *MemoryStore) DueOutbox(ctx context.Context, now int64, limit int) ([]OutboxMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	messages := make([]OutboxMessage, 0, len(s.outbox))
+	for _, m := range s.outbox {
+		messages = append(messages, m)
+	}
+	return dueOutbox(messages, now, limit), nil
+}
+
+func (s *MemoryStore) ClaimOutbox(ctx context.Context, messageID string, due, until int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.outbox[messageID]
+	if !ok || m.NextAttemptAt != due {
+		return false, nil
+	}
+	m.NextAttemptAt = until
+	s.outbox[messageID] = m
+	return true, nil
+}
+
+func (s *MemoryStore) DeleteOutbox(ctx context.Context, messageID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.outbox, messageID)
+	return nil
+}
+
+func (s *MemoryStore) GetJobRun(ctx context.Context, name string) (*JobRun, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.jobs[name]
+	if !ok {
+		r = JobRun{Name: name}
+	}
+	return &r, nil
+}
+
+func (s *MemoryStore) PutJobRun(ctx context.Context, r *JobRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[r.Name] = *r
+	return nil
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// pageIDs returns the submission IDs of page in order.
+func pageIDs(page *ReviewPage) []string {
+	ids := []string{}
+	for _, r := range page.Reviews {
+		ids = append(ids, r.SubmissionID)
+	}
+	return ids
+}
+
+func TestMemoryQueryReviewsPages(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	// S1 is the oldest; S4 and S5 share a timestamp and are ordered by ID.
+	timestamps := []string{
+		"2024-01-01T00:00:00Z",
+		"2024-01-02T00:00:00Z",
+		"2024-01-03T00:00:00Z",
+		"2024-01-04T00:00:00Z",
+		"2024-01-04T00:00:00Z",
+		"2024-01-05T00:00:00Z",
+		"2024-01-06T00:00:00Z",
+	}
+	for i, ts := range timestamps {
+		r := &Review{SubmissionID: fmt.Sprintf("S%d", i+1), TeamID: "T1", Timestamp: ts}
+		if err := s.PutReview(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.PutReview(ctx, &Review{SubmissionID: "S9", TeamID: "T2", Timestamp: "2024-01-07T00:00:00Z"}); err != nil {
+		t.Fatal(err)
+	}
+
+	query := func(cursor string) *ReviewPage {
+		t.Helper()
+		page, err := s.QueryReviews(ctx, ReviewQuery{TeamID: "T1", Limit: 3, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("QueryReviews: %v", err)
+		}
+		return page
+	}
+
+	// Each step follows a cursor of the page before it.
+	steps := []struct {
+		name     string
+		follow   func(*ReviewPage) string
+		want     []string
+		wantNext bool
+		wantPrev bool
+	}{
+		{"newest", nil, []string{"S7", "S6", "S5"}, true, false},
+		{"older", func(p *ReviewPage) string { return p.Next }, []string{"S4", "S3", "S2"}, true, true},
+		{"oldest", func(p *ReviewPage) string { return p.Next }, []string{"S1"}, false, true},
+		{"back", func(p *ReviewPage) string { return p.Prev }, []string{"S4", "S3", "S2"}, true, true},
+		{"back to newest", func(p *ReviewPage) string { return p.Prev }, []string{"S7", "S6", "S5"}, true, false},
+	}
+	var page *ReviewPage
+	for _, step := range steps {
+		cursor := ""
+		if step.follow != nil {
+			cursor = step.follow(page)
+		}
+		page = query(cursor)
+		if got := pageIDs(page); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("%s: got %v, want %v", step.name, got, step.want)
+		}
+		if (page.Next != "") != step.wantNext || (page.Prev != "") != step.wantPrev {
+			t.Fatalf("%s: next %q, prev %q; want next %v, prev %v", step.name, page.Next, page.Prev, step.wantNext, step.wantPrev)
+		}
+	}
+}
+
+func TestMemoryQueryReviewsFilters(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	reviews := []Review{
+		{SubmissionID: "S1", TeamID: "T1", UserID: "U1", RevieweeID: "U2", Timestamp: "2024-01-01T00:00:00Z"},
+		{SubmissionID: "S2", TeamID: "T1", ReviewerHash: "H1", Anonymous: true, RevieweeID: "U3", Timestamp: "2024-01-02T00:00:00Z"},
+		{SubmissionID: "S3", TeamID: "T1", UserID: "U2", RevieweeID: "U1", CycleID: "C1", Timestamp: "2024-01-03T00:00:00Z"},
+		{SubmissionID: "S4", TeamID: "T2", UserID: "U1", RevieweeID: "U2", Timestamp: "2024-01-04T00:00:00Z"},
+	}
+	for i := range reviews {
+		if err := s.PutReview(ctx, &reviews[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		q    ReviewQuery
+		want []string
+	}{
+		{"team", ReviewQuery{TeamID: "T1"}, []string{"S3", "S2", "S1"}},
+		{"author", ReviewQuery{TeamID: "T1", AuthorID: "U1"}, []string{"S1"}},
+		{"author and hash", ReviewQuery{TeamID: "T1", AuthorID: "U1", AuthorHash: "H1"}, []string{"S2", "S1"}},
+		{"reviewee", ReviewQuery{TeamID: "T1", RevieweeID: "U2"}, []string{"S1"}},
+		{"cycle", ReviewQuery{TeamID: "T1", CycleID: "C1"}, []string{"S3"}},
+		{"since", ReviewQuery{TeamID: "T1", Since: "2024-01-02T00:00:00Z"}, []string{"S3", "S2"}},
+		{"until", ReviewQuery{TeamID: "T1", Until: "2024-01-02T00:00:00Z"}, []string{"S1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.q.Limit = 10
+			page, err := s.QueryReviews(ctx, tt.q)
+			if err != nil {
+				t.Fatalf("QueryReviews: %v", err)
+			}
+			if got := pageIDs(page); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if page.Next != "" || page.Prev != "" {
+				t.Fatalf("single page has cursors next %q, prev %q", page.Next, page.Prev)
+			}
+		})
+	}
+
+	if _, err := s.QueryReviews(ctx, ReviewQuery{TeamID: "T1", Limit: 10, Cursor: "!!!"}); err == nil {
+		t.Fatal("QueryReviews with a malformed cursor succeeded")
+	}
+}
+
+func TestMemoryReplaceReview(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	if err := s.PutReview(ctx, &Review{SubmissionID: "S1", TeamID: "T1", Feedback: "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name         string
+		revision     int
+		next         int
+		feedback     string
+		wantOK       bool
+		wantRevision int
+	}{
+		{"from unrevised", 0, 1, "second", true, 1},
+		{"stale revision", 0, 1, "stale", false, 1},
+		{"current revision", 1, 2, "third", true, 2},
+		{"same revision", 2, 2, "rewritten", true, 2},
+		{"future revision", 5, 6, "future", false, 2},
+	}
+	for _, step := range steps {
+		r := &Review{SubmissionID: "S1", TeamID: "T1", Feedback: step.feedback, Revision: step.next}
+		ok, err := s.ReplaceReview(ctx, r, step.revision)
+		if err != nil || ok != step.wantOK {
+			t.Fatalf("%s: ReplaceReview = %v, %v; want %v", step.name, ok, err, step.wantOK)
+		}
+		stored, err := s.GetReview(ctx, "S1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Revision != step.wantRevision || (ok && stored.Feedback != step.feedback) || (!ok && stored.Feedback == step.feedback) {
+			t.Fatalf("%s: stored %q at revision %d, want revision %d", step.name, stored.Feedback, stored.Revision, step.wantRevision)
+		}
+	}
+
+	if ok, err := s.ReplaceReview(ctx, &Review{SubmissionID: "S2"}, 0); ok || err != nil {
+		t.Fatalf("ReplaceReview of a missing review = %v, %v; want false", ok, err)
+	}
+
+	requests := []MessageRef{{Channel: "D1", Timestamp: "1.2"}}
+	if ok, err := s.SetApprovalRequests(ctx, "S1", 1, requests); ok || err != nil {
+		t.Fatalf("SetApprovalRequests at a stale revision = %v, %v; want false", ok, err)
+	}
+	if ok, err := s.SetApprovalRequests(ctx, "S1", 2, requests); !ok || err != nil {
+		t.Fatalf("SetApprovalRequests = %v, %v; want true", ok, err)
+	}
+	stored, _ := s.GetReview(ctx, "S1")
+	if !reflect.DeepEqual(stored.ApprovalRequests, requests) || stored.Revision != 2 {
+		t.Fatalf("stored requests %v at revision %d", stored.ApprovalRequests, stored.Revision)
+	}
+}
@@ -0,0 +1,539 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// ErrNotFound is returned when a requested item does not exist.
+var ErrNotFound = errors.New("item not found")
+
+// BotTokens holds the bot credentials issued by oauth.v2.access.
+type BotTokens struct {
+	AccessToken  string `dynamodbav:"BotAccessToken"`
+	RefreshToken string `dynamodbav:"BotRefreshToken"`
+	ExpiresAt    int64  `dynamodbav:"BotTokenExpires"`
+	BotUserID    string `dynamodbav:"BotUserId"`
+	AppID        string `dynamodbav:"AppId"`
+}
+
+// AppTokens holds the app configuration token issued by tooling.tokens.rotate.
+type AppTokens struct {
+	AuthToken    string `dynamodbav:"AppAuthToken"`
+	RefreshToken string `dynamodbav:"AppRefreshToken"`
+	ExpiresAt    int64  `dynamodbav:"AppTokenExpiresAt"`
+	IssuedAt     int64  `dynamodbav:"AppTokenIssuedAt"`
+	UserID       string `dynamodbav:"AppUserID"`
+}
+
+// TeamTokens is everything stored for one installed workspace.
+type TeamTokens struct {
+	TeamID   string `dynamodbav:"TeamId"`
+	TeamName string `dynamodbav:"TeamName"`
+	Scope    string `dynamodbav:"Scope"`
+	BotTokens
+	AppTokens
+}
+
+// Review is a single feedback submission.
+type Review struct {
+	SubmissionID     string `dynamodbav:"SubmissionID"`
+	TeamID           string `dynamodbav:"TeamID"`
+	UserID           string `dynamodbav:"UserID,omitempty"`
+	UserName         string `dynamodbav:"UserName"`
+	EmployeeSelected string `dynamodbav:"EmployeeSelected"`
+	RevieweeID       string `dynamodbav:"RevieweeID,omitempty"`
+	Feedback         string `dynamodbav:"Feedback"`
+	Timestamp        string `dynamodbav:"Timestamp"`
+	// Anonymous reviews leave UserID and UserName empty and identify the
+	// author only by ReviewerHash, a keyed hash of their user ID.
+	Anonymous    bool   `dynamodbav:"Anonymous"`
+	ReviewerHash string `dynamodbav:"ReviewerHash,omitempty"`
+	EditedAt     string `dynamodbav:"EditedAt,omitempty"`
+	// TemplateID and TemplateVersion identify the form the review was
+	// written with. Reviews from before templates have neither and only
+	// carry Feedback.
+	TemplateID      string   `dynamodbav:"TemplateID,omitempty"`
+	TemplateVersion int      `dynamodbav:"TemplateVersion,omitempty"`
+	Answers         []Answer `dynamodbav:"Answers,omitempty"`
+	// FeedbackType is praise, constructive or both for reviews written
+	// with the guided form, whose prompts replace the feedback question.
+	FeedbackType string `dynamodbav:"FeedbackType,omitempty"`
+	// CycleID is the review cycle that was open when the review was
+	// submitted, if any.
+	CycleID string `dynamodbav:"CycleID,omitempty"`
+	// Status is where the review is in moderation. Reviews written while
+	// moderation was off have no status and count as approved.
+	Status        string         `dynamodbav:"ReviewStatus,omitempty"`
+	StatusHistory []StatusChange `dynamodbav:"StatusHistory,omitempty"`
+	// Sentiment scores the review text from -1 to 1. It is nil for reviews
+	// submitted before scoring existed.
+	Sentiment *float64 `dynamodbav:"Sentiment,omitempty"`
+	// NegativeAlerted marks the newest review of a run of strongly
+	// negative reviews that the reviewee's manager was alerted about.
+	NegativeAlerted bool `dynamodbav:"NegativeAlerted,omitempty"`
+	// ContentFlags names the content rules that warned about the review
+	// and that the author submitted anyway.
+	ContentFlags []string `dynamodbav:"ContentFlags,omitempty"`
+	// Revision counts the changes made to the review since it was
+	// submitted, so a change can be refused if the review changed after it
+	// was read.
+	Revision int `dynamodbav:"Revision,omitempty"`
+	// ApprovalRequests are the messages asking moderators to approve this
+	// revision of the review.
+	ApprovalRequests []MessageRef `dynamodbav:"ApprovalRequests,omitempty"`
+}
+
+// MessageRef locates a Slack message.
+type MessageRef struct {
+	Channel   string `dynamodbav:"Channel"`
+	Timestamp string `dynamodbav:"Timestamp"`
+}
+
+// Review statuses.
+const (
+	StatusPending          = "pending"
+	StatusApproved         = "approved"
+	StatusChangesRequested = "changes_requested"
+	StatusRejected         = "rejected"
+)
+
+// Approved reports whether r may be shown to people other than its author.
+func (r Review) Approved() bool {
+	return r.Status == "" || r.Status == StatusApproved
+}
+
+// StatusChange records one moderation transition of a review. By is empty
+// for transitions made by the author, so anonymous reviews stay anonymous.
+type StatusChange struct {
+	Status  string `dynamodbav:"Status"`
+	At      string `dynamodbav:"At"`
+	By      string `dynamodbav:"By,omitempty"`
+	Comment string `dynamodbav:"Comment,omitempty"`
+}
+
+// Answer is the response to one template question. The question's label
+// and scale are copied in so the answer still renders after the template
+// changes.
+type Answer struct {
+	QuestionID string `dynamodbav:"QuestionID" json:"question_id"`
+	Type       string `dynamodbav:"Type" json:"type"`
+	Label      string `dynamodbav:"Label" json:"label"`
+	// Text answers a text question.
+	Text string `dynamodbav:"Text,omitempty" json:"text,omitempty"`
+	// Choices answers a choice question.
+	Choices []string `dynamodbav:"Choices,omitempty" json:"choices,omitempty"`
+	// Rating answers a rating question; ScaleMax is the top of its scale.
+	Rating   int `dynamodbav:"Rating,omitempty" json:"rating,omitempty"`
+	ScaleMax int `dynamodbav:"ScaleMax,omitempty" json:"scale_max,omitempty"`
+	// Ratings answers a competency question.
+	Ratings []CompetencyRating `dynamodbav:"Ratings,omitempty" json:"ratings,omitempty"`
+}
+
+// CompetencyRating is the rating given to one competency.
+type CompetencyRating struct {
+	Competency string `dynamodbav:"Competency" json:"competency"`
+	Rating     int    `dynamodbav:"Rating" json:"rating"`
+}
+
+// ReviewQuery selects a page of reviews for one team. Reviews written
+// before multi-workspace support carry no TeamID and match no team until
+// the backfill-teams command tags them.
+type ReviewQuery struct {
+	TeamID string
+	// AuthorID, if set, only matches reviews written by that user.
+	// AuthorHash also matches their anonymous reviews.
+	AuthorID   string
+	AuthorHash string
+	// CycleID, if set, only matches reviews submitted in that cycle.
+	CycleID string
+	// RevieweeID, if set, only matches reviews about that user.
+	RevieweeID string
+	// Since and Until, if set, bound Timestamp. Since is inclusive and
+	// Until exclusive; both are RFC 3339 UTC like Timestamp.
+	Since string
+	Until string
+	// ApprovedOnly leaves out reviews that are still in moderation or were
+	// rejected.
+	ApprovedOnly bool
+	// Visible limits the query to what one viewer may read. Every query
+	// made on behalf of a user must set it; nil is unrestricted.
+	Visible *Visibility
+	Limit   int
+	// Cursor is empty for the newest page, or Next or Prev of an earlier
+	// ReviewPage.
+	Cursor string
+}
+
+// matches reports whether r satisfies the filters of q.
+func (q ReviewQuery) matches(r Review) bool {
+	if r.TeamID != q.TeamID {
+		return false
+	}
+	if q.AuthorID != "" && r.UserID != q.AuthorID && (q.AuthorHash == "" || r.ReviewerHash != q.AuthorHash) {
+		return false
+	}
+	if q.CycleID != "" && r.CycleID != q.CycleID {
+		return false
+	}
+	if q.RevieweeID != "" && r.RevieweeID != q.RevieweeID {
+		return false
+	}
+	if (q.Since != "" && r.Timestamp < q.Since) || (q.Until != "" && r.Timestamp >= q.Until) {
+		return false
+	}
+	if q.ApprovedOnly && !r.Approved() {
+		return false
+	}
+	if q.Visible != nil && !q.Visible.allows(r) {
+		return false
+	}
+	return true
+}
+
+// Visibility is the set of reviews a viewer may read: every review, or
+// those about RevieweeIDs plus those they wrote.
+type Visibility struct {
+	All bool
+	// RevieweeIDs are the people whose received reviews are visible.
+	RevieweeIDs []string
+	// AuthorID and AuthorHash make the viewer's own reviews visible,
+	// including anonymous ones.
+	AuthorID   string
+	AuthorHash string
+}
+
+func (v Visibility) allows(r Review) bool {
+	if v.All {
+		return true
+	}
+	if r.RevieweeID != "" {
+		for _, id := range v.RevieweeIDs {
+			if id == r.RevieweeID {
+				return true
+			}
+		}
+	}
+	if v.AuthorID != "" && r.UserID == v.AuthorID {
+		return true
+	}
+	return v.AuthorHash != "" && r.ReviewerHash == v.AuthorHash
+}
+
+// ReviewPage is one page of a review query. Next and Prev are opaque
+// cursors for the older and newer neighbouring pages, empty when there is
+// no such page.
+type ReviewPage struct {
+	Reviews []Review
+	Next    string
+	Prev    string
+}
+
+// User is a Slack user and the token they authorized the app with.
+type User struct {
+	UserID          string `dynamodbav:"UserID"`
+	Username        string `dynamodbav:"Username"`
+	Token           string `dynamodbav:"Token"`
+	TokenExpiration int64  `dynamodbav:"TokenExpiration"`
+}
+
+// RosterMember is an active, non-guest human member of a workspace.
+type RosterMember struct {
+	TeamID   string `dynamodbav:"TeamID"`
+	UserID   string `dynamodbav:"UserID"`
+	Name     string `dynamodbav:"Name"`
+	RealName string `dynamodbav:"RealName"`
+	// SearchText is the lowercased names, matched by SearchRoster.
+	SearchText string `dynamodbav:"SearchText"`
+}
+
+// Cycle is a feedback round of one team. It is open from the start of
+// StartDate to the end of EndDate, both YYYY-MM-DD in UTC.
+type Cycle struct {
+	TeamID    string `dynamodbav:"TeamID"`
+	CycleID   string `dynamodbav:"CycleID"`
+	Name      string `dynamodbav:"Name"`
+	StartDate string `dynamodbav:"StartDate"`
+	EndDate   string `dynamodbav:"EndDate"`
+	// Participants are the user IDs expected to review each other.
+	Participants []string `dynamodbav:"Participants"`
+	TemplateID   string   `dynamodbav:"TemplateID"`
+	CreatedBy    string   `dynamodbav:"CreatedBy"`
+	CreatedAt    string   `dynamodbav:"CreatedAt"`
+}
+
+// Draft is an unfinished review saved when its modal was closed.
+type Draft struct {
+	UserID          string   `dynamodbav:"UserID"`
+	DraftID         string   `dynamodbav:"DraftID"`
+	TeamID          string   `dynamodbav:"TeamID"`
+	RevieweeID      string   `dynamodbav:"RevieweeID,omitempty"`
+	RevieweeName    string   `dynamodbav:"RevieweeName,omitempty"`
+	CycleID         string   `dynamodbav:"CycleID,omitempty"`
+	TemplateID      string   `dynamodbav:"TemplateID"`
+	TemplateVersion int      `dynamodbav:"TemplateVersion"`
+	FeedbackType    string   `dynamodbav:"FeedbackType,omitempty"`
+	Answers         []Answer `dynamodbav:"Answers,omitempty"`
+	Anonymous       bool     `dynamodbav:"Anonymous"`
+	UpdatedAt       string   `dynamodbav:"UpdatedAt"`
+	// ExpiresAt is when the draft is discarded, in Unix seconds. DynamoDB
+	// deletes expired drafts through a TTL on this attribute.
+	ExpiresAt int64 `dynamodbav:"ExpiresAt"`
+}
+
+// Preferences are the settings a user chose for themselves.
+type Preferences struct {
+	TeamID string `dynamodbav:"TeamID"`
+	UserID string `dynamodbav:"UserID"`
+	// NotifyReceived opts in to a DM when a review of the user is
+	// published.
+	NotifyReceived bool `dynamodbav:"NotifyReceived"`
+}
+
+// OutboxMessage is a Slack message waiting to be delivered.
+type OutboxMessage struct {
+	MessageID string `dynamodbav:"MessageID"`
+	TeamID    string `dynamodbav:"TeamID"`
+	Channel   string `dynamodbav:"Channel"`
+	Text      string `dynamodbav:"Text"`
+	// Blocks is the JSON of the message blocks, if it has any.
+	Blocks    string `dynamodbav:"Blocks,omitempty"`
+	CreatedAt string `dynamodbav:"CreatedAt"`
+	Attempts  int    `dynamodbav:"Attempts"`
+	// NextAttemptAt is when the message is due, in Unix seconds.
+	NextAttemptAt int64  `dynamodbav:"NextAttemptAt"`
+	LastError     string `dynamodbav:"LastError,omitempty"`
+}
+
+// JobRun is the persisted state of a scheduled background job.
+type JobRun struct {
+	Name string `dynamodbav:"Name"`
+	// LastSuccess is when the job last completed without error, in Unix
+	// seconds, or zero if it never has.
+	LastSuccess int64 `dynamodbav:"LastSuccess"`
+	// Failures counts the runs that failed since the last success.
+	Failures  int    `dynamodbav:"Failures"`
+	LastError string `dynamodbav:"LastError,omitempty"`
+}
+
+// dueOutbox keeps the messages due at now, earliest first, at most limit.
+func dueOutbox(messages []OutboxMessage, now int64, limit int) []OutboxMessage {
+	due := messages[:0]
+	for _, m := range messages {
+		if m.NextAttemptAt <= now {
+			due = append(due, m)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt < due[j].NextAttemptAt
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due
+}
+
+func sortCycles(cycles []Cycle) {
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i].StartDate < cycles[j].StartDate
+	})
+}
+
+// liveDrafts drops expired drafts and sorts the rest newest first.
+func liveDrafts(drafts []Draft, now int64) []Draft {
+	live := drafts[:0]
+	for _, d := range drafts {
+		if d.ExpiresAt > now {
+			live = append(live, d)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].UpdatedAt > live[j].UpdatedAt
+	})
+	return live
+}
+
+// TokenStore persists per-workspace bot and app tokens.
+type TokenStore interface {
+	// PutTeamTokens replaces everything stored for t.TeamID.
+	PutTeamTokens(ctx context.Context, t *TeamTokens) error
+	// GetTeamTokens returns ErrNotFound if the team is not installed.
+	GetTeamTokens(ctx context.Context, teamID string) (*TeamTokens, error)
+	// ReplaceBotTokens and ReplaceAppTokens store t only if the stored
+	// refresh token is still refreshToken, so a token refreshed elsewhere
+	// in the meantime is not overwritten. They return false, storing
+	// nothing, if it changed or the team is not installed.
+	ReplaceBotTokens(ctx context.Context, teamID, refreshToken string, t BotTokens) (bool, error)
+	ReplaceAppTokens(ctx context.Context, teamID, refreshToken string, t AppTokens) (bool, error)
+	// ListTeamIDs returns every installed team.
+	ListTeamIDs(ctx context.Context) ([]string, error)
+}
+
+// ReviewStore persists feedback submissions.
+type ReviewStore interface {
+	// PutReview creates r, or replaces the review with its SubmissionID.
+	PutReview(ctx context.Context, r *Review) error
+	// ReplaceReview replaces the stored review with r only if it is still
+	// at revision. It returns false, leaving the stored review alone, if it
+	// changed or was deleted. Callers that change what the review says give
+	// r a later Revision.
+	ReplaceReview(ctx context.Context, r *Review, revision int) (bool, error)
+	// SetApprovalRequests records the approval requests sent for a review
+	// at revision, returning false if it has moved on since.
+	SetApprovalRequests(ctx context.Context, submissionID string, revision int, requests []MessageRef) (bool, error)
+	// GetReview returns ErrNotFound if there is no such review.
+	GetReview(ctx context.Context, submissionID string) (*Review, error)
+	DeleteReview(ctx context.Context, submissionID string) error
+	// QueryReviews returns one page of reviews, newest first.
+	QueryReviews(ctx context.Context, q ReviewQuery) (*ReviewPage, error)
+	// CountReviews returns how many reviews match q, ignoring its Limit
+	// and Cursor.
+	CountReviews(ctx context.Context, q ReviewQuery) (int, error)
+	// EachReview calls fn for every stored review, in no particular order.
+	EachReview(ctx context.Context, fn func(Review) error) error
+}
+
+// UserStore persists Slack users.
+type UserStore interface {
+	PutUser(ctx context.Context, u *User) error
+	// EachUser calls fn for every stored user, in no particular order.
+	EachUser(ctx context.Context, fn func(User) error) error
+}
+
+// RosterStore persists the synced member list of each workspace.
+type RosterStore interface {
+	// ReplaceRoster makes members the complete roster of teamID, removing
+	// anyone no longer in it.
+	ReplaceRoster(ctx context.Context, teamID string, members []RosterMember) error
+	// GetRosterMember returns ErrNotFound if userID is not on the roster.
+	GetRosterMember(ctx context.Context, teamID, userID string) (*RosterMember, error)
+	// SearchRoster returns up to limit members whose SearchText contains
+	// query, ordered by user ID.
+	SearchRoster(ctx context.Context, teamID, query string, limit int) ([]RosterMember, error)
+	// CountRoster returns how many members teamID has.
+	CountRoster(ctx context.Context, teamID string) (int, error)
+}
+
+// CycleStore persists review cycles.
+type CycleStore interface {
+	PutCycle(ctx context.Context, c *Cycle) error
+	// GetCycle returns ErrNotFound if there is no such cycle.
+	GetCycle(ctx context.Context, teamID, cycleID string) (*Cycle, error)
+	// ListCycles returns every cycle of teamID, ordered by StartDate.
+	ListCycles(ctx context.Context, teamID string) ([]Cycle, error)
+}
+
+// DraftStore persists review drafts per user. Expired drafts are never
+// returned.
+type DraftStore interface {
+	PutDraft(ctx context.Context, d *Draft) error
+	// GetDraft returns ErrNotFound if there is no such unexpired draft.
+	GetDraft(ctx context.Context, userID, draftID string) (*Draft, error)
+	// ListDrafts returns the drafts of userID, most recently updated first.
+	ListDrafts(ctx context.Context, userID string) ([]Draft, error)
+	DeleteDraft(ctx context.Context, userID, draftID string) error
+	// EachDraft calls fn for every unexpired draft, in no particular order.
+	EachDraft(ctx context.Context, fn func(Draft) error) error
+}
+
+// PreferenceStore persists the settings users choose for themselves.
+type PreferenceStore interface {
+	// GetPreferences returns zero Preferences for a user who has not chosen
+	// any.
+	GetPreferences(ctx context.Context, teamID, userID string) (*Preferences, error)
+	PutPreferences(ctx context.Context, p *Preferences) error
+}
+
+// OutboxStore persists Slack messages until they are delivered.
+type OutboxStore interface {
+	PutOutbox(ctx context.Context, m *OutboxMessage) error
+	// DueOutbox returns up to limit messages whose NextAttemptAt is at or
+	// before now, earliest first.
+	DueOutbox(ctx context.Context, now int64, limit int) ([]OutboxMessage, error)
+	// ClaimOutbox moves the NextAttemptAt of a message from due to until,
+	// unless something else changed or deleted it first. Only the caller
+	// that gets true may deliver the message.
+	ClaimOutbox(ctx context.Context, messageID string, due, until int64) (bool, error)
+	DeleteOutbox(ctx context.Context, messageID string) error
+}
+
+// JobStore persists the state of scheduled background jobs.
+type JobStore interface {
+	// GetJobRun returns a zero JobRun for a job that has never run.
+	GetJobRun(ctx context.Context, name string) (*JobRun, error)
+	PutJobRun(ctx context.Context, r *JobRun) error
+}
+
+// StatsStore persists named counters per team, maintained from the
+// reviews so reports do not have to read every review.
+type StatsStore interface {
+	// AddStats adds each delta to the counter with its key.
+	AddStats(ctx context.Context, teamID string, deltas map[string]int) error
+	// ReplaceStats makes counters the complete set of counters of teamID.
+	ReplaceStats(ctx context.Context, teamID string, counters map[string]int) error
+	// GetStats returns every counter of teamID.
+	GetStats(ctx context.Context, teamID string) (map[string]int, error)
+}
+
+// Store is the full persistence layer used by the bot.
+type Store interface {
+	TokenStore
+	ReviewStore
+	UserStore
+	RosterStore
+	CycleStore
+	StatsStore
+	DraftStore
+	PreferenceStore
+	OutboxStore
+	JobStore
+}
+
+// Tables names the DynamoDB tables backing a Store.
+type Tables struct {
+	Tokens  string
+	Reviews string
+	Users   string
+	Roster  string
+	Cycles  string
+	Stats   string
+	Drafts  string
+	Prefs   string
+	Outbox  string
+	Jobs    string
+}
+
+func (t Tables) withDefaults() Tables {
+	if t.Tokens == "" {
+		t.Tokens = "Tokens"
+	}
+	if t.Reviews == "" {
+		t.Reviews = "SurveyData"
+	}
+	if t.Users == "" {
+		t.Users = "Users"
+	}
+	if t.Roster == "" {
+		t.Roster = "Roster"
+	}
+	if t.Cycles == "" {
+		t.Cycles = "Cycles"
+	}
+	if t.Stats == "" {
+		t.Stats = "Stats"
+	}
+	if t.Drafts == "" {
+		t.Drafts = "Drafts"
+	}
+	if t.Prefs == "" {
+		t.Prefs = "Preferences"
+	}
+	if t.Outbox == "" {
+		t.Outbox = "Outbox"
+	}
+	if t.Jobs == "" {
+		t.Jobs = "Jobs"
+	}
+	return t
+}
@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// visibilityReviews are written by and about U1 to U4 of T1. U1 and U4
+// also wrote anonymously, as H1 and H4.
+var visibilityReviews = []Review{
+	{SubmissionID: "R1", TeamID: "T1", UserID: "U1", RevieweeID: "U2", Timestamp: "2024-01-01T00:00:00Z"},
+	{SubmissionID: "R2", TeamID: "T1", Anonymous: true, ReviewerHash: "H1", RevieweeID: "U3", Timestamp: "2024-01-02T00:00:00Z"},
+	{SubmissionID: "R3", TeamID: "T1", UserID: "U2", RevieweeID: "U1", Timestamp: "2024-01-03T00:00:00Z"},
+	{SubmissionID: "R4", TeamID: "T1", UserID: "U3", RevieweeID: "U4", Timestamp: "2024-01-04T00:00:00Z"},
+	{SubmissionID: "R5", TeamID: "T1", Anonymous: true, ReviewerHash: "H4", RevieweeID: "U1", Timestamp: "2024-01-05T00:00:00Z"},
+	{SubmissionID: "R6", TeamID: "T1", UserID: "U2", RevieweeID: "U3", Timestamp: "2024-01-06T00:00:00Z", Status: StatusPending},
+	// Reviews of another team, and from before teams were recorded.
+	{SubmissionID: "R7", TeamID: "T2", UserID: "U1", RevieweeID: "U2", Timestamp: "2024-01-07T00:00:00Z"},
+	{SubmissionID: "R8", UserID: "U1", RevieweeID: "U1", Timestamp: "2024-01-08T00:00:00Z"},
+}
+
+// visibilityCases are the queries made for viewers with each visibility
+// rule, and the reviews each may read.
+var visibilityCases = []struct {
+	name string
+	q    ReviewQuery
+	want []string
+}{
+	{"all", ReviewQuery{Visible: &Visibility{All: true}}, []string{"R6", "R5", "R4", "R3", "R2", "R1"}},
+	{"unrestricted", ReviewQuery{}, []string{"R6", "R5", "R4", "R3", "R2", "R1"}},
+	{"nothing", ReviewQuery{Visible: &Visibility{}}, nil},
+	{"received", ReviewQuery{Visible: &Visibility{RevieweeIDs: []string{"U1"}}}, []string{"R5", "R3"}},
+	{"reports", ReviewQuery{Visible: &Visibility{RevieweeIDs: []string{"U3", "U4"}}}, []string{"R6", "R4", "R2"}},
+	{"authored", ReviewQuery{Visible: &Visibility{AuthorID: "U1", AuthorHash: "H1"}}, []string{"R2", "R1"}},
+	{"authored by name only", ReviewQuery{Visible: &Visibility{AuthorID: "U1"}}, []string{"R1"}},
+	{"employee", ReviewQuery{Visible: &Visibility{RevieweeIDs: []string{"U1"}, AuthorID: "U1", AuthorHash: "H1"}}, []string{"R5", "R3", "R2", "R1"}},
+	{"approved only", ReviewQuery{ApprovedOnly: true, Visible: &Visibility{RevieweeIDs: []string{"U3"}}}, []string{"R2"}},
+
+	// Filtering on a reviewee reads RevieweeIDIndex.
+	{"reviewee, all", ReviewQuery{RevieweeID: "U3", Visible: &Visibility{All: true}}, []string{"R6", "R2"}},
+	{"reviewee received", ReviewQuery{RevieweeID: "U1", Visible: &Visibility{RevieweeIDs: []string{"U1"}}}, []string{"R5", "R3"}},
+	{"reviewee not visible", ReviewQuery{RevieweeID: "U4", Visible: &Visibility{RevieweeIDs: []string{"U1"}, AuthorID: "U1", AuthorHash: "H1"}}, nil},
+	{"reviewee written about", ReviewQuery{RevieweeID: "U3", Visible: &Visibility{RevieweeIDs: []string{"U1"}, AuthorID: "U1", AuthorHash: "H1"}}, []string{"R2"}},
+	{"reviewee of a report", ReviewQuery{RevieweeID: "U4", Visible: &Visibility{RevieweeIDs: []string{"U3", "U4"}}}, []string{"R4"}},
+
+	// Filtering on an author reads UserIDIndex, and ReviewerHashIndex
+	// for their anonymous reviews.
+	{"given", ReviewQuery{AuthorID: "U1", AuthorHash: "H1", Visible: &Visibility{RevieweeIDs: []string{"U1"}, AuthorID: "U1", AuthorHash: "H1"}}, []string{"R2", "R1"}},
+	{"given by name only", ReviewQuery{AuthorID: "U1", Visible: &Visibility{All: true}}, []string{"R1"}},
+	{"author not visible", ReviewQuery{AuthorID: "U3", Visible: &Visibility{RevieweeIDs: []string{"U1"}, AuthorID: "U1", AuthorHash: "H1"}}, nil},
+	{"author about a report", ReviewQuery{AuthorID: "U2", Visible: &Visibility{RevieweeIDs: []string{"U3", "U4"}}}, []string{"R6"}},
+	// Someone else's hash must not reveal their anonymous reviews.
+	{"other author's hash", ReviewQuery{AuthorID: "U4", AuthorHash: "H4", Visible: &Visibility{RevieweeIDs: []string{"U3"}, AuthorID: "U3"}}, nil},
+}
+
+func TestVisibilityMemory(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	for i := range visibilityReviews {
+		if err := s.PutReview(ctx, &visibilityReviews[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range visibilityCases {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.q
+			q.TeamID = "T1"
+			q.Limit = 100
+			page, err := s.QueryReviews(ctx, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pageIDs(page); !reflect.DeepEqual(got, append([]string{}, tt.want...)) {
+				t.Fatalf("QueryReviews = %v, want %v", got, tt.want)
+			}
+			n, err := s.CountReviews(ctx, q)
+			if err != nil || n != len(tt.want) {
+				t.Fatalf("CountReviews = %d, %v; want %d", n, err, len(tt.want))
+			}
+		})
+	}
+}
+
+// TestVisibilityDynamo runs the index queries and filter expressions the
+// DynamoDB store would send against the same reviews.
+func TestVisibilityDynamo(t *testing.T) {
+	var items []map[string]types.AttributeValue
+	for _, r := range visibilityReviews {
+		item, err := attributevalue.MarshalMap(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item["ConstantPartitionKey"] = &types.AttributeValueMemberS{Value: "ALL"}
+		items = append(items, item)
+	}
+	s := &DynamoStore{tables: Tables{}.withDefaults()}
+
+	for _, tt := range visibilityCases {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.q
+			q.TeamID = "T1"
+			q.Limit = 100
+
+			var got []Review
+			for _, iq := range reviewIndexesFor(q) {
+				input := s.reviewQueryInput(iq)
+				for _, item := range items {
+					// Items without the index key are not in the index.
+					key, ok := item[iq.index.Key].(*types.AttributeValueMemberS)
+					if !ok || key.Value != iq.index.Value {
+						continue
+					}
+					match, err := evalCondition(*input.FilterExpression, item, input.ExpressionAttributeValues, input.ExpressionAttributeNames)
+					if err != nil {
+						t.Fatalf("evaluating %q: %v", *input.FilterExpression, err)
+					}
+					if match {
+						var r Review
+						if err := attributevalue.UnmarshalMap(item, &r); err != nil {
+							t.Fatal(err)
+						}
+						got = append(got, r)
+					}
+				}
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i].Timestamp > got[j].Timestamp })
+
+			ids := []string{}
+			for _, r := range got {
+				ids = append(ids, r.SubmissionID)
+			}
+			if !reflect.DeepEqual(ids, append([]string{}, tt.want...)) {
+				t.Fatalf("index queries %v return %v, want %v", reviewIndexesFor(q), ids, tt.want)
+			}
+		})
+	}
+}
+
+// evalCondition evaluates the subset of the DynamoDB condition expression
+// syntax that reviewFilter produces: AND, OR, parentheses, = >= <, IN,
+// attribute_exists and attribute_not_exists on string attributes.
+func evalCondition(expr string, item, values map[string]types.AttributeValue, names map[string]string) (bool, error) {
+	p := &conditionParser{item: item, values: values, names: names}
+	for _, field := range strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ", ",", " , ").Replace(expr)) {
+		p.tokens = append(p.tokens, field)
+	}
+	ok, err := p.or()
+	if err == nil && p.pos != len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return ok, err
+}
+
+type conditionParser struct {
+	tokens []string
+	pos    int
+	item   map[string]types.AttributeValue
+	values map[string]types.AttributeValue
+	names  map[string]string
+}
+
+func (p *conditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *conditionParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *conditionParser) expect(token string) error {
+	if t := p.next(); t != token {
+		return fmt.Errorf("want %q, got %q", token, t)
+	}
+	return nil
+}
+
+func (p *conditionParser) or() (bool, error) {
+	result, err := p.and()
+	for err == nil && p.peek() == "OR" {
+		p.next()
+		var b bool
+		b, err = p.and()
+		result = result || b
+	}
+	return result, err
+}
+
+func (p *conditionParser) and() (bool, error) {
+	result, err := p.term()
+	for err == nil && p.peek() == "AND" {
+		p.next()
+		var b bool
+		b, err = p.term()
+		result = result && b
+	}
+	return result, err
+}
+
+func (p *conditionParser) term() (bool, error) {
+	switch t := p.next(); t {
+	case "(":
+		result, err := p.or()
+		if err != nil {
+			return false, err
+		}
+		return result, p.expect(")")
+	case "attribute_exists", "attribute_not_exists":
+		if err := p.expect("("); err != nil {
+			return false, err
+		}
+		_, exists := p.item[p.name(p.next())]
+		if err := p.expect(")"); err != nil {
+			return false, err
+		}
+		return exists == (t == "attribute_exists"), nil
+	default:
+		left, leftOK := p.operand(t)
+		op := p.next()
+		if op == "IN" {
+			if err := p.expect("("); err != nil {
+				return false, err
+			}
+			found := false
+			for {
+				right, rightOK := p.operand(p.next())
+				found = found || (leftOK && rightOK && left == right)
+				if sep := p.next(); sep == ")" {
+					return found, nil
+				} else if sep != "," {
+					return false, fmt.Errorf("want , or ) in IN, got %q", sep)
+				}
+			}
+		}
+		right, rightOK := p.operand(p.next())
+		if !leftOK || !rightOK {
+			return false, nil
+		}
+		switch op {
+		case "=":
+			return left == right, nil
+		case ">=":
+			return left >= right, nil
+		case "<":
+			return left < right, nil
+		}
+		return false, fmt.Errorf("unknown operator %q", op)
+	}
+}
+
+func (p *conditionParser) name(token string) string {
+	if n, ok := p.names[token]; ok {
+		return n
+	}
+	return token
+}
+
+// operand returns the string value of a placeholder or attribute, and
+// whether it has one.
+func (p *conditionParser) operand(token string) (string, bool) {
+	v, ok := p.values[token]
+	if !strings.HasPrefix(token, ":") {
+		v, ok = p.item[p.name(token)]
+	}
+	s, isString := v.(*types.AttributeValueMemberS)
+	if !ok || !isString {
+		return "", false
+	}
+	return s.Value, true
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/fieldcrypt"
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+var store storage.Store
+
+// openStore builds the Store selected by storage.BACKEND in config.yaml,
+// wrapped with field encryption when encryption.PROVIDER is set.
+func openStore(ctx context.Context) (storage.Store, error) {
+	s, err := openBackend(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := openKeyProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		return s, nil
+	}
+	return storage.NewEncryptedStore(s, fieldcrypt.NewEncrypter(keys)), nil
+}
+
+// openBackend builds the unencrypted Store. The memory backend is seeded
+// from the slack section of the config so the bot can run locally without
+// AWS.
+func openBackend(ctx context.Context) (storage.Store, error) {
+	switch configure.Storage.Backend {
+	case "memory":
+		log.Printf("Using in-memory storage; data will not survive a restart")
+		mem := storage.NewMemoryStore()
+		if configure.Slack.TeamID != "" {
+			err := mem.PutTeamTokens(ctx, &storage.TeamTokens{
+				TeamID: configure.Slack.TeamID,
+				BotTokens: storage.BotTokens{
+					AccessToken: configure.Slack.BOTToken,
+					AppID:       configure.Slack.AppID,
+				},
+				AppTokens: storage.AppTokens{
+					AuthToken:    configure.Slack.AppAccessToken,
+					RefreshToken: configure.Slack.AppRefreshToken,
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return mem, nil
+	case "", "dynamodb":
+		return storage.NewDynamoStore(ctx, storage.Tables{
+			Tokens:  configure.Storage.TokensTable,
+			Reviews: configure.Storage.ReviewsTable,
+			Users:   configure.Storage.UsersTable,
+			Roster:  configure.Storage.RosterTable,
+			Cycles:  configure.Storage.CyclesTable,
+			Stats:   configure.Storage.StatsTable,
+			Drafts:  configure.Storage.DraftsTable,
+			Prefs:   configure.Storage.PreferencesTable,
+			Outbox:  configure.Storage.OutboxTable,
+			Jobs:    configure.Storage.JobsTable,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", configure.Storage.Backend)
+	}
+}
+
+// openKeyProvider returns the data key provider selected by
+// encryption.PROVIDER, or nil if encryption is disabled.
+func openKeyProvider(ctx context.Context) (fieldcrypt.KeyProvider, error) {
+	switch configure.Encryption.Provider {
+	case "":
+		return nil, nil
+	case "keyring":
+		return fieldcrypt.LoadKeyring(configure.Encryption.KeyringFile)
+	case "kms":
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load SDK config: %w", err)
+		}
+		client := kms.NewFromConfig(cfg, func(o *kms.Options) {
+			if configure.Encryption.KMSEndpoint != "" {
+				o.BaseEndpoint = aws.String(configure.Encryption.KMSEndpoint)
+			}
+		})
+		return fieldcrypt.NewKMS(client, configure.Encryption.KMSKeyID), nil
+	default:
+		return nil, fmt.Errorf("unknown encryption provider %q", configure.Encryption.Provider)
+	}
+}
+
+func StoreUserToken(userID, username, token string, tokenExpiration time.Time) error {
+	err := store.PutUser(context.TODO(), &storage.User{
+		UserID:          userID,
+		Username:        username,
+		Token:           token,
+		TokenExpiration: tokenExpiration.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put item, %w", err)
+	}
+
+	fmt.Println("User token stored/updated successfully")
+	return nil
+}
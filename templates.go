@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/BigPhatNerd/cbaseSLACK/reviewtemplate"
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+)
+
+// reviewTemplates holds every loaded version of every review template.
+var reviewTemplates *reviewtemplate.Set
+
+// loadReviewTemplates loads the templates in feedback.TEMPLATES_DIR, or
+// only the built-in single question form if no directory is configured.
+func loadReviewTemplates() (*reviewtemplate.Set, error) {
+	dir := configure.Feedback.TemplatesDir
+	if dir == "" {
+		return reviewtemplate.NewSet(reviewtemplate.Default)
+	}
+
+	set, err := reviewtemplate.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	if set.Latest(defaultTemplateID()) == nil {
+		return nil, fmt.Errorf("template %q is not defined in %s", defaultTemplateID(), dir)
+	}
+	log.Printf("Loaded review templates %v from %s", set.IDs(), dir)
+	return set, nil
+}
+
+func defaultTemplateID() string {
+	if configure.Feedback.Template != "" {
+		return configure.Feedback.Template
+	}
+	return reviewtemplate.Default.ID
+}
+
+// currentTemplate is the template new reviews are written with.
+func currentTemplate() *reviewtemplate.Template {
+	return reviewTemplates.Latest(defaultTemplateID())
+}
+
+// templateFor returns the template a review was written with, or the
+// current one if that template is no longer loaded.
+func templateFor(id string, version int) *reviewtemplate.Template {
+	if t := reviewTemplates.Resolve(id, version); t != nil {
+		return t
+	}
+	return currentTemplate()
+}
+
+// Feedback types of the guided form. Each replaces the feedback question
+// of the template with its prompts.
+const (
+	feedbackPraise       = "praise"
+	feedbackConstructive = "constructive"
+	feedbackBoth         = "both"
+)
+
+var (
+	praisePrompt = reviewtemplate.Question{
+		ID:          "praise",
+		Type:        reviewtemplate.Text,
+		Label:       "What did they do well?",
+		Placeholder: "Something they did that you want to see more of...",
+		Required:    true,
+	}
+	constructivePrompt = reviewtemplate.Question{
+		ID:          "constructive",
+		Type:        reviewtemplate.Text,
+		Label:       "What could they do differently?",
+		Placeholder: "A situation, what happened and what would have helped...",
+		Required:    true,
+	}
+)
+
+// feedbackPrompts returns the prompts of feedbackType, or nil if it is not
+// a feedback type.
+func feedbackPrompts(feedbackType string) []reviewtemplate.Question {
+	switch feedbackType {
+	case feedbackPraise:
+		return []reviewtemplate.Question{praisePrompt}
+	case feedbackConstructive:
+		return []reviewtemplate.Question{constructivePrompt}
+	case feedbackBoth:
+		return []reviewtemplate.Question{praisePrompt, constructivePrompt}
+	default:
+		return nil
+	}
+}
+
+// isFeedbackQuestion reports whether id is the feedback question or one of
+// the prompts replacing it.
+func isFeedbackQuestion(id string) bool {
+	return id == reviewtemplate.FeedbackQuestionID || id == praisePrompt.ID || id == constructivePrompt.ID
+}
+
+// promptTemplate returns t with its feedback question replaced by the
+// prompts of feedbackType, or t itself if there is no feedback type. The
+// copy keeps the ID and version of t, which reviews are recorded with.
+func promptTemplate(t *reviewtemplate.Template, feedbackType string) *reviewtemplate.Template {
+	prompts := feedbackPrompts(feedbackType)
+	if prompts == nil {
+		return t
+	}
+
+	copied := *t
+	copied.Questions = nil
+	replaced := false
+	for _, q := range t.Questions {
+		if q.ID == reviewtemplate.FeedbackQuestionID {
+			copied.Questions = append(copied.Questions, prompts...)
+			replaced = true
+			continue
+		}
+		copied.Questions = append(copied.Questions, q)
+	}
+	if !replaced {
+		copied.Questions = append(copied.Questions, prompts...)
+	}
+	return &copied
+}
+
+// reviewFeedback is the text stored as the Feedback of a review: the
+// answer to the feedback question, or the answers to the prompts that
+// replaced it.
+func reviewFeedback(answers []storage.Answer) string {
+	if feedback := reviewtemplate.Feedback(answers); feedback != "" {
+		return feedback
+	}
+	var texts []string
+	for _, a := range answers {
+		if isFeedbackQuestion(a.QuestionID) && a.Type == reviewtemplate.Text {
+			texts = append(texts, a.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// reviewAnswers returns the answers of review, treating the Feedback of a
+// review from before templates as the answer to the feedback question.
+func reviewAnswers(review storage.Review) []storage.Answer {
+	if len(review.Answers) > 0 || review.Feedback == "" {
+		return review.Answers
+	}
+	return []storage.Answer{{
+		QuestionID: reviewtemplate.FeedbackQuestionID,
+		Type:       reviewtemplate.Text,
+		Label:      "Feedback",
+		Text:       review.Feedback,
+	}}
+}
+
+// reviewBody renders the answers of review as mrkdwn, one per line.
+func reviewBody(review storage.Review) string {
+	var lines []string
+	for _, a := range reviewAnswers(review) {
+		lines = append(lines, fmt.Sprintf("*%s:* %s", a.Label, reviewtemplate.Format(a)))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/oauth"
+)
+
+// defaultTokenRefreshMargin is how long before expiry tokens are refreshed
+// when slack.TOKEN_REFRESH_MARGIN is not set. The token jobs run every
+// few minutes, well inside it.
+const defaultTokenRefreshMargin = 30 * time.Minute
+
+// authErrors are the Slack API errors that a refreshed bot token fixes.
+var authErrors = map[string]bool{
+	"invalid_auth":  true,
+	"token_expired": true,
+}
+
+// errNotReplayable means a request body cannot be read a second time, so
+// the request cannot be retried.
+var errNotReplayable = errors.New("request body cannot be replayed")
+
+func tokenRefreshMargin() time.Duration {
+	if configure.Slack.TokenRefreshMargin == "" {
+		return defaultTokenRefreshMargin
+	}
+	d, err := time.ParseDuration(configure.Slack.TokenRefreshMargin)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid slack.TOKEN_REFRESH_MARGIN %q, using %s", configure.Slack.TokenRefreshMargin, defaultTokenRefreshMargin)
+		return defaultTokenRefreshMargin
+	}
+	return d
+}
+
+// botRefreshLocks serialises refreshes of each team's bot token within
+// this instance. Slack rotates the refresh token on every refresh, so two
+// refreshes at once would leave one of them with a spent refresh token;
+// RefreshBotToken keeps refreshes by other instances from overwriting
+// each other.
+var botRefreshLocks sync.Map
+
+func botRefreshLock(teamID string) *sync.Mutex {
+	mu, _ := botRefreshLocks.LoadOrStore(teamID, &sync.Mutex{})
+	return mu.(*sync.Mutex)
+}
+
+// refreshBotTokens refreshes the bot token of every installed team that
+// expires within the refresh margin. Teams whose token does not rotate
+// are skipped. It returns the errors of every team that could not be
+// refreshed.
+func refreshBotTokens(ctx context.Context) error {
+	teamIDs, err := store.ListTeamIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list teams: %w", err)
+	}
+
+	margin := tokenRefreshMargin()
+	var errs []error
+	for _, teamID := range teamIDs {
+		if err := refreshBotTokenIfDue(ctx, teamID, margin); err != nil {
+			log.Printf("Error refreshing bot token for team %s: %v", teamID, err)
+			errs = append(errs, fmt.Errorf("team %s: %w", teamID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func refreshBotTokenIfDue(ctx context.Context, teamID string, margin time.Duration) error {
+	mu := botRefreshLock(teamID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	tokens, err := store.GetTeamTokens(ctx, teamID)
+	if err != nil {
+		return err
+	}
+	if tokens.BotTokens.RefreshToken == "" || !oauth.ExpiresWithin(tokens.BotTokens.ExpiresAt, margin) {
+		return nil
+	}
+	if err := RefreshBotToken(ctx, teamID); err != nil {
+		return err
+	}
+	log.Printf("Bot token refreshed successfully for team %s", teamID)
+	return nil
+}
+
+// rotateAppTokens rotates the app tokens that expire within the refresh
+// margin. Only the team in slack.TEAM_ID may be bootstrapped from
+// HEROKU_REFRESH_TOKEN.
+func rotateAppTokens(ctx context.Context) error {
+	return oauth.RotateAppTokens(ctx, store, configure.Slack.TeamID, tokenRefreshMargin())
+}
+
+// refreshBotTokenAfter returns a working bot token for teamID after a call
+// with failed was rejected. If another request or instance already
+// replaced failed, its token is returned; otherwise the token is refreshed
+// now. Either way the team's client is swapped to the returned token.
+func refreshBotTokenAfter(ctx context.Context, teamID, failed string) (string, error) {
+	mu := botRefreshLock(teamID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	tokens, err := store.GetTeamTokens(ctx, teamID)
+	if err != nil {
+		return "", err
+	}
+	if tokens.BotTokens.AccessToken != failed {
+		slackClients.Swap(teamID, tokens.BotTokens.AccessToken)
+		return tokens.BotTokens.AccessToken, nil
+	}
+	if tokens.BotTokens.RefreshToken == "" {
+		return "", fmt.Errorf("team %s has no BotRefreshToken", teamID)
+	}
+
+	if err := RefreshBotToken(ctx, teamID); err != nil {
+		return "", err
+	}
+	tokens, err = store.GetTeamTokens(ctx, teamID)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Bot token of team %s refreshed after it was rejected", teamID)
+	return tokens.BotTokens.AccessToken, nil
+}
+
+// botHTTPClient sends the Slack API requests of one team's bot. A request
+// rejected because the token expired is retried once with a refreshed
+// token, and later requests through the same client use that token too.
+type botHTTPClient struct {
+	teamID string
+	// token is the one the slack.Client was built with, and so the one in
+	// every request it makes.
+	token string
+
+	mu      sync.Mutex
+	current string
+}
+
+func newBotHTTPClient(teamID, token string) *botHTTPClient {
+	return &botHTTPClient{teamID: teamID, token: token, current: token}
+}
+
+func (c *botHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	token := c.current
+	c.mu.Unlock()
+
+	sent := req
+	if token != c.token {
+		r, err := withToken(req, c.token, token)
+		if err != nil && !errors.Is(err, errNotReplayable) {
+			return nil, err
+		}
+		if err == nil {
+			sent = r
+		} else {
+			token = c.token
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(sent)
+	if err != nil {
+		return nil, err
+	}
+	code, err := slackErrorCode(resp)
+	if err != nil {
+		return nil, err
+	}
+	if !authErrors[code] {
+		return resp, nil
+	}
+
+	fresh, err := refreshBotTokenAfter(req.Context(), c.teamID, token)
+	if err != nil {
+		log.Printf("Error refreshing rejected bot token of team %s: %v", c.teamID, err)
+		return resp, nil
+	}
+	retry, err := withToken(req, c.token, fresh)
+	if err != nil {
+		log.Printf("Not retrying Slack call of team %s: %v", c.teamID, err)
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	c.mu.Lock()
+	c.current = fresh
+	c.mu.Unlock()
+	return http.DefaultClient.Do(retry)
+}
+
+// slackErrorCode returns the error of a Slack API response that reports
+// one, leaving resp.Body to be read again.
+func slackErrorCode(resp *http.Response) (string, error) {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return "", nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &result) != nil || result.OK {
+		return "", nil
+	}
+	return result.Error, nil
+}
+
+// withToken copies req with token in place of old, wherever slack-go
+// puts it: the Authorization header, the form body or the query.
+func withToken(req *http.Request, old, token string) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		r.Header.Set("Authorization", strings.Replace(auth, old, token, 1))
+	}
+	r.URL.RawQuery = strings.ReplaceAll(r.URL.RawQuery, old, token)
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return r, nil
+	}
+	if req.GetBody == nil {
+		return nil, errNotReplayable
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.ReplaceAll(data, []byte(old), []byte(token))
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	r.ContentLength = int64(len(data))
+	return r, nil
+}
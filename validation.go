@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/BigPhatNerd/cbaseSLACK/reviewtemplate"
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/slack-go/slack"
+)
+
+// defaultMinFeedbackLength applies when validation.MIN_FEEDBACK_LENGTH is
+// not set.
+const defaultMinFeedbackLength = 10
+
+func minFeedbackLength() int {
+	if configure.Validation.MinFeedbackLength != 0 {
+		return configure.Validation.MinFeedbackLength
+	}
+	return defaultMinFeedbackLength
+}
+
+// reviewCooldown is how long an author must wait before reviewing the same
+// person again. Zero disables the rule.
+func reviewCooldown() time.Duration {
+	if configure.Validation.Cooldown == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(configure.Validation.Cooldown)
+	if err != nil {
+		log.Printf("Invalid validation.COOLDOWN %q, not enforcing a cooldown: %v", configure.Validation.Cooldown, err)
+		return 0
+	}
+	return d
+}
+
+// validateSubmission checks a submitted feedback modal and returns errors
+// keyed by block ID, or the roster entry of the reviewee if there are
+// none. editingID is the review being edited, which is exempt from the
+// cooldown.
+func validateSubmission(ctx context.Context, teamID, userID string, values map[string]map[string]slack.BlockAction, answers []storage.Answer, editingID string) (map[string]string, *storage.RosterMember, error) {
+	errs := feedbackLengthErrors(answers)
+
+	// The option is only a hint from the client; everything about the
+	// reviewee is looked up again.
+	revieweeID := values["employee_select"]["employee_select_action"].SelectedOption.Value
+	problem, member, err := validateReviewee(ctx, teamID, userID, revieweeID, editingID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if problem != "" {
+		errs["employee_select"] = problem
+	}
+
+	if len(errs) > 0 {
+		return errs, nil, nil
+	}
+	return nil, member, nil
+}
+
+// validateReviewee checks that userID may review revieweeID now, and
+// returns what is wrong if not, or else the roster entry of the reviewee.
+// editingID is the review being edited, which is exempt from the cooldown.
+func validateReviewee(ctx context.Context, teamID, userID, revieweeID, editingID string) (string, *storage.RosterMember, error) {
+	if revieweeID == "" {
+		return "Choose who this review is about.", nil, nil
+	}
+	if revieweeID == userID {
+		return "You can't review yourself.", nil, nil
+	}
+
+	member, err := store.GetRosterMember(ctx, teamID, revieweeID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "This person is no longer an active member of the workspace.", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	if cooldown := reviewCooldown(); cooldown > 0 && editingID == "" {
+		page, err := store.QueryReviews(ctx, storage.ReviewQuery{
+			TeamID:     teamID,
+			AuthorID:   userID,
+			AuthorHash: reviewerHash(teamID, userID),
+			RevieweeID: revieweeID,
+			Since:      time.Now().Add(-cooldown).UTC().Format(time.RFC3339),
+			Limit:      1,
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		if len(page.Reviews) > 0 {
+			return fmt.Sprintf("You already reviewed %s recently. You can review them again %s.", member.Name, nextReviewAllowed(page.Reviews[0], cooldown)), nil, nil
+		}
+	}
+	return "", member, nil
+}
+
+// feedbackLengthErrors checks the length of the answers to the feedback
+// question and the prompts replacing it. A blank optional question has no
+// answer and is not checked.
+func feedbackLengthErrors(answers []storage.Answer) map[string]string {
+	errs := make(map[string]string)
+	for _, a := range answers {
+		if isFeedbackQuestion(a.QuestionID) && a.Type == reviewtemplate.Text && len([]rune(a.Text)) < minFeedbackLength() {
+			errs[a.QuestionID] = fmt.Sprintf("Please write at least %d characters.", minFeedbackLength())
+		}
+	}
+	return errs
+}
+
+// nextReviewAllowed describes when the cooldown after last ends.
+func nextReviewAllowed(last storage.Review, cooldown time.Duration) string {
+	t, err := time.Parse(time.RFC3339, last.Timestamp)
+	if err != nil {
+		return "later"
+	}
+	next := t.Add(cooldown)
+	return fmt.Sprintf("on %s", next.Format("Jan 2 at 15:04 UTC"))
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/BigPhatNerd/cbaseSLACK/reviewtemplate"
+	"github.com/BigPhatNerd/cbaseSLACK/slackview"
+	"github.com/BigPhatNerd/cbaseSLACK/storage"
+	"github.com/slack-go/slack"
+)
+
+//go:embed slackViews/*.json
+var bundledViews embed.FS
+
+// views holds the templates of the home tab and of the modals.
+var views *slackview.Set
+
+// successView is the data of slackViews/success.json.
+type successView struct {
+	Message string
+}
+
+// noticeView is the data of slackViews/notice.json.
+type noticeView struct {
+	Title   string
+	Message string
+}
+
+// loadViews loads the templates in views.DIR, or the bundled ones, and
+// renders each with sample data so mistakes are found at startup rather
+// than when a user opens the view.
+func loadViews() (*slackview.Set, error) {
+	var fsys fs.FS
+	if dir := configure.Views.Dir; dir != "" {
+		fsys = os.DirFS(dir)
+	} else {
+		sub, err := fs.Sub(bundledViews, "slackViews")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	}
+
+	set, err := slackview.Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, home := range sampleHomeViews() {
+		if _, err := set.Home("homepage", home); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := set.Modal("success", successView{Message: "Sample"}); err != nil {
+		return nil, err
+	}
+	if _, err := set.Modal("notice", noticeView{Title: "Sample", Message: "Sample"}); err != nil {
+		return nil, err
+	}
+	for name, samples := range sampleForms() {
+		for _, data := range samples {
+			if _, err := set.Modal(name, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return set, nil
+}
+
+// sampleForms exercises every branch of the form modals, by view name.
+func sampleForms() map[string][]interface{} {
+	questions := reviewtemplate.Default.Blocks(nil)
+	modes := []string{anonymityAllowed, anonymityRequired, anonymityForbidden}
+
+	forms := map[string][]interface{}{
+		"cycle": {
+			cycleView{Today: "2006-01-02"},
+			cycleView{Today: "2006-01-02", Templates: []cycleTemplate{{ID: "a", Name: "A"}, {ID: "b", Name: "B"}}, DefaultTemplate: "b"},
+		},
+		"moderationComment": {
+			moderationCommentView{},
+			moderationCommentView{ChangesRequested: true},
+		},
+		"wizardConfirm": {
+			wizardStepView{RevieweeID: "U1", Body: "*Feedback:* Sample"},
+			wizardStepView{RevieweeID: "U1", Body: "*Feedback:* Sample", Anonymous: true, Moderated: true},
+		},
+	}
+	for _, mode := range modes {
+		forms["wizardPrompts"] = append(forms["wizardPrompts"],
+			wizardStepView{RevieweeID: "U1", Questions: questions},
+			wizardStepView{RevieweeID: "U1", Questions: questions, First: true, Anonymity: mode, Anonymous: true})
+		forms["wizardReviewee"] = append(forms["wizardReviewee"],
+			wizardStepView{Anonymity: mode},
+			wizardStepView{Anonymity: mode, Anonymous: true})
+	}
+	for _, feedbackType := range []string{"", feedbackPraise, feedbackConstructive, feedbackBoth} {
+		forms["wizardType"] = append(forms["wizardType"], wizardStepView{RevieweeID: "U1", FeedbackType: feedbackType})
+	}
+	return forms
+}
+
+// sampleHomeViews exercises every branch of the home tab: the landing page
+// with everything shown, and a page of reviews.
+func sampleHomeViews() []homeView {
+	overflow := reviewOverflow(storage.Review{SubmissionID: "S0"})
+	return []homeView{
+		{UserID: "U0"},
+		{
+			UserID: "U0",
+			Cycle:  &homeCycle{Name: "Sample", EndDate: "2006-01-02", Closes: 1136246399, Participant: true, Reviewed: 1, Participants: 2},
+			Admin:  true,
+			Given: &homeSection{Count: 4, Reviews: []homeReview{
+				{Reviewer: "Sample", Reviewee: "<@U1>", Body: "*Feedback:* Sample", Status: "Waiting for approval", Actions: overflow},
+			}},
+			Received: &homeSection{Count: 1, Reviews: []homeReview{
+				{Reviewer: "_Anonymous_", Reviewee: "<@U0>", Body: "*Feedback:* Sample"},
+			}},
+			NotifyReceived: true,
+			Drafts: []homeDraft{
+				{DraftID: "D1", Reviewee: "<@U1>", Excerpt: "Sample", Expires: 1136246399, ExpiresDate: "2006-01-02"},
+				{DraftID: "D2", Expires: 1136246399, ExpiresDate: "2006-01-02"},
+			},
+			DraftCount: 2,
+			Analytics:  []slack.Block{slack.NewDividerBlock()},
+		},
+		{UserID: "U0", Reviews: &homeReviews{}},
+		{
+			UserID: "U0",
+			Reviews: &homeReviews{
+				Reviews: []homeReview{
+					{Reviewer: "Sample", Reviewee: "<@U1>", Body: "*Feedback:* Sample", Actions: overflow},
+					{Reviewer: "_Anonymous_", Reviewee: "<@U1>", Body: "*Feedback:* Sample"},
+				},
+				Prev: "prev",
+				Next: "next",
+			},
+		},
+	}
+}
+
+// renderModal renders the modal view name. The views were checked at
+// startup, so failing here is a bug in a template branch the samples do
+// not reach; the message is still shown, without the template's layout.
+func renderModal(name string, data interface{}, title, message string) slack.ModalViewRequest {
+	view, err := views.Modal(name, data)
+	if err != nil {
+		log.Printf("Error rendering view %s: %v", name, err)
+		return slack.ModalViewRequest{
+			Type:  slack.VTModal,
+			Title: slack.NewTextBlockObject("plain_text", title, false, false),
+			Close: slack.NewTextBlockObject("plain_text", "Close", false, false),
+			Blocks: slack.Blocks{BlockSet: []slack.Block{
+				slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", message, false, false), nil, nil),
+			}},
+		}
+	}
+	return view
+}
+
+// renderForm renders the modal form name and sets what its handlers rely
+// on, which is not up to the template. If rendering fails, a notice is
+// shown in place of the form.
+func renderForm(name string, data interface{}, callbackID, metadata string, notifyOnClose bool) slack.ModalViewRequest {
+	view, err := views.Modal(name, data)
+	if err != nil {
+		log.Printf("Error rendering view %s: %v", name, err)
+		return *noticeModal("Something went wrong", "This form could not be shown. Please try again later.")
+	}
+	view.CallbackID = callbackID
+	view.PrivateMetadata = metadata
+	view.NotifyOnClose = notifyOnClose
+	return view
+}
@@ -0,0 +1,9 @@
+package main
+
+import "testing"
+
+func TestBundledViews(t *testing.T) {
+	if _, err := loadViews(); err != nil {
+		t.Fatalf("bundled views do not render: %v", err)
+	}
+}